@@ -0,0 +1,67 @@
+package analytics
+
+import "time"
+
+const (
+	DeviceBot     = "bot"
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceUnknown = "unknown"
+)
+
+type ClickEvent struct {
+	ID             uint      `json:"-" gorm:"primaryKey"`
+	ShortenedURLID uint      `json:"-" gorm:"index;not null"`
+	Timestamp      time.Time `json:"timestamp" gorm:"index;not null"`
+	Referrer       string    `json:"referrer"`
+	UserAgent      string    `json:"userAgent"`
+	Device         string    `json:"device" gorm:"not null"`
+	IPHash         string    `json:"-" gorm:"index;not null"`
+}
+
+type ClickRequest struct {
+	ShortenedURLID uint
+	Referrer       string
+	UserAgent      string
+	IP             string
+}
+
+type StatsRequest struct {
+	UserID uint
+	URLID  uint
+	Days   int `validate:"min=1,max=365"`
+}
+
+type DailyStats struct {
+	Date           string `json:"date"`
+	Clicks         int64  `json:"clicks"`
+	UniqueVisitors int64  `json:"unique_visitors"`
+}
+
+type StatsResponse struct {
+	TotalClicks    int64            `json:"total_clicks"`
+	UniqueVisitors int64            `json:"unique_visitors"`
+	Devices        map[string]int64 `json:"devices"`
+	Daily          []DailyStats     `json:"daily"`
+}
+
+// ExportRequest asks for the clicks on the links UserID owns, including
+// links in the trash.
+type ExportRequest struct {
+	UserID uint
+}
+
+// ExportedClick is a click event as included in account exports.
+type ExportedClick struct {
+	URLID     uint      `json:"url_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Referrer  string    `json:"referrer"`
+	UserAgent string    `json:"user_agent"`
+	Device    string    `json:"device"`
+	IPHash    string    `json:"ip_hash"`
+}
+
+type ExportResponse struct {
+	Clicks []ExportedClick `json:"clicks"`
+}
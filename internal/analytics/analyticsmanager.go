@@ -0,0 +1,222 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
+	"gorm.io/gorm"
+)
+
+const dateLayout = "2006-01-02"
+
+type AnalyticsManager interface {
+	RecordClick(ClickRequest)
+	GetStats(StatsRequest) (*StatsResponse, dcubeerrs.Error)
+	ExportClicks(ExportRequest) (*ExportResponse, dcubeerrs.Error)
+	// PurgeLinks deletes the clicks of links that are being deleted for good,
+	// including any still buffered.
+	PurgeLinks(shortenedURLIDs []uint) error
+	Flush()
+	Close()
+}
+
+type AnalyticsManagerImpl struct {
+	database    *gorm.DB
+	writer      *BatchWriter
+	salt        []byte
+	permissions urlshortener.Permissions
+}
+
+func NewAnalyticsManager(database *gorm.DB, salt []byte, permissions urlshortener.Permissions) AnalyticsManager {
+	return &AnalyticsManagerImpl{
+		database:    database,
+		writer:      NewBatchWriter(database, defaultBufferSize, defaultBatchSize, defaultFlushInterval),
+		salt:        salt,
+		permissions: permissions,
+	}
+}
+
+// HashIP returns a salted SHA-256 digest of ip so that unique visitors can be
+// counted without storing client addresses.
+func HashIP(ip string, salt []byte) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(ip))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *AnalyticsManagerImpl) RecordClick(req ClickRequest) {
+	event := ClickEvent{
+		ShortenedURLID: req.ShortenedURLID,
+		Timestamp:      time.Now().UTC(),
+		Referrer:       req.Referrer,
+		UserAgent:      req.UserAgent,
+		Device:         ClassifyDevice(req.UserAgent),
+		IPHash:         HashIP(req.IP, m.salt),
+	}
+
+	if !m.writer.Write(event) {
+		log.Printf("analytics: buffer full, dropping click event for url %d", req.ShortenedURLID)
+	}
+}
+
+func (m *AnalyticsManagerImpl) GetStats(req StatsRequest) (*StatsResponse, dcubeerrs.Error) {
+	var shortenedURL urlshortener.ShortenedURL
+
+	err := m.database.First(&shortenedURL, urlshortener.ShortenedURL{ID: req.URLID}).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, dcubeerrs.New(http.StatusNotFound, "URL does not exist")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching url stats")
+	}
+
+	if e := urlshortener.Authorize(m.permissions, &shortenedURL, req.UserID, urlshortener.VerbView); e != nil {
+		return nil, e
+	}
+
+	var resp StatsResponse
+	events := m.database.Model(&ClickEvent{}).Where("shortened_url_id = ?", req.URLID)
+
+	err = events.Session(&gorm.Session{}).Count(&resp.TotalClicks).Error
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching url stats")
+	}
+
+	err = events.Session(&gorm.Session{}).Distinct("ip_hash").Count(&resp.UniqueVisitors).Error
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching url stats")
+	}
+
+	var devices []struct {
+		Device string
+		Count  int64
+	}
+
+	err = events.Session(&gorm.Session{}).Select("device, COUNT(*) AS count").Group("device").Scan(&devices).Error
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching url stats")
+	}
+
+	resp.Devices = make(map[string]int64, len(devices))
+	for _, d := range devices {
+		resp.Devices[d.Device] = d.Count
+	}
+
+	daily, e := m.dailyStats(events.Session(&gorm.Session{}), req.Days)
+	if e != nil {
+		return nil, e
+	}
+	resp.Daily = daily
+
+	return &resp, nil
+}
+
+// dailyStats buckets the last days of clicks by UTC date in Go rather than in
+// SQL, since date truncation differs between the databases we run on.
+func (m *AnalyticsManagerImpl) dailyStats(events *gorm.DB, days int) ([]DailyStats, dcubeerrs.Error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+
+	var rows []ClickEvent
+	err := events.Select("timestamp, ip_hash").Where("timestamp >= ?", since).Find(&rows).Error
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching url stats")
+	}
+
+	clicks := make(map[string]int64)
+	visitors := make(map[string]map[string]bool)
+
+	for _, row := range rows {
+		date := row.Timestamp.UTC().Format(dateLayout)
+		clicks[date]++
+		if visitors[date] == nil {
+			visitors[date] = make(map[string]bool)
+		}
+		visitors[date][row.IPHash] = true
+	}
+
+	daily := make([]DailyStats, 0, days)
+	for d := since; !d.After(today); d = d.AddDate(0, 0, 1) {
+		date := d.Format(dateLayout)
+		daily = append(daily, DailyStats{
+			Date:           date,
+			Clicks:         clicks[date],
+			UniqueVisitors: int64(len(visitors[date])),
+		})
+	}
+
+	return daily, nil
+}
+
+// ExportClicks flushes buffered events first so that the export includes
+// clicks recorded just before it was requested.
+func (m *AnalyticsManagerImpl) ExportClicks(req ExportRequest) (*ExportResponse, dcubeerrs.Error) {
+	m.writer.Flush()
+
+	links := m.database.Unscoped().Model(&urlshortener.ShortenedURL{}).Select("id").Where("user_id = ?", req.UserID)
+
+	var events []ClickEvent
+	err := m.database.Where("shortened_url_id IN (?)", links).Order("id").Find(&events).Error
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while exporting clicks")
+	}
+
+	resp := &ExportResponse{Clicks: make([]ExportedClick, len(events))}
+	for i, event := range events {
+		resp.Clicks[i] = ExportedClick{
+			URLID:     event.ShortenedURLID,
+			Timestamp: event.Timestamp,
+			Referrer:  event.Referrer,
+			UserAgent: event.UserAgent,
+			Device:    event.Device,
+			IPHash:    event.IPHash,
+		}
+	}
+
+	return resp, nil
+}
+
+func (m *AnalyticsManagerImpl) PurgeLinks(shortenedURLIDs []uint) error {
+	if len(shortenedURLIDs) == 0 {
+		return nil
+	}
+
+	m.writer.Flush()
+
+	return NewClickPurger(m.database).PurgeLinks(shortenedURLIDs)
+}
+
+// ClickPurger deletes the clicks of links that are being deleted for good
+// through database, which may be the transaction deleting the links. Unlike
+// AnalyticsManager.PurgeLinks it does not wait for buffered clicks, so the
+// caller flushes them before the transaction starts.
+type ClickPurger struct {
+	database *gorm.DB
+}
+
+func NewClickPurger(database *gorm.DB) *ClickPurger {
+	return &ClickPurger{database: database}
+}
+
+func (p *ClickPurger) PurgeLinks(shortenedURLIDs []uint) error {
+	if len(shortenedURLIDs) == 0 {
+		return nil
+	}
+
+	return p.database.Where("shortened_url_id IN ?", shortenedURLIDs).Delete(&ClickEvent{}).Error
+}
+
+func (m *AnalyticsManagerImpl) Flush() {
+	m.writer.Flush()
+}
+
+func (m *AnalyticsManagerImpl) Close() {
+	m.writer.Close()
+}
@@ -0,0 +1,33 @@
+package analytics
+
+import "strings"
+
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "curl", "wget", "python-requests", "headless"}
+
+// ClassifyDevice maps a user agent onto a coarse device class. It is
+// deliberately simple: the goal is a rough breakdown, not fingerprinting.
+func ClassifyDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	if ua == "" {
+		return DeviceUnknown
+	}
+
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return DeviceBot
+		}
+	}
+
+	if strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")) {
+		return DeviceTablet
+	}
+
+	if strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") ||
+		strings.Contains(ua, "ipod") || strings.Contains(ua, "windows phone") {
+		return DeviceMobile
+	}
+
+	return DeviceDesktop
+}
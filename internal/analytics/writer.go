@@ -0,0 +1,140 @@
+package analytics
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultBufferSize = 4096
+const defaultBatchSize = 200
+const defaultFlushInterval = 2 * time.Second
+
+// BatchWriter buffers click events in memory and persists them in batches
+// from a single background goroutine, so callers never wait on the database.
+type BatchWriter struct {
+	database      *gorm.DB
+	events        chan ClickEvent
+	flushRequests chan chan struct{}
+	batchSize     int
+	flushInterval time.Duration
+	closeOnce     sync.Once
+	// mu guards closed, so that Write never sends on the closed channel.
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func NewBatchWriter(database *gorm.DB, bufferSize int, batchSize int, flushInterval time.Duration) *BatchWriter {
+	w := &BatchWriter{
+		database:      database,
+		events:        make(chan ClickEvent, bufferSize),
+		flushRequests: make(chan chan struct{}),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Write enqueues an event without blocking. It returns false and drops the
+// event when the buffer is full or the writer has been closed.
+func (w *BatchWriter) Write(event ClickEvent) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return false
+	}
+
+	select {
+	case w.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// Flush blocks until every event enqueued before the call has been persisted.
+func (w *BatchWriter) Flush() {
+	ack := make(chan struct{})
+	select {
+	case w.flushRequests <- ack:
+		<-ack
+	case <-w.done:
+	}
+}
+
+// Close persists any buffered events and stops the background goroutine.
+func (w *BatchWriter) Close() {
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		close(w.events)
+		w.mu.Unlock()
+
+		<-w.done
+	})
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]ClickEvent, 0, w.batchSize)
+
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				w.persist(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.batchSize {
+				batch = w.persist(batch)
+			}
+		case ack := <-w.flushRequests:
+			batch = w.drain(batch)
+			batch = w.persist(batch)
+			close(ack)
+		case <-ticker.C:
+			batch = w.persist(batch)
+		}
+	}
+}
+
+func (w *BatchWriter) drain(batch []ClickEvent) []ClickEvent {
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, event)
+		default:
+			return batch
+		}
+	}
+}
+
+func (w *BatchWriter) persist(batch []ClickEvent) []ClickEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	err := w.database.CreateInBatches(batch, w.batchSize).Error
+
+	if err != nil {
+		log.Printf("analytics: failed to persist %d click events: %s", len(batch), err)
+	}
+
+	return batch[:0]
+}
@@ -0,0 +1,31 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBatchWriterClose(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "clicks.db")), &gorm.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&ClickEvent{}))
+
+	writer := NewBatchWriter(db, 16, 8, time.Hour)
+	assert.True(t, writer.Write(ClickEvent{ShortenedURLID: 1, Timestamp: time.Now(), Device: "desktop"}))
+
+	// Buffered events are persisted on close, and later writes are dropped
+	// instead of panicking.
+	writer.Close()
+	assert.False(t, writer.Write(ClickEvent{ShortenedURLID: 1, Timestamp: time.Now(), Device: "desktop"}))
+	writer.Flush()
+	writer.Close()
+
+	var clicks int64
+	db.Model(&ClickEvent{}).Count(&clicks)
+	assert.Equal(t, int64(1), clicks)
+}
@@ -0,0 +1,100 @@
+package apikey
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scopes limit what a key can be used for. Requests authenticated with a
+// session token are not restricted by scope.
+const (
+	ScopeLinksRead       = "links:read"
+	ScopeLinksWrite      = "links:write"
+	ScopeWorkspacesRead  = "workspaces:read"
+	ScopeWorkspacesWrite = "workspaces:write"
+	ScopeWebhooksRead    = "webhooks:read"
+	ScopeWebhooksWrite   = "webhooks:write"
+)
+
+// APIKey is a long-lived credential for machine clients. Only a hash of the
+// secret is stored; the secret itself is shown once, when the key is created.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     Scopes     `json:"scopes" gorm:"type:text;not null;default:''"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+}
+
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Scopes is stored as a single space separated column.
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+func (s *Scopes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = Scopes{}
+	case string:
+		*s = strings.Fields(v)
+	case []byte:
+		*s = strings.Fields(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", value)
+	}
+
+	return nil
+}
+
+func (s Scopes) Contains(scope string) bool {
+	for _, existing := range s {
+		if existing == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateRequest struct {
+	UserID    uint       `json:"-"`
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=links:read links:write workspaces:read workspaces:write webhooks:read webhooks:write"` //nolint:lll
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type ListRequest struct {
+	UserID uint
+}
+
+type RevokeRequest struct {
+	UserID uint
+	ID     uint
+}
+
+type DeleteAllRequest struct {
+	UserID uint
+}
+
+// CreateResponse carries the secret of a new key. It cannot be retrieved
+// again later.
+type CreateResponse struct {
+	Key    APIKey `json:"key"`
+	Secret string `json:"secret"`
+}
+
+type ListResponse struct {
+	Keys []APIKey `json:"keys"`
+}
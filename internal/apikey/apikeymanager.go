@@ -0,0 +1,188 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"github.com/Imranr2/DCUBE_API/internal/user"
+)
+
+// SecretPrefix starts every key so that keys can be told apart from session
+// tokens, and spotted by secret scanners.
+const SecretPrefix = "dcube_"
+
+const secretBytes = 32
+
+// displayPrefixLength is how much of the secret is kept in the clear to help
+// users tell their keys apart.
+const displayPrefixLength = len(SecretPrefix) + 6
+
+// lastUsedResolution limits how often the last used time of a busy key is
+// written back.
+const lastUsedResolution = time.Minute
+
+type APIKeyManager interface {
+	CreateKey(CreateRequest) (*CreateResponse, dcubeerrs.Error)
+	ListKeys(ListRequest) (*ListResponse, dcubeerrs.Error)
+	RevokeKey(RevokeRequest) dcubeerrs.Error
+	DeleteAllKeys(DeleteAllRequest) dcubeerrs.Error
+	// Authenticate returns the active key matching secret.
+	Authenticate(secret string) (*APIKey, dcubeerrs.Error)
+}
+
+// Directory looks up the owners of keys. user.Repository satisfies it.
+type Directory interface {
+	FindByID(id uint) (*user.User, error)
+}
+
+type APIKeyManagerImpl struct {
+	repository Repository
+	users      Directory
+}
+
+func NewAPIKeyManager(repository Repository, users Directory) APIKeyManager {
+	return &APIKeyManagerImpl{
+		repository: repository,
+		users:      users,
+	}
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a
+// session token.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, SecretPrefix)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *APIKeyManagerImpl) CreateKey(req CreateRequest) (*CreateResponse, dcubeerrs.Error) {
+	now := time.Now().UTC()
+
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		if !expiresAt.After(now) {
+			return nil, dcubeerrs.New(http.StatusBadRequest, "Expiry time must be in the future")
+		}
+		req.ExpiresAt = &expiresAt
+	}
+
+	raw := make([]byte, secretBytes)
+
+	if _, err := rand.Read(raw); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating api key")
+	}
+
+	secret := SecretPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	key := APIKey{
+		UserID:    req.UserID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    secret[:displayPrefixLength],
+		KeyHash:   hashSecret(secret),
+		Scopes:    normalizeScopes(req.Scopes),
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if err := m.repository.Create(&key); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating api key")
+	}
+
+	return &CreateResponse{Key: key, Secret: secret}, nil
+}
+
+// normalizeScopes drops duplicates while keeping the order given.
+func normalizeScopes(scopes []string) Scopes {
+	normalized := Scopes{}
+
+	for _, scope := range scopes {
+		if !normalized.Contains(scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+
+	return normalized
+}
+
+func (m *APIKeyManagerImpl) ListKeys(req ListRequest) (*ListResponse, dcubeerrs.Error) {
+	keys, err := m.repository.ListByUser(req.UserID)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching api keys")
+	}
+
+	if keys == nil {
+		keys = []APIKey{}
+	}
+
+	return &ListResponse{Keys: keys}, nil
+}
+
+func (m *APIKeyManagerImpl) RevokeKey(req RevokeRequest) dcubeerrs.Error {
+	err := m.repository.Revoke(req.UserID, req.ID, time.Now().UTC())
+
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return dcubeerrs.New(http.StatusNotFound, "API key does not exist")
+		}
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while revoking api key")
+	}
+
+	return nil
+}
+
+func (m *APIKeyManagerImpl) DeleteAllKeys(req DeleteAllRequest) dcubeerrs.Error {
+	if err := m.repository.DeleteByUser(req.UserID); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting api keys")
+	}
+
+	return nil
+}
+
+func (m *APIKeyManagerImpl) Authenticate(secret string) (*APIKey, dcubeerrs.Error) {
+	key, err := m.repository.FindByHash(hashSecret(secret))
+
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, dcubeerrs.New(http.StatusUnauthorized, "API key is invalid")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while checking api key")
+	}
+
+	now := time.Now().UTC()
+
+	if !key.IsActive(now) {
+		return nil, dcubeerrs.New(http.StatusUnauthorized, "API key has expired or been revoked")
+	}
+
+	owner, err := m.users.FindByID(key.UserID)
+
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			return nil, dcubeerrs.New(http.StatusUnauthorized, "API key is invalid")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while checking api key")
+	}
+
+	if owner.DisabledAt != nil {
+		return nil, dcubeerrs.New(http.StatusForbidden, "Account is disabled")
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := m.repository.Touch(key.ID, now); err != nil {
+			log.Printf("api key: recording use of key %d: %s", key.ID, err)
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
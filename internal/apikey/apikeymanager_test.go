@@ -0,0 +1,80 @@
+package apikey
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestManager() (APIKeyManager, user.Repository) {
+	users := user.NewMemoryRepository()
+	users.Create(&user.User{Username: "alice"})
+	return NewAPIKeyManager(NewMemoryRepository(), users), users
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	manager, users := newTestManager()
+
+	created, err := manager.CreateKey(CreateRequest{
+		UserID: 1,
+		Name:   "ci",
+		Scopes: []string{ScopeLinksRead, ScopeLinksRead, ScopeLinksWrite},
+	})
+	assert.Nil(t, err)
+	assert.True(t, IsAPIKey(created.Secret))
+	assert.Equal(t, created.Secret[:len(created.Key.Prefix)], created.Key.Prefix)
+	assert.Equal(t, Scopes{ScopeLinksRead, ScopeLinksWrite}, created.Key.Scopes)
+
+	key, err := manager.Authenticate(created.Secret)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), key.UserID)
+
+	listed, _ := manager.ListKeys(ListRequest{UserID: 1})
+	assert.Len(t, listed.Keys, 1)
+	assert.NotNil(t, listed.Keys[0].LastUsedAt)
+
+	_, err = manager.Authenticate(created.Secret + "x")
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+
+	// Keys stop working while their owner's account is disabled.
+	owner, _ := users.FindByID(1)
+	now := time.Now()
+	owner.DisabledAt = &now
+	users.Update(owner, user.ColumnDisabledAt)
+
+	_, err = manager.Authenticate(created.Secret)
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	past := time.Now().Add(-time.Minute)
+	_, err = manager.CreateKey(CreateRequest{UserID: 1, Name: "old", Scopes: []string{ScopeLinksRead}, ExpiresAt: &past})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+}
+
+func TestRevokeAndDeleteKeys(t *testing.T) {
+	manager, _ := newTestManager()
+	first, _ := manager.CreateKey(CreateRequest{UserID: 1, Name: "first", Scopes: []string{ScopeLinksRead}})
+	second, _ := manager.CreateKey(CreateRequest{UserID: 1, Name: "second", Scopes: []string{ScopeLinksRead}})
+
+	err := manager.RevokeKey(RevokeRequest{UserID: 2, ID: first.Key.ID})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+
+	err = manager.RevokeKey(RevokeRequest{UserID: 1, ID: first.Key.ID})
+	assert.Nil(t, err)
+	err = manager.RevokeKey(RevokeRequest{UserID: 1, ID: first.Key.ID})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+
+	_, err = manager.Authenticate(first.Secret)
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+
+	err = manager.DeleteAllKeys(DeleteAllRequest{UserID: 1})
+	assert.Nil(t, err)
+
+	_, err = manager.Authenticate(second.Secret)
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+
+	listed, _ := manager.ListKeys(ListRequest{UserID: 1})
+	assert.Empty(t, listed.Keys)
+}
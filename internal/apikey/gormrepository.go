@@ -0,0 +1,65 @@
+package apikey
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormRepository struct {
+	database *gorm.DB
+}
+
+func NewGormRepository(database *gorm.DB) Repository {
+	return &GormRepository{
+		database: database,
+	}
+}
+
+func (r *GormRepository) Create(key *APIKey) error {
+	return r.database.Create(key).Error
+}
+
+func (r *GormRepository) FindByHash(hash string) (*APIKey, error) {
+	var key APIKey
+	err := r.database.Where("key_hash = ?", hash).First(&key).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *GormRepository) ListByUser(userID uint) ([]APIKey, error) {
+	var keys []APIKey
+	err := r.database.Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *GormRepository) Revoke(userID uint, id uint, now time.Time) error {
+	result := r.database.Model(&APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", now)
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *GormRepository) Touch(id uint, now time.Time) error {
+	return r.database.Model(&APIKey{}).Where("id = ?", id).Update("last_used_at", now).Error
+}
+
+func (r *GormRepository) DeleteByUser(userID uint) error {
+	return r.database.Where("user_id = ?", userID).Delete(&APIKey{}).Error
+}
@@ -0,0 +1,96 @@
+package apikey
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps API keys in process memory. It is meant for tests
+// and local development, not for production use.
+type MemoryRepository struct {
+	mu   sync.RWMutex
+	keys []APIKey
+}
+
+func NewMemoryRepository() Repository {
+	return &MemoryRepository{}
+}
+
+func (r *MemoryRepository) Create(key *APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.ID = uint(len(r.keys) + 1)
+	key.CreatedAt = time.Now()
+	r.keys = append(r.keys, *key)
+
+	return nil
+}
+
+func (r *MemoryRepository) FindByHash(hash string) (*APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.UserID != 0 && key.KeyHash == hash {
+			return &key, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) ListByUser(userID uint) ([]APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var keys []APIKey
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if r.keys[i].UserID == userID {
+			keys = append(keys, r.keys[i])
+		}
+	}
+
+	return keys, nil
+}
+
+func (r *MemoryRepository) Revoke(userID uint, id uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].ID == id && r.keys[i].UserID == userID && r.keys[i].RevokedAt == nil {
+			r.keys[i].RevokedAt = &now
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (r *MemoryRepository) Touch(id uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			r.keys[i].LastUsedAt = &now
+		}
+	}
+
+	return nil
+}
+
+// DeleteByUser clears the user's keys in place so that IDs stay stable.
+func (r *MemoryRepository) DeleteByUser(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].UserID == userID {
+			r.keys[i] = APIKey{ID: r.keys[i].ID}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package apikey
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("api key not found")
+
+// Repository abstracts API key storage so that APIKeyManagerImpl does not
+// depend on a particular database.
+type Repository interface {
+	Create(key *APIKey) error
+	FindByHash(hash string) (*APIKey, error)
+	// ListByUser returns every key of the user, including revoked and expired
+	// ones, newest first.
+	ListByUser(userID uint) ([]APIKey, error)
+	// Revoke marks the user's key as revoked, or returns ErrNotFound if the
+	// user has no unrevoked key with that ID.
+	Revoke(userID uint, id uint, now time.Time) error
+	// Touch records that the key was used at now.
+	Touch(id uint, now time.Time) error
+	DeleteByUser(userID uint) error
+}
@@ -1,26 +1,115 @@
 package application
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"reflect"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Imranr2/DCUBE_API/internal/analytics"
+	"github.com/Imranr2/DCUBE_API/internal/apikey"
+	"github.com/Imranr2/DCUBE_API/internal/audit"
+	"github.com/Imranr2/DCUBE_API/internal/cache"
 	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"github.com/Imranr2/DCUBE_API/internal/qrcode"
+	"github.com/Imranr2/DCUBE_API/internal/ratelimit"
+	"github.com/Imranr2/DCUBE_API/internal/screening"
 	"github.com/Imranr2/DCUBE_API/internal/session"
 	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
 	"github.com/Imranr2/DCUBE_API/internal/user"
 	"github.com/Imranr2/DCUBE_API/internal/utils"
+	"github.com/Imranr2/DCUBE_API/internal/webhook"
+	"github.com/Imranr2/DCUBE_API/internal/workspace"
 	"github.com/go-playground/validator"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 )
 
+const defaultSweepInterval = time.Minute
+const defaultTrashPurgeInterval = time.Hour
+const defaultTrashRetention = 30 * 24 * time.Hour
+const defaultCodeReuseDelay = 90 * 24 * time.Hour
+const defaultStatsDays = 30
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+const defaultBlocklistReloadInterval = 30 * time.Second
+const defaultScreeningCacheSize = 10000
+const defaultScreeningCacheTTL = time.Hour
+const defaultCacheSize = 10000
+const defaultLoginHistoryLimit = 50
+const maxLoginHistoryLimit = 200
+const defaultCacheTTL = 10 * time.Minute
+const defaultCacheLocalTTL = 30 * time.Second
+const defaultCacheNegativeTTL = 30 * time.Second
+const maxBulkUploadBytes = 10 << 20
+const defaultTOTPIssuer = "DCUBE"
+const defaultUserSearchLimit = 50
+const maxUserSearchLimit = 200
+const maxAuditLimit = 200
+const defaultQRCacheSize = 1000
+const defaultQRCacheTTL = 24 * time.Hour
+const defaultWebhookDispatchInterval = 5 * time.Second
+const defaultAuditRetryInterval = 30 * time.Second
+const defaultAccountDeletionRetryInterval = 5 * time.Minute
+const accountDeletionBatchSize = 100
+const defaultShutdownTimeout = 30 * time.Second
+const defaultWebhookTimeout = 10 * time.Second
+const defaultWebhookMaxAttempts = 8
+const defaultWebhookRetryDelay = time.Minute
+const defaultWebhookMaxRetryDelay = 6 * time.Hour
+const maxWebhookDeliveryLimit = 200
+
+// redirectModeJSON restores the legacy behaviour of answering /r/{url} with a
+// JSON body instead of a Location redirect.
+const redirectModeJSON = "json"
+
 var userManager user.UserManager
 var urlShortenerManager urlshortener.URLShortenerManager
+var analyticsManager analytics.AnalyticsManager
+var sessionManager session.SessionManager
+var workspaceManager workspace.WorkspaceManager
+var apiKeyManager apikey.APIKeyManager
+var auditManager audit.AuditManager
+var qrCodeManager qrcode.QRCodeManager
+var webhookManager webhook.WebhookManager
+
+// blocklist is nil unless BLOCKLIST_PATH is set.
+var blocklist *screening.Blocklist
+
+// urlCache is the in-process tier of the redirect cache. sharedURLCache is
+// its Redis tier and is nil unless REDIS_URL is set.
+var urlCache *cache.LRU
+var sharedURLCache *cache.Redis
+
+// rateLimitStore is shared through Redis when REDIS_URL is set so that limits
+// hold across instances.
+var rateLimitStore ratelimit.Store
+
+// database, urlRepository and newLinkManager let membershipTransaction build
+// managers whose writes all go through one transaction.
+var database *gorm.DB
+var urlRepository *urlshortener.CachedRepository
+var newLinkManager func(
+	urlshortener.Repository,
+	urlshortener.Permissions,
+	urlshortener.Purger,
+) urlshortener.URLShortenerManager
+
+// shortLinkBaseURL is the public address short links are served from, without
+// a trailing slash.
+var shortLinkBaseURL string
 
 type Application struct {
 	router *mux.Router
@@ -30,6 +119,7 @@ func (app *Application) InitApp(db *gorm.DB) {
 	app.initManagers(db)
 	app.router = mux.NewRouter()
 	app.initRoutes()
+	urlshortener.ReserveAliases(topLevelSegments(app.router)...)
 }
 
 func (app *Application) Run() {
@@ -41,11 +131,98 @@ func (app *Application) Run() {
 		"Authorization",
 		"Accept",
 	})
-	methods := handlers.AllowedMethods([]string{http.MethodGet, http.MethodPost, http.MethodDelete})
+	methods := handlers.AllowedMethods([]string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete})
 	origins := handlers.AllowedOrigins([]string{os.Getenv("FRONTEND_URL")})
 	exposedHeaders := handlers.ExposedHeaders([]string{"Authorization"})
 	url := fmt.Sprintf("%s:%s", os.Getenv("HOST"), os.Getenv("PORT"))
-	log.Fatal(http.ListenAndServe(url, handlers.CORS(credentials, headers, methods, origins, exposedHeaders)(app.router)))
+	stop := make(chan struct{})
+
+	go urlshortener.RunExpirySweeper(
+		urlShortenerManager,
+		getDurationEnv("EXPIRY_SWEEP_INTERVAL", defaultSweepInterval),
+		stop,
+	)
+	go urlshortener.RunTrashPurger(
+		urlShortenerManager,
+		getDurationEnv("TRASH_PURGE_INTERVAL", defaultTrashPurgeInterval),
+		stop,
+	)
+
+	go webhook.RunDispatcher(
+		webhookManager,
+		getDurationEnv("WEBHOOK_DISPATCH_INTERVAL", defaultWebhookDispatchInterval),
+		stop,
+	)
+
+	go audit.RunRetrier(auditManager, getDurationEnv("AUDIT_RETRY_INTERVAL", defaultAuditRetryInterval), stop)
+	go app.RunAccountDeleter(
+		getDurationEnv("ACCOUNT_DELETION_RETRY_INTERVAL", defaultAccountDeletionRetryInterval),
+		stop,
+	)
+
+	if blocklist != nil {
+		go blocklist.Watch(getDurationEnv("BLOCKLIST_RELOAD_INTERVAL", defaultBlocklistReloadInterval), stop)
+	}
+
+	if sharedURLCache != nil {
+		go sharedURLCache.ListenForInvalidations(urlCache, stop)
+	}
+
+	server := &http.Server{
+		Addr:    url,
+		Handler: handlers.CORS(credentials, headers, methods, origins, exposedHeaders)(app.router),
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, requests in flight are allowed to finish before
+	// the buffered clicks they recorded are written out.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	log.Println("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), getDurationEnv("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %s", err)
+	}
+
+	close(stop)
+	analyticsManager.Close()
+}
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func getIntEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+
+	if err != nil || value <= 0 {
+		return fallback
+	}
+
+	return value
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(key))
+
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+
+	return duration
 }
 
 func (app *Application) SignIn(w http.ResponseWriter, r *http.Request) {
@@ -59,6 +236,8 @@ func (app *Application) SignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	signInRequest.IP = utils.GetClientIP(r)
+	signInRequest.UserAgent = r.UserAgent()
 	resp, err := userManager.SignIn(signInRequest)
 
 	if err != nil {
@@ -66,16 +245,158 @@ func (app *Application) SignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newToken, e := session.GenerateToken(resp.User.ID)
+	if resp.MFARequired {
+		mfaToken, e := session.GenerateMFAToken(resp.User.ID)
+
+		if e != nil {
+			app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while signing in"))
+			return
+		}
+
+		payload := struct {
+			*user.Response
+			MFAToken          string    `json:"mfa_token"`
+			MFATokenExpiresAt time.Time `json:"mfa_token_expires_at"`
+		}{resp, mfaToken.TokenString, mfaToken.ExpirationTime}
+
+		app.respondWithJSON(w, http.StatusOK, "Two-factor authentication code required", payload)
+		return
+	}
+
+	app.startSession(w, r, resp)
+}
+
+// SignInSecondFactor exchanges the token handed out by SignIn and a TOTP or
+// recovery code for a full session.
+func (app *Application) SignInSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var secondFactorRequest user.SecondFactorRequest
+	json.NewDecoder(r.Body).Decode(&secondFactorRequest)
+
+	err := app.validateParams(secondFactorRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	userID, e := session.VerifyMFAToken(secondFactorRequest.MFAToken)
 
 	if e != nil {
-		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, e.Error()))
+		app.respondWithError(w, dcubeerrs.New(http.StatusUnauthorized, "Invalid or expired sign-in token"))
+		return
+	}
+
+	secondFactorRequest.UserID = userID
+	secondFactorRequest.IP = utils.GetClientIP(r)
+	secondFactorRequest.UserAgent = r.UserAgent()
+	resp, err := userManager.VerifySecondFactor(secondFactorRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.startSession(w, r, resp)
+}
+
+func (app *Application) startSession(w http.ResponseWriter, r *http.Request, resp *user.Response) {
+	tokens, err := sessionManager.CreateSession(resp.User.ID)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		ActorID:    &resp.User.ID,
+		Action:     audit.ActionSignIn,
+		TargetType: audit.TargetUser,
+		TargetID:   resp.User.ID,
+	})
+
+	w.Header().Add("Authorization", tokens.AccessToken.TokenString)
+
+	payload := struct {
+		*user.Response
+		*session.TokenResponse
+	}{resp, tokens}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully signed in!", payload)
+}
+
+func (app *Application) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refreshRequest session.RefreshRequest
+	json.NewDecoder(r.Body).Decode(&refreshRequest)
+
+	err := app.validateParams(refreshRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := sessionManager.Refresh(refreshRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	w.Header().Add("Authorization", resp.AccessToken.TokenString)
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully refreshed session!", resp)
+}
+
+func (app *Application) SignOut(w http.ResponseWriter, r *http.Request) {
+	signOutRequest, ok := app.signOutRequest(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := sessionManager.SignOut(signOutRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully signed out!", nil)
+}
+
+func (app *Application) SignOutAll(w http.ResponseWriter, r *http.Request) {
+	signOutRequest, ok := app.signOutRequest(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := sessionManager.SignOutAll(signOutRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
 		return
 	}
 
-	w.Header().Add("Authorization", newToken.TokenString)
+	app.respondWithJSON(w, http.StatusOK, "Successfully signed out of all sessions!", nil)
+}
+
+func (app *Application) signOutRequest(w http.ResponseWriter, r *http.Request) (session.SignOutRequest, bool) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return session.SignOutRequest{}, false
+	}
+
+	sessionID, ok := r.Context().Value("session_id").(string)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid session id"))
+		return session.SignOutRequest{}, false
+	}
 
-	app.respondWithJSON(w, http.StatusOK, "Successfully signed in!", resp)
+	return session.SignOutRequest{UserID: userID, SessionID: sessionID}, true
 }
 
 func (app *Application) SignUp(w http.ResponseWriter, r *http.Request) {
@@ -96,10 +417,20 @@ func (app *Application) SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.recordAudit(r, audit.RecordRequest{
+		ActorID:    &resp.User.ID,
+		Action:     audit.ActionSignUp,
+		TargetType: audit.TargetUser,
+		TargetID:   resp.User.ID,
+		After:      resp.User,
+	})
+
 	app.respondWithJSON(w, http.StatusCreated, "Successfully signed up!", resp)
 }
 
-func (app *Application) GetURLs(w http.ResponseWriter, r *http.Request) {
+// ChangePassword signs the user out of every session, including the current
+// one, and returns tokens for a fresh session.
+func (app *Application) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("user_id").(uint)
 
 	if !ok {
@@ -107,135 +438,2678 @@ func (app *Application) GetURLs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	getRequest := urlshortener.GetRequest{UserID: userID}
-	resp, err := urlShortenerManager.GetURL(getRequest)
+	var changeRequest user.ChangePasswordRequest
+	json.NewDecoder(r.Body).Decode(&changeRequest)
+
+	err := app.validateParams(changeRequest)
 
 	if err != nil {
 		app.respondWithError(w, err)
 		return
 	}
 
-	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved shortened URLs!", resp)
+	changeRequest.UserID = userID
+	changeRequest.IP = utils.GetClientIP(r)
+	err = userManager.ChangePassword(changeRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionPasswordChange,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+
+	err = sessionManager.SignOutAll(session.SignOutRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	tokens, err := sessionManager.CreateSession(userID)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	w.Header().Set("Authorization", tokens.AccessToken.TokenString)
+	app.respondWithJSON(w, http.StatusOK, "Successfully changed password!", tokens)
 }
 
-func (app *Application) CreateURL(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(uint)
+func (app *Application) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var resetRequest user.PasswordResetRequest
+	json.NewDecoder(r.Body).Decode(&resetRequest)
 
-	if !ok {
-		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+	err := app.validateParams(resetRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
 		return
 	}
 
-	var createRequest urlshortener.CreateRequest
-	json.NewDecoder(r.Body).Decode(&createRequest)
+	err = userManager.RequestPasswordReset(resetRequest)
 
-	err := app.validateParams(createRequest)
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusAccepted, "If the account exists, a password reset has been sent", nil)
+}
+
+func (app *Application) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetRequest user.ResetPasswordRequest
+	json.NewDecoder(r.Body).Decode(&resetRequest)
+
+	err := app.validateParams(resetRequest)
 
 	if err != nil {
 		app.respondWithError(w, err)
 		return
 	}
 
-	createRequest.UserID = userID
-	resp, err := urlShortenerManager.CreateURL(createRequest)
+	resp, err := userManager.ResetPassword(resetRequest)
 
 	if err != nil {
 		app.respondWithError(w, err)
 		return
 	}
 
-	app.respondWithJSON(w, http.StatusCreated, "Successfully shortened URL!", resp)
+	app.recordAudit(r, audit.RecordRequest{
+		ActorID:    &resp.User.ID,
+		Action:     audit.ActionPasswordReset,
+		TargetType: audit.TargetUser,
+		TargetID:   resp.User.ID,
+	})
+
+	err = sessionManager.SignOutAll(session.SignOutRequest{UserID: resp.User.ID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully reset password!", nil)
 }
 
-func (app *Application) DeleteURL(w http.ResponseWriter, r *http.Request) {
+func (app *Application) GetProfile(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("user_id").(uint)
 
 	if !ok {
 		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
 	}
 
-	params := mux.Vars(r)
-	urlID, ok := params["id"]
+	resp, err := userManager.GetProfile(user.ProfileRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved profile!", resp)
+}
+
+func (app *Application) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
 
 	if !ok {
-		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "Missing URL ID"))
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
 		return
 	}
 
-	u64, e := strconv.ParseUint(urlID, 10, 64)
+	var updateRequest user.UpdateProfileRequest
+	json.NewDecoder(r.Body).Decode(&updateRequest)
 
-	if e != nil {
-		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "ID is not an unsigned integer"))
+	err := app.validateParams(updateRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
 		return
 	}
 
-	var deleteRequest urlshortener.DeleteRequest
-	deleteRequest.UserID = userID
-	deleteRequest.ID = uint(u64)
+	previous, err := userManager.GetProfile(user.ProfileRequest{UserID: userID})
 
-	resp, err := urlShortenerManager.DeleteURL(deleteRequest)
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	updateRequest.UserID = userID
+	resp, err := userManager.UpdateProfile(updateRequest)
 
 	if err != nil {
 		app.respondWithError(w, err)
 		return
 	}
 
-	app.respondWithJSON(w, http.StatusOK, "Successfully deleted URL!", resp)
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionProfileUpdate,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Before:     previous.User,
+		After:      resp.User,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully updated profile!", resp)
 }
 
-func (app *Application) Redirect(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	url, ok := params["url"]
+// DeleteAccount deletes the user's links and their clicks, sessions, API keys
+// and account after checking their password. Links the user created in a
+// workspace stay there and are handed over to another owner, except in
+// workspaces the user was the only member of, which are deleted too. The
+// account is marked first, so that a deletion that fails part-way is
+// finished by the account deleter.
+func (app *Application) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
 
 	if !ok {
-		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "Missing URL"))
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
 		return
 	}
 
-	var redirectRequest urlshortener.RedirectRequest
-	redirectRequest.URL = url
+	var confirmRequest user.ConfirmPasswordRequest
+	json.NewDecoder(r.Body).Decode(&confirmRequest)
 
-	resp, err := urlShortenerManager.Redirect(redirectRequest)
+	err := app.validateParams(confirmRequest)
 
 	if err != nil {
 		app.respondWithError(w, err)
 		return
 	}
 
-	app.respondWithJSON(w, http.StatusOK, "Redirecting...", resp)
-}
+	confirmRequest.UserID = userID
+	confirmRequest.IP = utils.GetClientIP(r)
+	err = userManager.ConfirmPassword(confirmRequest)
 
-func (app *Application) initManagers(db *gorm.DB) {
-	userManager = user.NewUserManager(db)
-	urlShortenerManager = urlshortener.NewURLShortenerManager(db)
-}
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
 
-func (app *Application) initRoutes() {
-	app.router.Use(commonMiddleware)
-	app.router.HandleFunc("/signin", app.SignIn).Methods(http.MethodPost)
-	app.router.HandleFunc("/signup", app.SignUp).Methods(http.MethodPost)
-	app.router.HandleFunc("/r/{url}", app.Redirect).Methods(http.MethodGet)
+	err = userManager.StartDeletion(user.DeleteAccountRequest{UserID: userID})
 
-	api := app.router.PathPrefix("/url").Subrouter()
-	api.Use(tokenValidatorMiddleware)
-	api.Use(setAuthHeaderMiddleware)
-	api.HandleFunc("", app.GetURLs).Methods(http.MethodGet)
-	api.HandleFunc("", app.CreateURL).Methods(http.MethodPost)
-	api.HandleFunc("/{id}", app.DeleteURL).Methods(http.MethodDelete)
-}
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
 
-func (app *Application) validateParams(s interface{}) dcubeerrs.Error {
-	validate := validator.New()
-	err := validate.Struct(s)
+	previous, resp, err := app.deleteAccount(userID)
 
 	if err != nil {
-		return dcubeerrs.New(http.StatusBadRequest, err.Error())
+		log.Printf("Error deleting account %d, to be retried: %s", userID, err.Message())
+		app.respondWithError(w, dcubeerrs.New(
+			http.StatusInternalServerError,
+			"Account deletion could not be completed and will be retried",
+		))
+		return
 	}
-	return nil
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionAccountDelete,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Before:     previous,
+		Redact:     true,
+	})
+
+	w.Header().Del("Authorization")
+	app.respondWithJSON(w, http.StatusOK, "Successfully deleted account!", resp)
 }
 
-func (app *Application) respondWithError(w http.ResponseWriter, err dcubeerrs.Error) {
-	app.respondWithJSON(w, err.StatusCode(), err.Message(), map[string]string{"error": err.Message()})
+// deleteAccount deletes everything that belongs to an account whose deletion
+// has started, and then the account itself, returning the account as it was.
+// Every step can be repeated, so an interrupted deletion is finished by
+// running it again.
+func (app *Application) deleteAccount(
+	userID uint,
+) (*user.User, *urlshortener.DeleteAllResponse, dcubeerrs.Error) {
+	previous, err := userManager.GetProfile(user.ProfileRequest{UserID: userID})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = webhookManager.DeleteAllSubscriptions(webhook.DeleteAllRequest{UserID: userID})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Buffered clicks are written first so that they are deleted with the links.
+	analyticsManager.Flush()
+
+	var resp *urlshortener.DeleteAllResponse
+
+	err = membershipTransaction(func(
+		workspaces workspace.WorkspaceManager,
+		links urlshortener.URLShortenerManager,
+	) dcubeerrs.Error {
+		left, e := workspaces.LeaveAll(workspace.LeaveAllRequest{UserID: userID})
+
+		if e != nil {
+			return e
+		}
+
+		for workspaceID, successor := range left.Successors {
+			_, e = links.TransferURLs(urlshortener.TransferRequest{
+				UserID:      userID,
+				WorkspaceID: workspaceID,
+				ToUserID:    successor,
+			})
+
+			if e != nil {
+				return e
+			}
+		}
+
+		resp, e = links.DeleteAllURLs(urlshortener.DeleteAllRequest{
+			UserID:       userID,
+			WorkspaceIDs: left.Deleted,
+		})
+
+		return e
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = sessionManager.SignOutAll(session.SignOutRequest{UserID: userID})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = apiKeyManager.DeleteAllKeys(apikey.DeleteAllRequest{UserID: userID})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Earlier entries about the account keep its personal details in their
+	// snapshots, which must not outlive it.
+	err = auditManager.Redact(audit.RedactRequest{UserID: userID})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = userManager.DeleteAccount(user.DeleteAccountRequest{UserID: userID})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &previous.User, resp, nil
+}
+
+// ResumeAccountDeletions finishes the deletions of accounts that started
+// before startedBefore and were interrupted, and returns how many it finished.
+func (app *Application) ResumeAccountDeletions(startedBefore time.Time) (int, dcubeerrs.Error) {
+	pending, err := userManager.PendingDeletions(user.PendingDeletionsRequest{
+		StartedBefore: startedBefore,
+		Limit:         accountDeletionBatchSize,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	finished := 0
+
+	for _, userID := range pending.UserIDs {
+		previous, _, err := app.deleteAccount(userID)
+
+		if err != nil {
+			log.Printf("Error resuming deletion of account %d: %s", userID, err.Message())
+			continue
+		}
+
+		actorID := userID
+		err = auditManager.Record(audit.RecordRequest{
+			ActorID:    &actorID,
+			Action:     audit.ActionAccountDelete,
+			TargetType: audit.TargetUser,
+			TargetID:   userID,
+			Before:     previous,
+			Redact:     true,
+		})
+
+		if err != nil {
+			log.Printf("Error recording deletion of account %d, queued for retry: %s", userID, err.Message())
+		}
+
+		finished++
+	}
+
+	return finished, nil
+}
+
+// RunAccountDeleter periodically finishes interrupted account deletions. A
+// deletion is only picked up once it has been running for an interval, so
+// that one still in progress is left alone. It blocks until stop is closed.
+func (app *Application) RunAccountDeleter(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			finished, err := app.ResumeAccountDeletions(now.Add(-interval))
+			if finished > 0 {
+				log.Printf("account deleter: finished %d account deletions", finished)
+			}
+			if err != nil {
+				log.Printf("account deleter: %s", err.Message())
+			}
+		}
+	}
+}
+
+// ExportAccount returns everything stored about the user as JSON, or as a ZIP
+// archive of JSON files with ?format=zip.
+func (app *Application) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+
+	if format != "" && format != exportFormatJSON && format != exportFormatZIP {
+		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "format must be json or zip"))
+		return
+	}
+
+	account, err := userManager.ExportAccount(user.ExportRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	links, err := urlShortenerManager.ExportURLs(urlshortener.ExportRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	clicks, err := analyticsManager.ExportClicks(analytics.ExportRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	export := accountExport{
+		ExportedAt: time.Now().UTC(),
+		User:       account.User,
+		Logins:     account.Logins,
+		URLs:       links.URLs,
+		Clicks:     clicks.Clicks,
+	}
+
+	if format != exportFormatZIP {
+		app.respondWithJSON(w, http.StatusOK, "Successfully exported account!", export)
+		return
+	}
+
+	archive, e := export.zip()
+
+	if e != nil {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while exporting account"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="dcube-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+func (app *Application) GetLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	historyRequest := user.LoginHistoryRequest{UserID: userID, Limit: defaultLoginHistoryLimit}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		value, e := strconv.Atoi(limit)
+
+		if e != nil || value < 1 || value > maxLoginHistoryLimit {
+			app.respondWithError(w, dcubeerrs.New(
+				http.StatusBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxLoginHistoryLimit),
+			))
+			return
+		}
+
+		historyRequest.Limit = value
+	}
+
+	resp, err := userManager.GetLoginHistory(historyRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved login history!", resp)
+}
+
+func (app *Application) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	resp, err := userManager.EnrollTwoFactor(user.EnrollTwoFactorRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Scan the code and confirm it to enable two-factor authentication", resp)
+}
+
+func (app *Application) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	var confirmRequest user.TwoFactorRequest
+	json.NewDecoder(r.Body).Decode(&confirmRequest)
+
+	err := app.validateParams(confirmRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	confirmRequest.UserID = userID
+	resp, err := userManager.ConfirmTwoFactor(confirmRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionTwoFactorOn,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully enabled two-factor authentication!", resp)
+}
+
+func (app *Application) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	var disableRequest user.TwoFactorRequest
+	json.NewDecoder(r.Body).Decode(&disableRequest)
+
+	err := app.validateParams(disableRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	disableRequest.UserID = userID
+	err = userManager.DisableTwoFactor(disableRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionTwoFactorOff,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully disabled two-factor authentication!", nil)
+}
+
+func (app *Application) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	resp, err := apiKeyManager.ListKeys(apikey.ListRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved api keys!", resp)
+}
+
+// CreateAPIKey returns the new key's secret. It is not shown again.
+func (app *Application) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	var createRequest apikey.CreateRequest
+	json.NewDecoder(r.Body).Decode(&createRequest)
+
+	err := app.validateParams(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	createRequest.UserID = userID
+	resp, err := apiKeyManager.CreateKey(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionKeyCreate,
+		TargetType: audit.TargetAPIKey,
+		TargetID:   resp.Key.ID,
+		After:      resp.Key,
+	})
+
+	app.respondWithJSON(w, http.StatusCreated, "Successfully created api key!", resp)
+}
+
+func (app *Application) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	keyID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	err = apiKeyManager.RevokeKey(apikey.RevokeRequest{UserID: userID, ID: keyID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionKeyRevoke,
+		TargetType: audit.TargetAPIKey,
+		TargetID:   keyID,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully revoked api key!", nil)
+}
+
+// GetAuditTrail returns the audit log entries made by the user or about their
+// account, newest first.
+func (app *Application) GetAuditTrail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	listRequest, err := parseAuditListRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	listRequest.SubjectID = &userID
+	resp, err := auditManager.List(listRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved audit trail!", resp)
+}
+
+// parseAuditListRequest reads the limit, before and action query parameters.
+func parseAuditListRequest(query url.Values) (audit.ListRequest, dcubeerrs.Error) {
+	listRequest := audit.ListRequest{Action: query.Get("action")}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, e := strconv.Atoi(limit)
+
+		if e != nil || value < 1 || value > maxAuditLimit {
+			return listRequest, dcubeerrs.New(
+				http.StatusBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit),
+			)
+		}
+
+		listRequest.Limit = value
+	}
+
+	if before := query.Get("before"); before != "" {
+		u64, e := strconv.ParseUint(before, 10, 64)
+
+		if e != nil {
+			return listRequest, dcubeerrs.New(http.StatusBadRequest, "before is not an unsigned integer")
+		}
+
+		listRequest.BeforeID = uint(u64)
+	}
+
+	return listRequest, nil
+}
+
+func (app *Application) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	resp, err := webhookManager.GetSubscriptions(webhook.ListRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved webhooks!", resp)
+}
+
+// CreateWebhook returns the new webhook's signing secret. It is not shown
+// again.
+func (app *Application) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	var createRequest webhook.CreateRequest
+	json.NewDecoder(r.Body).Decode(&createRequest)
+
+	err := app.validateParams(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	createRequest.UserID = userID
+	resp, err := webhookManager.CreateSubscription(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionWebhookCreate,
+		TargetType: audit.TargetWebhook,
+		TargetID:   resp.Subscription.ID,
+		After:      resp.Subscription,
+	})
+
+	app.respondWithJSON(w, http.StatusCreated, "Successfully created webhook!", resp)
+}
+
+// DeleteWebhook removes the webhook together with its delivery log, including
+// deliveries that are still queued.
+func (app *Application) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	subscriptionID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := webhookManager.DeleteSubscription(webhook.DeleteRequest{UserID: userID, ID: subscriptionID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionWebhookDelete,
+		TargetType: audit.TargetWebhook,
+		TargetID:   subscriptionID,
+		Before:     resp.Subscription,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully deleted webhook!", resp)
+}
+
+// GetWebhookDeliveries returns the webhook's delivery log, newest first. It
+// takes the limit, before and status query parameters.
+func (app *Application) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	subscriptionID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	deliveriesRequest, err := parseDeliveriesRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	err = app.validateParams(deliveriesRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	deliveriesRequest.UserID = userID
+	deliveriesRequest.SubscriptionID = subscriptionID
+	resp, err := webhookManager.GetDeliveries(deliveriesRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved webhook deliveries!", resp)
+}
+
+// GetWebhookDeadLetters returns the deliveries of all the user's webhooks
+// that failed on every attempt, newest first. It takes the limit and before
+// query parameters.
+func (app *Application) GetWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	deliveriesRequest, err := parseDeliveriesRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	deliveriesRequest.UserID = userID
+	deliveriesRequest.Status = webhook.StatusDead
+	resp, err := webhookManager.GetDeliveries(deliveriesRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved webhook dead letters!", resp)
+}
+
+// parseDeliveriesRequest reads the limit, before and status query parameters.
+func parseDeliveriesRequest(query url.Values) (webhook.DeliveriesRequest, dcubeerrs.Error) {
+	deliveriesRequest := webhook.DeliveriesRequest{Status: query.Get("status")}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, e := strconv.Atoi(limit)
+
+		if e != nil || value < 1 || value > maxWebhookDeliveryLimit {
+			return deliveriesRequest, dcubeerrs.New(
+				http.StatusBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveryLimit),
+			)
+		}
+
+		deliveriesRequest.Limit = value
+	}
+
+	if before := query.Get("before"); before != "" {
+		u64, e := strconv.ParseUint(before, 10, 64)
+
+		if e != nil {
+			return deliveriesRequest, dcubeerrs.New(http.StatusBadRequest, "before is not an unsigned integer")
+		}
+
+		deliveriesRequest.BeforeID = uint(u64)
+	}
+
+	return deliveriesRequest, nil
+}
+
+// RedeliverWebhook queues a finished delivery again with a fresh set of
+// attempts.
+func (app *Application) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	deliveryID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := webhookManager.Redeliver(webhook.RedeliverRequest{UserID: userID, ID: deliveryID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully queued webhook delivery!", resp)
+}
+
+func (app *Application) GetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	resp, err := workspaceManager.ListWorkspaces(workspace.ListRequest{UserID: userID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved workspaces!", resp)
+}
+
+func (app *Application) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	var createRequest workspace.CreateRequest
+	json.NewDecoder(r.Body).Decode(&createRequest)
+
+	err := app.validateParams(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	createRequest.UserID = userID
+	resp, err := workspaceManager.CreateWorkspace(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusCreated, "Successfully created workspace!", resp)
+}
+
+func (app *Application) GetWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	workspaceID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := workspaceManager.GetMembers(workspace.MembersRequest{UserID: userID, WorkspaceID: workspaceID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved workspace members!", resp)
+}
+
+func (app *Application) AddWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	workspaceID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	var addRequest workspace.AddMemberRequest
+	json.NewDecoder(r.Body).Decode(&addRequest)
+
+	err = app.validateParams(addRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	addRequest.UserID = userID
+	addRequest.WorkspaceID = workspaceID
+	resp, err := workspaceManager.AddMember(addRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusCreated, "Successfully added workspace member!", resp)
+}
+
+func (app *Application) UpdateWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	workspaceID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	var updateRequest workspace.UpdateMemberRequest
+	json.NewDecoder(r.Body).Decode(&updateRequest)
+
+	err = app.validateParams(updateRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	updateRequest.UserID = userID
+	updateRequest.WorkspaceID = workspaceID
+	updateRequest.Username = mux.Vars(r)["username"]
+	resp, err := workspaceManager.UpdateMember(updateRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully updated workspace member!", resp)
+}
+
+// RemoveWorkspaceMember removes a member from a workspace. Links they created
+// there stay in the workspace and are handed over to an owner.
+func (app *Application) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	workspaceID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	removeRequest := workspace.RemoveMemberRequest{
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		Username:    mux.Vars(r)["username"],
+	}
+	var resp *urlshortener.TransferResponse
+
+	err = membershipTransaction(func(
+		workspaces workspace.WorkspaceManager,
+		links urlshortener.URLShortenerManager,
+	) dcubeerrs.Error {
+		removed, e := workspaces.RemoveMember(removeRequest)
+
+		if e != nil {
+			return e
+		}
+
+		resp, e = links.TransferURLs(urlshortener.TransferRequest{
+			UserID:      removed.RemovedUserID,
+			WorkspaceID: workspaceID,
+			ToUserID:    removed.Successor,
+		})
+
+		return e
+	})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully removed workspace member!", resp)
+}
+
+func (app *Application) GetURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	getRequest, err := parseGetRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	getRequest.UserID = userID
+	err = app.validateParams(getRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := urlShortenerManager.GetURL(getRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved shortened URLs!", resp)
+}
+
+// GetTrash lists the user's links in the trash, taking the same query
+// parameters as GetURLs except state.
+func (app *Application) GetTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	getRequest, err := parseGetRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	getRequest.UserID = userID
+	err = app.validateParams(getRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	getRequest.State = urlshortener.StateTrashed
+	resp, err := urlShortenerManager.GetURL(getRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved trashed URLs!", resp)
+}
+
+func parseGetRequest(query url.Values) (urlshortener.GetRequest, dcubeerrs.Error) {
+	getRequest := urlshortener.GetRequest{
+		State:  query.Get("state"),
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+		Query:  query.Get("q"),
+		Tag:    query.Get("tag"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, e := strconv.Atoi(limit)
+
+		if e != nil {
+			return getRequest, dcubeerrs.New(http.StatusBadRequest, "Limit is not an integer")
+		}
+
+		getRequest.Limit = n
+	}
+
+	if workspaceID := query.Get("workspace"); workspaceID != "" {
+		u64, e := strconv.ParseUint(workspaceID, 10, 64)
+
+		if e != nil {
+			return getRequest, dcubeerrs.New(http.StatusBadRequest, "Workspace is not an unsigned integer")
+		}
+
+		id := uint(u64)
+		getRequest.WorkspaceID = &id
+	}
+
+	for param, target := range map[string]**time.Time{
+		"created_from": &getRequest.CreatedFrom,
+		"created_to":   &getRequest.CreatedTo,
+	} {
+		if value := query.Get(param); value != "" {
+			t, e := time.Parse(time.RFC3339, value)
+
+			if e != nil {
+				return getRequest, dcubeerrs.New(http.StatusBadRequest, fmt.Sprintf("%s must be an RFC 3339 timestamp", param))
+			}
+
+			t = t.UTC()
+			*target = &t
+		}
+	}
+
+	return getRequest, nil
+}
+
+func (app *Application) CreateURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	var createRequest urlshortener.CreateRequest
+	json.NewDecoder(r.Body).Decode(&createRequest)
+
+	err := app.validateParams(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	createRequest.UserID = userID
+	err = app.applyLinkDefaults(userID, []*urlshortener.CreateRequest{&createRequest})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := urlShortenerManager.CreateURL(createRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionURLCreate,
+		TargetType: audit.TargetURL,
+		TargetID:   resp.ShortenedURL.ID,
+		After:      resp.ShortenedURL,
+	})
+
+	app.respondWithJSON(w, http.StatusCreated, "Successfully shortened URL!", resp)
+}
+
+func (app *Application) BulkCreateURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	bulkRequest := urlshortener.BulkCreateRequest{UserID: userID, Mode: r.URL.Query().Get("mode")}
+
+	if bulkRequest.Mode == "" {
+		bulkRequest.Mode = urlshortener.BulkModeAtomic
+	}
+
+	urls, e := parseBulkURLs(w, r)
+
+	if e != nil {
+		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "Invalid bulk upload: "+e.Error()))
+		return
+	}
+
+	bulkRequest.URLs = urls
+	err := app.validateParams(bulkRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	defaulted := make([]*urlshortener.CreateRequest, len(bulkRequest.URLs))
+	for i := range bulkRequest.URLs {
+		defaulted[i] = &bulkRequest.URLs[i]
+	}
+
+	err = app.applyLinkDefaults(userID, defaulted)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := urlShortenerManager.BulkCreateURL(bulkRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	for _, result := range resp.Results {
+		if result.ShortenedURL != nil {
+			app.recordAudit(r, audit.RecordRequest{
+				Action:     audit.ActionURLCreate,
+				TargetType: audit.TargetURL,
+				TargetID:   result.ShortenedURL.ID,
+				After:      result.ShortenedURL,
+			})
+		}
+	}
+
+	switch {
+	case resp.Failed == 0:
+		app.respondWithJSON(w, http.StatusCreated, "Successfully shortened URLs!", resp)
+	case bulkRequest.Mode == urlshortener.BulkModeAtomic:
+		app.respondWithJSON(w, http.StatusUnprocessableEntity, "No URLs were shortened", resp)
+	default:
+		app.respondWithJSON(w, http.StatusMultiStatus, "Some URLs could not be shortened", resp)
+	}
+}
+
+// applyLinkDefaults fills in the user's default redirect type and expiry on
+// links that do not set their own.
+func (app *Application) applyLinkDefaults(userID uint, requests []*urlshortener.CreateRequest) dcubeerrs.Error {
+	profile, err := userManager.GetProfile(user.ProfileRequest{UserID: userID})
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	for _, req := range requests {
+		if req.RedirectType == "" {
+			req.RedirectType = profile.User.DefaultRedirectType
+		}
+		if req.ExpiresAt == nil && profile.User.DefaultExpiryDays > 0 {
+			expiresAt := now.AddDate(0, 0, int(profile.User.DefaultExpiryDays))
+			req.ExpiresAt = &expiresAt
+		}
+	}
+
+	return nil
+}
+
+// parseBulkURLs reads bulk create rows from a JSON array body, a text/csv body
+// or a CSV file uploaded as the "file" field of a multipart form.
+func parseBulkURLs(w http.ResponseWriter, r *http.Request) ([]urlshortener.CreateRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkUploadBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "text/csv":
+		return urlshortener.ParseCSV(r.Body)
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return urlshortener.ParseCSV(file)
+	default:
+		var urls []urlshortener.CreateRequest
+		err := json.NewDecoder(r.Body).Decode(&urls)
+		return urls, err
+	}
+}
+
+func (app *Application) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	urlID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	var updateRequest urlshortener.UpdateRequest
+	json.NewDecoder(r.Body).Decode(&updateRequest)
+
+	err = app.validateParams(updateRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	updateRequest.UserID = userID
+	updateRequest.ID = urlID
+	resp, err := urlShortenerManager.UpdateURL(updateRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionURLUpdate,
+		TargetType: audit.TargetURL,
+		TargetID:   urlID,
+		Before:     resp.Previous,
+		After:      resp.ShortenedURL,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully updated URL!", resp)
+}
+
+func (app *Application) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	urlID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := urlShortenerManager.GetRevisions(urlshortener.GetRevisionsRequest{UserID: userID, ID: urlID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved URL revisions!", resp)
+}
+
+func (app *Application) RollbackURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	urlID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	revisionID, err := parseUintParam(r, "revision")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	rollbackRequest := urlshortener.RollbackRequest{UserID: userID, ID: urlID, RevisionID: revisionID}
+	resp, err := urlShortenerManager.RollbackURL(rollbackRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionURLRollback,
+		TargetType: audit.TargetURL,
+		TargetID:   urlID,
+		Before:     resp.Previous,
+		After:      resp.ShortenedURL,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully rolled back URL!", resp)
+}
+
+func parseUintParam(r *http.Request, name string) (uint, dcubeerrs.Error) {
+	value, ok := mux.Vars(r)[name]
+
+	if !ok {
+		return 0, dcubeerrs.New(http.StatusBadRequest, fmt.Sprintf("Missing %s", name))
+	}
+
+	u64, e := strconv.ParseUint(value, 10, 64)
+
+	if e != nil {
+		return 0, dcubeerrs.New(http.StatusBadRequest, fmt.Sprintf("%s is not an unsigned integer", name))
+	}
+
+	return uint(u64), nil
+}
+
+func (app *Application) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+	}
+
+	params := mux.Vars(r)
+	urlID, ok := params["id"]
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "Missing URL ID"))
+		return
+	}
+
+	u64, e := strconv.ParseUint(urlID, 10, 64)
+
+	if e != nil {
+		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "ID is not an unsigned integer"))
+		return
+	}
+
+	var deleteRequest urlshortener.DeleteRequest
+	deleteRequest.UserID = userID
+	deleteRequest.ID = uint(u64)
+
+	resp, err := urlShortenerManager.DeleteURL(deleteRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionURLDelete,
+		TargetType: audit.TargetURL,
+		TargetID:   deleteRequest.ID,
+		Before:     resp.ShortenedURL,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully deleted URL!", resp)
+}
+
+func (app *Application) RestoreURL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	urlID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := urlShortenerManager.RestoreURL(urlshortener.RestoreRequest{UserID: userID, ID: urlID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionURLRestore,
+		TargetType: audit.TargetURL,
+		TargetID:   urlID,
+		After:      resp.ShortenedURL,
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully restored URL!", resp)
+}
+
+func (app *Application) GetURLStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	params := mux.Vars(r)
+	u64, e := strconv.ParseUint(params["id"], 10, 64)
+
+	if e != nil {
+		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "ID is not an unsigned integer"))
+		return
+	}
+
+	statsRequest := analytics.StatsRequest{UserID: userID, URLID: uint(u64), Days: defaultStatsDays}
+
+	if days := r.URL.Query().Get("days"); days != "" {
+		statsRequest.Days, e = strconv.Atoi(days)
+
+		if e != nil {
+			app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "Days is not an integer"))
+			return
+		}
+	}
+
+	err := app.validateParams(statsRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := analyticsManager.GetStats(statsRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved URL stats!", resp)
+}
+
+// GetURLQR renders the short link as a PNG or SVG QR code.
+func (app *Application) GetURLQR(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	urlID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	link, err := urlShortenerManager.FindURL(urlshortener.FindRequest{UserID: userID, ID: urlID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	renderRequest, err := parseRenderRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	renderRequest.LinkID = link.ShortenedURL.ID
+	renderRequest.Content = shortLinkURL(link.ShortenedURL.Shortened)
+	err = app.validateParams(renderRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := qrCodeManager.Render(renderRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", resp.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.Image)
+}
+
+func parseRenderRequest(query url.Values) (qrcode.RenderRequest, dcubeerrs.Error) {
+	renderRequest := qrcode.RenderRequest{
+		Format:     qrcode.FormatPNG,
+		Size:       qrcode.DefaultSize,
+		Level:      strings.ToUpper(query.Get("ecc")),
+		Margin:     qrcode.DefaultMargin,
+		Foreground: qrcode.DefaultForeground,
+		Background: qrcode.DefaultBackground,
+	}
+
+	if format := query.Get("format"); format != "" {
+		renderRequest.Format = format
+	}
+
+	for param, target := range map[string]*int{
+		"size":   &renderRequest.Size,
+		"margin": &renderRequest.Margin,
+	} {
+		if value := query.Get(param); value != "" {
+			n, e := strconv.Atoi(value)
+
+			if e != nil {
+				return renderRequest, dcubeerrs.New(http.StatusBadRequest, fmt.Sprintf("%s is not an integer", param))
+			}
+
+			*target = n
+		}
+	}
+
+	// Colours may be given with or without the leading # so that it need not
+	// be escaped in the query string.
+	for param, target := range map[string]*string{
+		"fg": &renderRequest.Foreground,
+		"bg": &renderRequest.Background,
+	} {
+		if value := query.Get(param); value != "" {
+			*target = "#" + strings.TrimPrefix(value, "#")
+		}
+	}
+
+	if logo := query.Get("logo"); logo != "" {
+		var e error
+		renderRequest.Logo, e = strconv.ParseBool(logo)
+
+		if e != nil {
+			return renderRequest, dcubeerrs.New(http.StatusBadRequest, "logo is not a boolean")
+		}
+	}
+
+	return renderRequest, nil
+}
+
+// Redirect sends the client on to the link's destination. HEAD requests,
+// which link previews and uptime checks send, are answered the same way but
+// not counted as clicks.
+func (app *Application) Redirect(w http.ResponseWriter, r *http.Request) {
+	resp, ok := app.resolve(w, r, r.Method != http.MethodHead)
+
+	if !ok {
+		return
+	}
+
+	if resp.Quarantined {
+		app.renderInterstitial(w, resp)
+		return
+	}
+
+	if os.Getenv("REDIRECT_MODE") == redirectModeJSON {
+		app.respondWithJSON(w, http.StatusOK, "Redirecting...", resp)
+		return
+	}
+
+	http.Redirect(w, r, resp.OriginalURL, resp.StatusCode)
+}
+
+// Lookup tells API clients where a link goes. It is not counted as a click.
+func (app *Application) Lookup(w http.ResponseWriter, r *http.Request) {
+	resp, ok := app.resolve(w, r, false)
+
+	if !ok {
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully resolved URL!", resp)
+}
+
+// resolve looks up the short code in the request path and, if click is set,
+// counts and records the click. It writes the error response itself and
+// returns false on failure.
+func (app *Application) resolve(
+	w http.ResponseWriter,
+	r *http.Request,
+	click bool,
+) (*urlshortener.RedirectResponse, bool) {
+	params := mux.Vars(r)
+	url, ok := params["url"]
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "Missing URL"))
+		return nil, false
+	}
+
+	var redirectRequest urlshortener.RedirectRequest
+	redirectRequest.URL = url
+
+	if !click {
+		resp, err := urlShortenerManager.Lookup(redirectRequest)
+
+		if err != nil {
+			app.respondWithError(w, err)
+			return nil, false
+		}
+
+		return resp, true
+	}
+
+	resp, err := urlShortenerManager.Redirect(redirectRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return nil, false
+	}
+
+	if resp.Quarantined {
+		return resp, true
+	}
+
+	analyticsManager.RecordClick(analytics.ClickRequest{
+		ShortenedURLID: resp.URLID,
+		Referrer:       r.Referer(),
+		UserAgent:      r.UserAgent(),
+		IP:             utils.GetClientIP(r),
+	})
+
+	return resp, true
+}
+
+// AdminGetStats returns system-wide counts of accounts and links.
+func (app *Application) AdminGetStats(w http.ResponseWriter, r *http.Request) {
+	users, err := userManager.GetStats()
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	links, err := urlShortenerManager.GetStats()
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved stats!", map[string]interface{}{
+		"users": users,
+		"links": links,
+	})
+}
+
+func (app *Application) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	searchRequest := user.SearchRequest{Query: r.URL.Query().Get("q"), Limit: defaultUserSearchLimit}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		value, e := strconv.Atoi(limit)
+
+		if e != nil || value < 1 || value > maxUserSearchLimit {
+			app.respondWithError(w, dcubeerrs.New(
+				http.StatusBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxUserSearchLimit),
+			))
+			return
+		}
+
+		searchRequest.Limit = value
+	}
+
+	resp, err := userManager.SearchUsers(searchRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved users!", resp)
+}
+
+// AdminUpdateUser changes an account's role or disables it. Disabling an
+// account also ends its sessions.
+func (app *Application) AdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	userID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	var updateRequest user.AdminUpdateRequest
+	json.NewDecoder(r.Body).Decode(&updateRequest)
+
+	err = app.validateParams(updateRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	updateRequest.AdminID = adminID
+	updateRequest.ID = userID
+	resp, err := userManager.UpdateAccount(updateRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionAdminUpdate,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Before:     resp.Previous,
+		After:      resp.User,
+	})
+
+	if resp.User.DisabledAt != nil {
+		err = sessionManager.SignOutAll(session.SignOutRequest{UserID: userID})
+
+		if err != nil {
+			app.respondWithError(w, err)
+			return
+		}
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully updated user!", resp)
+}
+
+// AdminSearchURLs lists links across all accounts, taking the same query
+// parameters as GetURLs plus user_id to narrow down to one account.
+func (app *Application) AdminSearchURLs(w http.ResponseWriter, r *http.Request) {
+	getRequest, err := parseGetRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		u64, e := strconv.ParseUint(userID, 10, 64)
+
+		if e != nil {
+			app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "user_id is not an unsigned integer"))
+			return
+		}
+
+		getRequest.UserID = uint(u64)
+	}
+
+	getRequest.AllUsers = true
+	err = app.validateParams(getRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	resp, err := urlShortenerManager.GetURL(getRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved shortened URLs!", resp)
+}
+
+// AdminModerateURL returns a handler that applies an administrator's action
+// to the link named in the path and records it in the audit log as
+// auditAction.
+func (app *Application) AdminModerateURL(
+	auditAction string,
+	action func(urlshortener.ModerateRequest) (*urlshortener.UpdateResponse, dcubeerrs.Error),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := r.Context().Value("user_id").(uint)
+
+		if !ok {
+			app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+			return
+		}
+
+		urlID, err := parseUintParam(r, "id")
+
+		if err != nil {
+			app.respondWithError(w, err)
+			return
+		}
+
+		var moderateRequest urlshortener.ModerateRequest
+		json.NewDecoder(r.Body).Decode(&moderateRequest)
+
+		err = app.validateParams(moderateRequest)
+
+		if err != nil {
+			app.respondWithError(w, err)
+			return
+		}
+
+		moderateRequest.AdminID = adminID
+		moderateRequest.ID = urlID
+		resp, err := action(moderateRequest)
+
+		if err != nil {
+			app.respondWithError(w, err)
+			return
+		}
+
+		app.recordAudit(r, audit.RecordRequest{
+			Action:     auditAction,
+			TargetType: audit.TargetURL,
+			TargetID:   urlID,
+			Before:     resp.Previous,
+			After:      resp.ShortenedURL,
+		})
+
+		app.respondWithJSON(w, http.StatusOK, "Successfully updated shortened URL!", resp)
+	}
+}
+
+func (app *Application) AdminTransferURL(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("user_id").(uint)
+
+	if !ok {
+		app.respondWithError(w, dcubeerrs.New(http.StatusInternalServerError, "Invalid user id"))
+		return
+	}
+
+	urlID, err := parseUintParam(r, "id")
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	var transferRequest urlshortener.AdminTransferRequest
+	json.NewDecoder(r.Body).Decode(&transferRequest)
+
+	err = app.validateParams(transferRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	_, err = userManager.GetProfile(user.ProfileRequest{UserID: transferRequest.ToUserID})
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	transferRequest.AdminID = adminID
+	transferRequest.ID = urlID
+	resp, err := urlShortenerManager.ReassignURL(transferRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	// Link snapshots leave out the owner, which is what changed here.
+	app.recordAudit(r, audit.RecordRequest{
+		Action:     audit.ActionURLTransfer,
+		TargetType: audit.TargetURL,
+		TargetID:   urlID,
+		Before:     map[string]interface{}{"user_id": resp.Previous.UserID, "workspace_id": resp.Previous.WorkspaceID},
+		After:      map[string]interface{}{"user_id": resp.ShortenedURL.UserID, "workspace_id": nil},
+	})
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully transferred shortened URL!", resp)
+}
+
+// AdminGetAuditLog returns the whole audit log, newest first, taking the same
+// query parameters as GetAuditTrail plus actor_id.
+func (app *Application) AdminGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	listRequest, err := parseAuditListRequest(r.URL.Query())
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	if actorID := r.URL.Query().Get("actor_id"); actorID != "" {
+		u64, e := strconv.ParseUint(actorID, 10, 64)
+
+		if e != nil {
+			app.respondWithError(w, dcubeerrs.New(http.StatusBadRequest, "actor_id is not an unsigned integer"))
+			return
+		}
+
+		id := uint(u64)
+		listRequest.ActorID = &id
+	}
+
+	resp, err := auditManager.List(listRequest)
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully retrieved audit log!", resp)
+}
+
+// AdminVerifyAuditLog checks that no audit log entry has been altered or
+// removed since it was written.
+func (app *Application) AdminVerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	resp, err := auditManager.Verify()
+
+	if err != nil {
+		app.respondWithError(w, err)
+		return
+	}
+
+	app.respondWithJSON(w, http.StatusOK, "Successfully verified audit log!", resp)
+}
+
+func (app *Application) initManagers(db *gorm.DB) {
+	userManager = user.NewUserManager(
+		user.NewGormRepository(db),
+		newPasswordPolicy(),
+		newPasswordResetNotifier(),
+		getEnv("TOTP_ISSUER", defaultTOTPIssuer),
+	)
+	workspaceManager = workspace.NewWorkspaceManager(workspace.NewGormRepository(db), user.NewGormRepository(db))
+	database = db
+	urlRepository = newURLRepository(db)
+	webhookManager = newWebhookManager(db)
+
+	destinations := urlshortener.NewDestinationValidator(shortLinkHosts())
+	screener := newScreener()
+	codes := newCodeGenerator()
+	trash := urlshortener.TrashPolicy{
+		Retention:      getDurationEnv("TRASH_RETENTION", defaultTrashRetention),
+		CodeReuseDelay: getDurationEnv("CODE_REUSE_DELAY", defaultCodeReuseDelay),
+	}
+	events := webhook.NewLinkEvents(webhookManager)
+	analyticsManager = analytics.NewAnalyticsManager(db, analyticsIPSalt(), workspaceManager)
+	newLinkManager = func(
+		repository urlshortener.Repository,
+		permissions urlshortener.Permissions,
+		purger urlshortener.Purger,
+	) urlshortener.URLShortenerManager {
+		return urlshortener.NewURLShortenerManager(
+			repository,
+			destinations,
+			screener,
+			codes,
+			permissions,
+			trash,
+			events,
+			purger,
+		)
+	}
+	urlShortenerManager = newLinkManager(urlRepository, workspaceManager, analyticsManager)
+	apiKeyManager = apikey.NewAPIKeyManager(apikey.NewGormRepository(db), user.NewGormRepository(db))
+	auditManager = audit.NewAuditManager(audit.NewGormRepository(db), auditKey(), auditAnchor())
+	qrCodeManager = newQRCodeManager()
+	shortLinkBaseURL = shortLinkBase()
+	rateLimitStore = newRateLimitStore()
+	sessionManager = session.NewSessionManager(db, getDurationEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL))
+	session.SetRevocationChecker(sessionManager)
+}
+
+// auditKey returns AUDIT_HMAC_KEY, which keys the audit log's hash chain so
+// that entries cannot be rewritten and rehashed without it.
+func auditKey() []byte {
+	key := os.Getenv("AUDIT_HMAC_KEY")
+
+	if key == "" {
+		log.Fatal("AUDIT_HMAC_KEY must be set to a secret key for the audit log")
+	}
+
+	return []byte(key)
+}
+
+// auditAnchor records the head of the audit log in AUDIT_ANCHOR_PATH, outside
+// the database, so that entries removed from the end of the log are noticed.
+func auditAnchor() audit.Anchor {
+	path := os.Getenv("AUDIT_ANCHOR_PATH")
+
+	if path == "" {
+		log.Fatal("AUDIT_ANCHOR_PATH must be set to a file outside the database")
+	}
+
+	return audit.NewFileAnchor(path)
+}
+
+// analyticsIPSalt returns ANALYTICS_IP_SALT. Without it, a random salt is
+// generated so that client addresses cannot be recovered from their hashes by
+// trying every address, at the cost of unique visitors not being recognised
+// across restarts or between instances.
+func analyticsIPSalt() []byte {
+	if salt := os.Getenv("ANALYTICS_IP_SALT"); salt != "" {
+		return []byte(salt)
+	}
+
+	salt := make([]byte, 32)
+
+	if _, err := rand.Read(salt); err != nil {
+		log.Fatalf("Error generating analytics IP salt: %s", err)
+	}
+
+	log.Print("ANALYTICS_IP_SALT is not set, using a random salt until restart")
+
+	return salt
+}
+
+// BootstrapAdmin makes an existing account the first administrator. It is
+// run once by hand, with the -bootstrap-admin flag, rather than on every
+// start, and fails once an administrator exists.
+func (app *Application) BootstrapAdmin(username string) error {
+	if err := userManager.BootstrapAdmin(username); err != nil {
+		return fmt.Errorf("%s", err.Message())
+	}
+
+	return nil
+}
+
+// newWebhookManager caches each user's webhooks like links, so that clicks
+// on links without webhooks do not query them. Receivers on private networks
+// are refused unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is true, which is meant
+// for local development.
+func newWebhookManager(db *gorm.DB) webhook.WebhookManager {
+	timeout := getDurationEnv("WEBHOOK_TIMEOUT", defaultWebhookTimeout)
+	ttl := getDurationEnv("CACHE_LOCAL_TTL", defaultCacheLocalTTL)
+	tiers := []cache.Cache{cache.NewLRU(getIntEnv("CACHE_SIZE", defaultCacheSize), ttl)}
+
+	if sharedURLCache != nil {
+		tiers = append(tiers, sharedURLCache)
+	}
+
+	return webhook.NewWebhookManager(
+		webhook.NewGormRepository(db),
+		webhook.NewSender(timeout, os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"),
+		webhook.RetryPolicy{
+			MaxAttempts:  getIntEnv("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts),
+			BaseDelay:    getDurationEnv("WEBHOOK_RETRY_DELAY", defaultWebhookRetryDelay),
+			MaxDelay:     getDurationEnv("WEBHOOK_MAX_RETRY_DELAY", defaultWebhookMaxRetryDelay),
+			ClaimTimeout: 2 * timeout,
+		},
+		cache.NewTiered(tiers...),
+		getDurationEnv("CACHE_TTL", defaultCacheTTL),
+	)
+}
+
+// newQRCodeManager keeps rendered codes in process and, when redis is
+// configured, in the shared cache used for links. The optional centre logo is
+// read from QR_LOGO_PATH.
+func newQRCodeManager() qrcode.QRCodeManager {
+	ttl := getDurationEnv("QR_CACHE_TTL", defaultQRCacheTTL)
+	tiers := []cache.Cache{cache.NewLRU(getIntEnv("QR_CACHE_SIZE", defaultQRCacheSize), ttl)}
+
+	if sharedURLCache != nil {
+		tiers = append(tiers, sharedURLCache)
+	}
+
+	var logo *qrcode.Logo
+
+	if path := os.Getenv("QR_LOGO_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			log.Fatalf("Error reading QR code logo: %s", err)
+		}
+
+		logo, err = qrcode.DecodeLogo(data)
+
+		if err != nil {
+			log.Fatalf("Error decoding QR code logo: %s", err)
+		}
+	}
+
+	return qrcode.NewQRCodeManager(cache.NewTiered(tiers...), ttl, logo)
+}
+
+// newURLRepository puts the redirect cache in front of the database: an
+// in-process LRU, backed by Redis when REDIS_URL is set.
+func newURLRepository(db *gorm.DB) *urlshortener.CachedRepository {
+	urlCache = cache.NewLRU(
+		getIntEnv("CACHE_SIZE", defaultCacheSize),
+		getDurationEnv("CACHE_LOCAL_TTL", defaultCacheLocalTTL),
+	)
+	sharedURLCache = nil
+	tiers := []cache.Cache{urlCache}
+
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		redisCache, err := cache.NewRedis(redisURL, "dcube:")
+
+		if err != nil {
+			log.Fatalf("Error connecting to redis: %s", err)
+		}
+
+		sharedURLCache = redisCache
+		tiers = append(tiers, redisCache)
+	}
+
+	return urlshortener.NewCachedRepository(
+		urlshortener.NewGormRepository(db),
+		cache.NewTiered(tiers...),
+		getDurationEnv("CACHE_TTL", defaultCacheTTL),
+		getDurationEnv("CACHE_NEGATIVE_TTL", defaultCacheNegativeTTL),
+	).(*urlshortener.CachedRepository)
+}
+
+// errRolledBack aborts a transaction whose reason is reported separately.
+var errRolledBack = errors.New("transaction rolled back")
+
+// membershipTransaction runs fn with workspace and link managers whose writes
+// go through a single transaction, so that members and workspaces are never
+// removed without their links being handed over or deleted too.
+func membershipTransaction(
+	fn func(workspace.WorkspaceManager, urlshortener.URLShortenerManager) dcubeerrs.Error,
+) dcubeerrs.Error {
+	var e dcubeerrs.Error
+	var commit func()
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var links urlshortener.Repository
+		links, commit = urlRepository.Join(urlshortener.NewGormRepository(tx))
+		workspaces := workspace.NewWorkspaceManager(workspace.NewGormRepository(tx), user.NewGormRepository(tx))
+
+		if e = fn(workspaces, newLinkManager(links, workspaces, analytics.NewClickPurger(tx))); e != nil {
+			return errRolledBack
+		}
+		return nil
+	})
+
+	if e != nil {
+		return e
+	}
+	if err != nil {
+		log.Printf("Error committing membership change: %s", err.Error())
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating workspace members")
+	}
+
+	commit()
+	return nil
+}
+
+func newRateLimitStore() ratelimit.Store {
+	redisURL := os.Getenv("REDIS_URL")
+
+	if redisURL == "" {
+		return ratelimit.NewMemoryStore()
+	}
+
+	store, err := ratelimit.NewRedisStore(redisURL, "dcube:ratelimit:")
+
+	if err != nil {
+		log.Fatalf("Error connecting to redis: %s", err)
+	}
+
+	return store
+}
+
+// newPasswordPolicy enforces PASSWORD_MIN_LENGTH and, when
+// BREACHED_PASSWORDS_PATH is set, rejects passwords listed in that file.
+func newPasswordPolicy() *user.PasswordPolicy {
+	policy, err := user.NewPasswordPolicy(
+		getIntEnv("PASSWORD_MIN_LENGTH", user.DefaultMinPasswordLength),
+		os.Getenv("BREACHED_PASSWORDS_PATH"),
+	)
+
+	if err != nil {
+		log.Fatalf("Error configuring password policy: %s", err)
+	}
+
+	return policy
+}
+
+// newPasswordResetNotifier appends reset tokens to PASSWORD_RESET_OUTBOX if it
+// is set and logs them otherwise.
+func newPasswordResetNotifier() user.Notifier {
+	if path := os.Getenv("PASSWORD_RESET_OUTBOX"); path != "" {
+		return user.NewFileNotifier(path)
+	}
+
+	return user.LogNotifier{}
+}
+
+// newCodeGenerator picks the short code strategy from CODE_STRATEGY (random by
+// default), with CODE_LENGTH and, for obfuscated codes, CODE_SALT.
+func newCodeGenerator() urlshortener.CodeGenerator {
+	codes, err := urlshortener.NewCodeGenerator(
+		os.Getenv("CODE_STRATEGY"),
+		getIntEnv("CODE_LENGTH", urlshortener.DefaultCodeLength),
+		os.Getenv("CODE_SALT"),
+	)
+
+	if err != nil {
+		log.Fatalf("Error configuring short codes: %s", err)
+	}
+
+	return codes
+}
+
+// shortLinkHosts lists the public domains our short links are served from,
+// taken from SHORT_LINK_HOSTS (comma separated). It is required: HOST is only
+// the address the server binds to, and without our own domains links to other
+// short links could not be rejected.
+func shortLinkHosts() []string {
+	hosts := os.Getenv("SHORT_LINK_HOSTS")
+
+	if strings.TrimSpace(hosts) == "" {
+		log.Fatal("SHORT_LINK_HOSTS must list the domains short links are served from")
+	}
+
+	return strings.Split(hosts, ",")
+}
+
+// shortLinkBase returns SHORT_LINK_BASE_URL, the public address short links
+// are served from. It is required rather than taken from the request, since
+// behind a proxy that terminates TLS the request only carries the internal
+// host and scheme, which QR codes would then encode.
+func shortLinkBase() string {
+	base, err := url.Parse(os.Getenv("SHORT_LINK_BASE_URL"))
+
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		log.Fatal("SHORT_LINK_BASE_URL must be set to the public address short links are served from")
+	}
+
+	return strings.TrimSuffix(base.String(), "/")
+}
+
+// shortLinkURL returns the public address of a short link.
+func shortLinkURL(code string) string {
+	return fmt.Sprintf("%s/r/%s", shortLinkBaseURL, url.PathEscape(code))
+}
+
+// newScreener builds the link screening providers: the local blocklist when
+// BLOCKLIST_PATH is set, followed by the external reputation service.
+func newScreener() *screening.Screener {
+	var providers []screening.Provider
+	blocklist = nil
+
+	if path := os.Getenv("BLOCKLIST_PATH"); path != "" {
+		b, err := screening.NewBlocklist(path)
+
+		if err != nil {
+			log.Fatalf("Error loading blocklist: %s", err)
+		}
+
+		blocklist = b
+		providers = append(providers, b)
+	}
+
+	// Reputation verdicts are cached so that redirects do not wait on the
+	// service for destinations it has already seen.
+	ttl := getDurationEnv("SCREENING_CACHE_TTL", defaultScreeningCacheTTL)
+	providers = append(providers, screening.NewCachedProvider(
+		screening.NewReputationService(os.Getenv("REPUTATION_SERVICE_URL"), os.Getenv("REPUTATION_SERVICE_KEY")),
+		cache.NewLRU(getIntEnv("SCREENING_CACHE_SIZE", defaultScreeningCacheSize), ttl),
+		ttl,
+	))
+
+	return screening.NewScreener(providers...)
+}
+
+func (app *Application) initRoutes() {
+	app.router.Use(requestIDMiddleware)
+	app.router.Use(commonMiddleware)
+	app.router.Handle("/signin", app.rateLimited(signInRateLimit, app.SignIn)).Methods(http.MethodPost)
+	app.router.Handle("/signin/2fa", app.rateLimited(signInRateLimit, app.SignInSecondFactor)).Methods(http.MethodPost)
+	app.router.Handle("/password/forgot", app.rateLimited(passwordRateLimit, app.RequestPasswordReset)).
+		Methods(http.MethodPost)
+	app.router.Handle("/password/reset", app.rateLimited(passwordRateLimit, app.ResetPassword)).Methods(http.MethodPost)
+	app.router.Handle("/signup", app.rateLimited(signUpRateLimit, app.SignUp)).Methods(http.MethodPost)
+	app.router.Handle("/r/{url}", app.rateLimited(redirectRateLimit, app.Redirect)).
+		Methods(http.MethodGet, http.MethodHead)
+	app.router.Handle("/lookup/{url}", app.rateLimited(redirectRateLimit, app.Lookup)).Methods(http.MethodGet)
+	app.router.Handle("/token/refresh", app.rateLimited(refreshRateLimit, app.RefreshToken)).Methods(http.MethodPost)
+
+	signOut := app.router.PathPrefix("/signout").Subrouter()
+	signOut.Use(tokenValidatorMiddleware)
+	signOut.Use(app.sessionOnlyMiddleware)
+	signOut.Use(app.rateLimitMiddleware(apiRateLimit))
+	signOut.HandleFunc("", app.SignOut).Methods(http.MethodPost)
+	signOut.HandleFunc("/all", app.SignOutAll).Methods(http.MethodPost)
+
+	me := app.router.PathPrefix("/me").Subrouter()
+	me.Use(tokenValidatorMiddleware)
+	me.Use(app.sessionOnlyMiddleware)
+	me.Use(setAuthHeaderMiddleware)
+	me.Use(app.rateLimitMiddleware(apiRateLimit))
+	me.HandleFunc("", app.GetProfile).Methods(http.MethodGet)
+	me.HandleFunc("", app.UpdateProfile).Methods(http.MethodPatch)
+	me.HandleFunc("", app.DeleteAccount).Methods(http.MethodDelete)
+	me.HandleFunc("/export", app.ExportAccount).Methods(http.MethodGet)
+	me.HandleFunc("/logins", app.GetLoginHistory).Methods(http.MethodGet)
+	me.HandleFunc("/password", app.ChangePassword).Methods(http.MethodPost)
+	me.HandleFunc("/2fa/enroll", app.EnrollTwoFactor).Methods(http.MethodPost)
+	me.HandleFunc("/2fa/confirm", app.ConfirmTwoFactor).Methods(http.MethodPost)
+	me.HandleFunc("/2fa/disable", app.DisableTwoFactor).Methods(http.MethodPost)
+	me.HandleFunc("/keys", app.GetAPIKeys).Methods(http.MethodGet)
+	me.HandleFunc("/keys", app.CreateAPIKey).Methods(http.MethodPost)
+	me.HandleFunc("/keys/{id}", app.RevokeAPIKey).Methods(http.MethodDelete)
+	me.HandleFunc("/audit", app.GetAuditTrail).Methods(http.MethodGet)
+
+	workspaces := app.router.PathPrefix("/workspaces").Subrouter()
+	workspaces.Use(tokenValidatorMiddleware)
+	workspaces.Use(app.scopeMiddleware(apikey.ScopeWorkspacesRead, apikey.ScopeWorkspacesWrite))
+	workspaces.Use(setAuthHeaderMiddleware)
+	workspaces.Use(app.rateLimitMiddleware(apiRateLimit))
+	workspaces.HandleFunc("", app.GetWorkspaces).Methods(http.MethodGet)
+	workspaces.HandleFunc("", app.CreateWorkspace).Methods(http.MethodPost)
+	workspaces.HandleFunc("/{id}/members", app.GetWorkspaceMembers).Methods(http.MethodGet)
+	workspaces.HandleFunc("/{id}/members", app.AddWorkspaceMember).Methods(http.MethodPost)
+	workspaces.HandleFunc("/{id}/members/{username}", app.UpdateWorkspaceMember).Methods(http.MethodPatch)
+	workspaces.HandleFunc("/{id}/members/{username}", app.RemoveWorkspaceMember).Methods(http.MethodDelete)
+
+	webhooks := app.router.PathPrefix("/webhooks").Subrouter()
+	webhooks.Use(tokenValidatorMiddleware)
+	webhooks.Use(app.scopeMiddleware(apikey.ScopeWebhooksRead, apikey.ScopeWebhooksWrite))
+	webhooks.Use(setAuthHeaderMiddleware)
+	webhooks.Use(app.rateLimitMiddleware(apiRateLimit))
+	webhooks.HandleFunc("", app.GetWebhooks).Methods(http.MethodGet)
+	webhooks.HandleFunc("", app.CreateWebhook).Methods(http.MethodPost)
+	webhooks.HandleFunc("/dead-letters", app.GetWebhookDeadLetters).Methods(http.MethodGet)
+	webhooks.HandleFunc("/deliveries/{id}/redeliver", app.RedeliverWebhook).Methods(http.MethodPost)
+	webhooks.HandleFunc("/{id}", app.DeleteWebhook).Methods(http.MethodDelete)
+	webhooks.HandleFunc("/{id}/deliveries", app.GetWebhookDeliveries).Methods(http.MethodGet)
+
+	admin := app.router.PathPrefix("/admin").Subrouter()
+	admin.Use(tokenValidatorMiddleware)
+	admin.Use(app.sessionOnlyMiddleware)
+	admin.Use(app.adminMiddleware)
+	admin.Use(setAuthHeaderMiddleware)
+	admin.Use(app.rateLimitMiddleware(apiRateLimit))
+	admin.HandleFunc("/stats", app.AdminGetStats).Methods(http.MethodGet)
+	admin.HandleFunc("/users", app.AdminSearchUsers).Methods(http.MethodGet)
+	admin.HandleFunc("/users/{id}", app.AdminUpdateUser).Methods(http.MethodPatch)
+	admin.HandleFunc("/urls", app.AdminSearchURLs).Methods(http.MethodGet)
+	admin.HandleFunc("/urls/{id}/expire", app.AdminModerateURL(audit.ActionURLExpire, urlShortenerManager.ExpireURL)).
+		Methods(http.MethodPost)
+	admin.HandleFunc(
+		"/urls/{id}/quarantine",
+		app.AdminModerateURL(audit.ActionURLQuarantine, urlShortenerManager.QuarantineURL),
+	).Methods(http.MethodPost)
+	admin.HandleFunc("/urls/{id}/release", app.AdminModerateURL(audit.ActionURLRelease, urlShortenerManager.ReleaseURL)).
+		Methods(http.MethodPost)
+	admin.HandleFunc("/audit", app.AdminGetAuditLog).Methods(http.MethodGet)
+	admin.HandleFunc("/audit/verify", app.AdminVerifyAuditLog).Methods(http.MethodGet)
+	admin.HandleFunc("/urls/{id}/transfer", app.AdminTransferURL).Methods(http.MethodPost)
+
+	api := app.router.PathPrefix("/url").Subrouter()
+	api.Use(tokenValidatorMiddleware)
+	api.Use(app.scopeMiddleware(apikey.ScopeLinksRead, apikey.ScopeLinksWrite))
+	api.Use(setAuthHeaderMiddleware)
+	api.Use(app.rateLimitMiddleware(apiRateLimit))
+	api.HandleFunc("", app.GetURLs).Methods(http.MethodGet)
+	api.Handle("", app.rateLimited(createRateLimit, app.CreateURL)).Methods(http.MethodPost)
+	api.Handle("/bulk", app.rateLimited(createRateLimit, app.BulkCreateURL)).Methods(http.MethodPost)
+	api.HandleFunc("/{id}", app.UpdateURL).Methods(http.MethodPatch)
+	api.HandleFunc("/trash", app.GetTrash).Methods(http.MethodGet)
+	api.HandleFunc("/{id}", app.DeleteURL).Methods(http.MethodDelete)
+	api.HandleFunc("/{id}/restore", app.RestoreURL).Methods(http.MethodPost)
+	api.HandleFunc("/{id}/revisions", app.GetRevisions).Methods(http.MethodGet)
+	api.HandleFunc("/{id}/revisions/{revision}/rollback", app.RollbackURL).Methods(http.MethodPost)
+	api.HandleFunc("/{id}/stats", app.GetURLStats).Methods(http.MethodGet)
+	api.HandleFunc("/{id}/qr", app.GetURLQR).Methods(http.MethodGet)
+}
+
+// topLevelSegments returns the first path segment of every route, which a
+// custom alias must not take over.
+func topLevelSegments(router *mux.Router) []string {
+	var segments []string
+
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+
+		if err != nil {
+			return nil
+		}
+
+		segment := strings.SplitN(strings.TrimPrefix(template, "/"), "/", 2)[0]
+
+		if segment != "" && !strings.Contains(segment, "{") {
+			segments = append(segments, segment)
+		}
+
+		return nil
+	})
+
+	return segments
+}
+
+func (app *Application) validateParams(s interface{}) dcubeerrs.Error {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
+	err := validate.Struct(s)
+
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+
+	if !ok {
+		return dcubeerrs.New(http.StatusBadRequest, err.Error())
+	}
+
+	fields := make([]dcubeerrs.FieldError, len(validationErrors))
+	for i, fieldErr := range validationErrors {
+		fields[i] = dcubeerrs.FieldError{
+			Field:   fieldErr.Field(),
+			Message: fmt.Sprintf("%s failed on the '%s' rule", fieldErr.Field(), fieldErr.Tag()),
+		}
+	}
+
+	return dcubeerrs.NewValidation(fields...)
+}
+
+// jsonFieldName reports validation failures under the name clients send.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
+
+// recordAudit appends a change to the audit log. The actor defaults to the
+// authenticated user. The change has already been made by the time it is
+// recorded, so failed writes are queued and retried by the audit retrier.
+func (app *Application) recordAudit(r *http.Request, record audit.RecordRequest) {
+	if record.ActorID == nil {
+		if userID, ok := r.Context().Value("user_id").(uint); ok {
+			record.ActorID = &userID
+		}
+	}
+
+	record.RequestID, _ = r.Context().Value("request_id").(string)
+	record.IP = utils.GetClientIP(r)
+
+	if err := auditManager.Record(record); err != nil {
+		log.Printf(
+			"Error recording %s of %s %d, queued for retry: %s",
+			record.Action,
+			record.TargetType,
+			record.TargetID,
+			err.Message(),
+		)
+	}
+}
+
+func (app *Application) respondWithError(w http.ResponseWriter, err dcubeerrs.Error) {
+	payload := map[string]interface{}{"error": err.Message()}
+
+	if fieldErrs, ok := err.(dcubeerrs.FieldErrors); ok {
+		payload["fields"] = fieldErrs.Fields()
+	}
+
+	app.respondWithJSON(w, err.StatusCode(), err.Message(), payload)
 }
 
 func (app *Application) respondWithJSON(w http.ResponseWriter, code int, message string, payload interface{}) {
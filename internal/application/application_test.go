@@ -1,17 +1,40 @@
 package application
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Imranr2/DCUBE_API/internal/analytics"
+	"github.com/Imranr2/DCUBE_API/internal/apikey"
+	"github.com/Imranr2/DCUBE_API/internal/audit"
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"github.com/Imranr2/DCUBE_API/internal/qrcode"
 	"github.com/Imranr2/DCUBE_API/internal/session"
 	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
 	"github.com/Imranr2/DCUBE_API/internal/user"
+	"github.com/Imranr2/DCUBE_API/internal/webhook"
+	"github.com/Imranr2/DCUBE_API/internal/workspace"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -57,17 +80,40 @@ func setup() (app *Application, db *gorm.DB) {
 	dbName := "testDB"
 	exec.Command("rm", "-f", dbName)
 
-	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{TranslateError: true})
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	db.AutoMigrate(&user.User{}, &urlshortener.ShortenedURL{})
+	db.AutoMigrate(
+		&user.User{},
+		&user.LoginAttempt{},
+		&user.RecoveryCode{},
+		&user.PasswordResetToken{},
+		&urlshortener.ShortenedURL{},
+		&urlshortener.URLRevision{},
+		&urlshortener.CodeSequence{},
+		&urlshortener.RetiredCode{},
+		&workspace.Workspace{},
+		&workspace.Membership{},
+		&analytics.ClickEvent{},
+		&session.LoginSession{},
+		&session.RefreshToken{},
+		&apikey.APIKey{},
+		&audit.Entry{},
+		&webhook.Subscription{},
+		&webhook.Delivery{},
+	)
 
 	db.Create(users)
 	db.Create(urls)
 
+	os.Setenv("SHORT_LINK_HOSTS", "dcu.be")
+	os.Setenv("SHORT_LINK_BASE_URL", "https://dcu.be/")
+	os.Setenv("AUDIT_HMAC_KEY", "test-audit-key")
+	os.Setenv("AUDIT_ANCHOR_PATH", filepath.Join(os.TempDir(), fmt.Sprintf("dcube-audit-anchor-%d", os.Getpid())))
+
 	app = &Application{}
 
 	app.InitApp(db)
@@ -119,14 +165,14 @@ func TestGetURLsSuccess(t *testing.T) {
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, "user_id", 1)
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/url", nil)
-	token, _ := session.GenerateToken(uint(1))
+	token, _ := generateToken(uint(1))
 	req.Header.Add("Authorization", token.TokenString)
 
 	resp := executeRequest(req, app)
 	assert.Equal(t, http.StatusOK, resp.Code)
 
 	// When user has no urls it returns 200 status
-	token, _ = session.GenerateToken(uint(3))
+	token, _ = generateToken(uint(3))
 	req.Header.Add("Authorization", token.TokenString)
 	resp = executeRequest(req, app)
 	assert.Equal(t, http.StatusOK, resp.Code)
@@ -142,23 +188,495 @@ func TestGetURLsFail(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, resp.Code)
 }
 
+func TestSignInLockoutAndLoginHistory(t *testing.T) {
+	app, _ := setup()
+
+	payload := []byte(`{"username":"test1", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	req.Header.Set("User-Agent", "history-test")
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	token, _ := generateToken(uint(1))
+	req, _ = http.NewRequest(http.MethodGet, "/me/logins?limit=1", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var history struct {
+		Payload user.LoginHistoryResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &history)
+	assert.Len(t, history.Payload.Logins, 1)
+	assert.True(t, history.Payload.Logins[0].Success)
+	assert.Equal(t, "history-test", history.Payload.Logins[0].UserAgent)
+
+	payload = []byte(`{"username":"lockout-test", "password":"password"}`)
+	for i := 0; i < 3; i++ {
+		req, _ = http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+}
+
+func TestSignInRecordsTrustedClientAddress(t *testing.T) {
+	t.Setenv("TRUSTED_PROXY_HOPS", "1")
+	app, db := setup()
+
+	payload := []byte(`{"username":"forwarded", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	// A forged left-most entry neither changes the address failures and
+	// sign-ins are counted against nor makes the client look new.
+	for _, forwarded := range []string{"203.0.113.20", "192.0.2.99, 203.0.113.20"} {
+		req, _ = http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+		req.RemoteAddr = "10.0.0.1:4321"
+		req.Header.Set("X-Forwarded-For", forwarded)
+		req.Header.Set("User-Agent", "forwarded-test")
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.NotContains(t, resp.Body.String(), `"new_client":true`)
+	}
+
+	var attempts []user.LoginAttempt
+	db.Where("username = ?", "forwarded").Find(&attempts)
+	assert.Len(t, attempts, 2)
+	for _, attempt := range attempts {
+		assert.Equal(t, "203.0.113.20", attempt.IP)
+	}
+}
+
+func TestSignInTwoFactor(t *testing.T) {
+	app, db := setup()
+
+	payload := []byte(`{"username":"twofactor", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var account user.User
+	db.Where("username = ?", "twofactor").First(&account)
+	token, _ := generateToken(account.ID)
+
+	req, _ = http.NewRequest(http.MethodPost, "/me/2fa/enroll", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var enroll struct {
+		Payload user.EnrollTwoFactorResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &enroll)
+	assert.True(t, strings.HasPrefix(enroll.Payload.OTPAuthURI, "otpauth://totp/"))
+
+	confirm := []byte(`{"code":"` + currentTOTPCode(enroll.Payload.Secret) + `"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/me/2fa/confirm", bytes.NewBuffer(confirm))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var codes struct {
+		Payload user.RecoveryCodesResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &codes)
+	assert.NotEmpty(t, codes.Payload.RecoveryCodes)
+
+	req, _ = http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Authorization"))
+
+	var pending struct {
+		Payload struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+		} `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &pending)
+	assert.True(t, pending.Payload.MFARequired)
+
+	// The pending token is not an access token.
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", pending.Payload.MFAToken)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	secondFactor := []byte(`{"mfa_token":"not-a-token", "code":"` + codes.Payload.RecoveryCodes[0] + `"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/signin/2fa", bytes.NewBuffer(secondFactor))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	secondFactor = []byte(`{"mfa_token":"` + pending.Payload.MFAToken + `", "code":"` + codes.Payload.RecoveryCodes[0] + `"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/signin/2fa", bytes.NewBuffer(secondFactor))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotEmpty(t, resp.Header().Get("Authorization"))
+}
+
+func TestChangePassword(t *testing.T) {
+	app, db := setup()
+
+	payload := []byte(`{"username":"changepw", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var account user.User
+	db.Where("username = ?", "changepw").First(&account)
+	token, _ := generateToken(account.ID)
+	other, _ := generateToken(account.ID)
+
+	payload = []byte(`{"current_password":"password1", "new_password":"changepw1"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/me/password", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "new_password")
+
+	payload = []byte(`{"current_password":"password1", "new_password":"a much better password"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/me/password", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	newToken := resp.Header().Get("Authorization")
+
+	for _, old := range []string{token.TokenString, other.TokenString} {
+		req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+		req.Header.Add("Authorization", old)
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", newToken)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestResetPassword(t *testing.T) {
+	outbox := filepath.Join(t.TempDir(), "outbox.jsonl")
+	t.Setenv("PASSWORD_RESET_OUTBOX", outbox)
+	app, db := setup()
+
+	payload := []byte(`{"username":"resetpw", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var account user.User
+	db.Where("username = ?", "resetpw").First(&account)
+	token, _ := generateToken(account.ID)
+
+	req, _ = http.NewRequest(http.MethodPost, "/password/forgot", bytes.NewBuffer([]byte(`{"username":"resetpw"}`)))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	sent, _ := os.ReadFile(outbox)
+	var message struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(sent, &message)
+	assert.NotEmpty(t, message.Token)
+
+	payload = []byte(`{"token":"` + message.Token + `", "new_password":"a much better password"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/password/reset", bytes.NewBuffer(payload))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/password/reset", bytes.NewBuffer(payload))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestProfileExportAndDeleteAccount(t *testing.T) {
+	app, db := setup()
+
+	payload := []byte(`{"username":"profile", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var account user.User
+	db.Where("username = ?", "profile").First(&account)
+	token, _ := generateToken(account.ID)
+
+	payload = []byte(`{"email":"not-an-email"}`)
+	req, _ = http.NewRequest(http.MethodPatch, "/me", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	payload = []byte(`{"display_name":"Profile", "default_redirect_type":"permanent", "default_expiry_days":7}`)
+	req, _ = http.NewRequest(http.MethodPatch, "/me", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"displayName":"Profile"`)
+
+	// New links pick up the profile defaults.
+	payload = []byte(`{"original_url":"https://example.com/profile"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	assert.Equal(t, urlshortener.RedirectPermanent, created.Payload.ShortenedURL.RedirectType)
+	assert.NotNil(t, created.Payload.ShortenedURL.ExpiresAt)
+
+	// Empty strings clear the profile fields.
+	payload = []byte(`{"email":"profile@example.com"}`)
+	req, _ = http.NewRequest(http.MethodPatch, "/me", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	payload = []byte(`{"email":"", "default_redirect_type":""}`)
+	req, _ = http.NewRequest(http.MethodPatch, "/me", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var cleared user.User
+	db.First(&cleared, account.ID)
+	assert.Empty(t, cleared.Email)
+	assert.Empty(t, cleared.DefaultRedirectType)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/"+created.Payload.ShortenedURL.Shortened, nil)
+	req.Header.Set("User-Agent", "profile-export-agent")
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusMovedPermanently, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/me/export?format=zip", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+
+	archive, e := zip.NewReader(bytes.NewReader(resp.Body.Bytes()), int64(resp.Body.Len()))
+	assert.Nil(t, e)
+	assert.Len(t, archive.File, 4)
+
+	req, _ = http.NewRequest(http.MethodGet, "/me/export", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "https://example.com/profile")
+	assert.Contains(t, resp.Body.String(), "profile-export-agent")
+
+	req, _ = http.NewRequest(http.MethodDelete, "/me", bytes.NewBuffer([]byte(`{"password":"wrong-password"}`)))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/me", bytes.NewBuffer([]byte(`{"password":"password1"}`)))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var links int64
+	db.Model(&urlshortener.ShortenedURL{}).Where("user_id = ?", account.ID).Count(&links)
+	assert.Equal(t, int64(0), links)
+
+	var clicks int64
+	db.Model(&analytics.ClickEvent{}).Where("shortened_url_id = ?", created.Payload.ShortenedURL.ID).Count(&clicks)
+	assert.Equal(t, int64(0), clicks)
+
+	// The account's personal details do not survive in the audit log.
+	var entries []audit.Entry
+	db.Where("target_type = ? AND target_id = ?", audit.TargetUser, account.ID).Find(&entries)
+	assert.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.NotContains(t, string(entry.Before)+string(entry.After), "profile@example.com")
+		assert.NotContains(t, string(entry.Before)+string(entry.After), `"Profile"`)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestDeleteAccountResumesAfterFailure(t *testing.T) {
+	app, db := setup()
+
+	payload := []byte(`{"username":"resume", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var account user.User
+	db.Where("username = ?", "resume").First(&account)
+	token, _ := generateToken(account.ID)
+
+	payload = []byte(`{"original_url":"https://example.com/resume"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	payload = []byte(`{"name":"resume", "scopes":["links:read"]}`)
+	req, _ = http.NewRequest(http.MethodPost, "/me/keys", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	// The deletion fails part-way, after the links are gone.
+	t.Run("keys cannot be deleted", func(t *testing.T) {
+		failWrites(t, db, "api_keys")
+
+		req, _ = http.NewRequest(http.MethodDelete, "/me", bytes.NewBuffer([]byte(`{"password":"password1"}`)))
+		req.Header.Add("Authorization", token.TokenString)
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	})
+
+	var links, keys, accounts int64
+	db.Unscoped().Model(&urlshortener.ShortenedURL{}).Where("user_id = ?", account.ID).Count(&links)
+	assert.Equal(t, int64(0), links)
+	db.Model(&apikey.APIKey{}).Where("user_id = ?", account.ID).Count(&keys)
+	assert.Equal(t, int64(1), keys)
+
+	var stored user.User
+	db.First(&stored, account.ID)
+	assert.NotNil(t, stored.DeletingAt)
+
+	// The account cannot be signed back into while it is being deleted.
+	payload = []byte(`{"username":"resume", "password":"password1"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	finished, err := app.ResumeAccountDeletions(time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, finished, 1)
+
+	db.Model(&apikey.APIKey{}).Where("user_id = ?", account.ID).Count(&keys)
+	assert.Equal(t, int64(0), keys)
+	db.Model(&user.User{}).Where("id = ?", account.ID).Count(&accounts)
+	assert.Equal(t, int64(0), accounts)
+}
+
+func TestSignInRateLimited(t *testing.T) {
+	app, _ := setup()
+	// Each attempt uses its own username so that account lockout does not
+	// kick in first.
+	for i := 0; i < signInRateLimit.Limit; i++ {
+		payload := []byte(fmt.Sprintf(`{"username":"ratelimit%d", "password":"password"}`, i))
+		req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+		req.RemoteAddr = "203.0.113.7:4321"
+		resp := executeRequest(req, app)
+		assert.NotEqual(t, http.StatusTooManyRequests, resp.Code)
+		assert.Equal(t, strconv.Itoa(signInRateLimit.Limit), resp.Header().Get("RateLimit-Limit"))
+	}
+
+	payload := []byte(`{"username":"ratelimit", "password":"password"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	req.RemoteAddr = "203.0.113.7:4321"
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+
+	// Other clients are unaffected.
+	req, _ = http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	req.RemoteAddr = "198.51.100.2:4321"
+	resp = executeRequest(req, app)
+	assert.NotEqual(t, http.StatusTooManyRequests, resp.Code)
+
+	// Refreshing and signing up draw on their own buckets.
+	req, _ = http.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer([]byte(`{"refresh_token":"x"}`)))
+	req.RemoteAddr = "203.0.113.7:4321"
+	resp = executeRequest(req, app)
+	assert.NotEqual(t, http.StatusTooManyRequests, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer([]byte(`{}`)))
+	req.RemoteAddr = "203.0.113.7:4321"
+	resp = executeRequest(req, app)
+	assert.NotEqual(t, http.StatusTooManyRequests, resp.Code)
+}
+
+func TestSignInRateLimitIgnoresForgedForwardedFor(t *testing.T) {
+	t.Setenv("TRUSTED_PROXY_HOPS", "1")
+	app, _ := setup()
+
+	// Behind one proxy, the client can only choose the entries to the left of
+	// the one the proxy appends, and a new one each time does not earn a new
+	// bucket.
+	for i := 0; i <= signInRateLimit.Limit; i++ {
+		payload := []byte(fmt.Sprintf(`{"username":"forged%d", "password":"password"}`, i))
+		req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+		req.RemoteAddr = "10.0.0.1:4321"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("192.0.2.%d, 203.0.113.9", i))
+		resp := executeRequest(req, app)
+
+		if i < signInRateLimit.Limit {
+			assert.NotEqual(t, http.StatusTooManyRequests, resp.Code)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+		}
+	}
+}
+
 func TestCreateURLSuccess(t *testing.T) {
 	app, db := setup()
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, "user_id", 1)
-	payload := []byte(`{"original_url":"www.newurl.com"}`)
+	payload := []byte(`{"original_url":"HTTPS://WWW.NewURL.com:443"}`)
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/url", bytes.NewBuffer(payload))
-	token, _ := session.GenerateToken(uint(1))
+	token, _ := generateToken(uint(1))
 	req.Header.Add("Authorization", token.TokenString)
 
 	resp := executeRequest(req, app)
 	assert.Equal(t, http.StatusCreated, resp.Code)
 
 	var url urlshortener.ShortenedURL
-	err := db.Model(&urlshortener.ShortenedURL{}).First(&url, urlshortener.ShortenedURL{Original: "www.newurl.com"}).Error
+	err := db.Model(&urlshortener.ShortenedURL{}).First(&url, urlshortener.ShortenedURL{Original: "https://www.newurl.com"}).Error
 	assert.Nil(t, err)
 }
 
+func TestCreateURLInvalidDestination(t *testing.T) {
+	app, _ := setup()
+	token, _ := generateToken(uint(1))
+
+	for _, original := range []string{"javascript:alert(1)", "www.newurl.com", "/relative", "https://dcu.be/r/abc"} {
+		payload := []byte(fmt.Sprintf(`{"original_url":%q}`, original))
+		req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+		req.Header.Add("Authorization", token.TokenString)
+
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var body struct {
+			Payload struct {
+				Fields []dcubeerrs.FieldError `json:"fields"`
+			} `json:"payload"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		assert.Len(t, body.Payload.Fields, 1)
+		assert.Equal(t, "original_url", body.Payload.Fields[0].Field)
+	}
+}
+
 func TestCreateURLFail(t *testing.T) {
 	app, _ := setup()
 	ctx := context.Background()
@@ -170,44 +688,1281 @@ func TestCreateURLFail(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, resp.Code)
 }
 
-func TestDeleteURLSuccess(t *testing.T) {
+func TestCreateURLWithAliasSuccess(t *testing.T) {
 	app, db := setup()
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, "user_id", 1)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, "/url/1", nil)
-	token, _ := session.GenerateToken(uint(1))
+	payload := []byte(`{"original_url":"https://www.example.com/sale", "alias":"spring-sale"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	token, _ := generateToken(uint(1))
 	req.Header.Add("Authorization", token.TokenString)
 
 	resp := executeRequest(req, app)
-	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, http.StatusCreated, resp.Code)
 
 	var url urlshortener.ShortenedURL
-	err := db.Model(&urlshortener.ShortenedURL{}).First(&url, urlshortener.ShortenedURL{ID: 1}).Error
-	assert.Equal(t, gorm.ErrRecordNotFound, err)
+	err := db.Model(&urlshortener.ShortenedURL{}).First(&url, urlshortener.ShortenedURL{Shortened: "spring-sale"}).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.example.com/sale", url.Original)
 }
 
-func TestDeleteURLFail(t *testing.T) {
+func TestCreateURLWithAliasFail(t *testing.T) {
 	app, _ := setup()
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, "user_id", 1)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, "/url/1", nil)
+	token, _ := generateToken(uint(1))
 
-	resp := executeRequest(req, app)
-	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	// Reserved words, invalid characters and bad lengths are rejected
+	aliases := []string{
+		"signin", "URL", "r", "me", "Workspaces", "token", "lookup", "password", "webhooks", "signout",
+		"ab", "has space", "-leading", "this-alias-is-far-too-long-to-be-accepted",
+	}
+	for _, alias := range aliases {
+		payload := []byte(`{"original_url":"https://www.example.com", "alias":"` + alias + `"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+		req.Header.Add("Authorization", token.TokenString)
 
-	req, _ = http.NewRequestWithContext(ctx, http.MethodDelete, "/url/200", nil)
-	token, _ := session.GenerateToken(uint(1))
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, alias)
+	}
+
+	// Aliases already in use return a conflict
+	payload := []byte(`{"original_url":"https://www.example.com", "alias":"taken-alias"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	executeRequest(req, app)
+
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
 	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusConflict, resp.Code)
 
+	// including when they differ only in case
+	payload = []byte(`{"original_url":"https://www.example.com", "alias":"Taken-Alias"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
 	resp = executeRequest(req, app)
-	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+}
 
-	req, _ = http.NewRequestWithContext(ctx, http.MethodDelete, "/url/3", nil)
-	token, _ = session.GenerateToken(uint(1))
+func TestRedirectExpiredURL(t *testing.T) {
+	app, db := setup()
+	token, _ := generateToken(uint(1))
+
+	// Links cannot be created with an expiry in the past
+	payload := []byte(`{"original_url":"https://www.example.com", "expires_at":"2000-01-01T00:00:00Z"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
 	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
 
+	expiresAt := time.Now().UTC().Add(-time.Hour)
+	db.Create(&urlshortener.ShortenedURL{Original: "https://www.example.com", Shortened: "expiredTest", UserID: 1, ExpiresAt: &expiresAt})
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/expiredTest", nil)
 	resp = executeRequest(req, app)
-	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, http.StatusGone, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url?state=expired", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "expiredTest")
+
+	req, _ = http.NewRequest(http.MethodGet, "/url?state=active", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "expiredTest")
+
+	req, _ = http.NewRequest(http.MethodGet, "/url?state=unknown", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestRedirectClickBudget(t *testing.T) {
+	app, db := setup()
+	token, _ := generateToken(uint(1))
+
+	payload := []byte(`{"original_url":"https://www.example.com", "alias":"one-click", "max_clicks":1}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	// Link previews and uptime checks do not use up the budget.
+	for i := 0; i < 3; i++ {
+		req, _ = http.NewRequest(http.MethodHead, "/r/one-click", nil)
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusFound, resp.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/r/one-click", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/one-click", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusFound, resp.Code)
+
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusGone, resp.Code)
+
+	// The sweeper archives links whose budget has been used up
+	archived, err := urlShortenerManager.ArchiveExpired()
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, archived, int64(1))
+
+	var url urlshortener.ShortenedURL
+	db.First(&url, urlshortener.ShortenedURL{Shortened: "one-click"})
+	assert.NotNil(t, url.ArchivedAt)
+}
+
+func TestRedirectStatusCodes(t *testing.T) {
+	app, _ := setup()
+	token, _ := generateToken(uint(1))
+
+	cases := map[string]int{
+		"permanent":         http.StatusMovedPermanently,
+		"temporary":         http.StatusFound,
+		"method_preserving": http.StatusTemporaryRedirect,
+	}
+
+	for redirectType, code := range cases {
+		alias := "redirect-" + strings.ReplaceAll(redirectType, "_", "-")
+		payload := []byte(`{"original_url":"https://www.example.com/` + redirectType + `", "alias":"` + alias + `", "redirect_type":"` + redirectType + `"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+		req.Header.Add("Authorization", token.TokenString)
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, "/r/"+alias, nil)
+		resp = executeRequest(req, app)
+		assert.Equal(t, code, resp.Code)
+		assert.Equal(t, "https://www.example.com/"+redirectType, resp.Header().Get("Location"))
+
+		// API clients can still resolve the link as JSON
+		req, _ = http.NewRequest(http.MethodGet, "/lookup/"+alias, nil)
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), "https://www.example.com/"+redirectType)
+	}
+
+	payload := []byte(`{"original_url":"https://www.example.com", "redirect_type":"sideways"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGetURLStats(t *testing.T) {
+	app, _ := setup()
+	token, _ := generateToken(uint(1))
+
+	payload := []byte(`{"original_url":"https://www.example.com", "alias":"stats-test"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+
+	for _, addr := range []string{"10.0.0.1:1234", "10.0.0.1:4321", "10.0.0.2:1234"} {
+		req, _ = http.NewRequest(http.MethodGet, "/r/stats-test", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) Mobile/15E148")
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusFound, resp.Code)
+	}
+	analyticsManager.Flush()
+
+	statsURL := fmt.Sprintf("/url/%d/stats?days=7", created.Payload.ShortenedURL.ID)
+	req, _ = http.NewRequest(http.MethodGet, statsURL, nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var stats struct {
+		Payload analytics.StatsResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &stats)
+	assert.Equal(t, int64(3), stats.Payload.TotalClicks)
+	assert.Equal(t, int64(2), stats.Payload.UniqueVisitors)
+	assert.Equal(t, int64(3), stats.Payload.Devices[analytics.DeviceMobile])
+	assert.Len(t, stats.Payload.Daily, 7)
+	assert.Equal(t, int64(3), stats.Payload.Daily[6].Clicks)
+
+	// Other users cannot see the stats
+	token, _ = generateToken(uint(2))
+	req, _ = http.NewRequest(http.MethodGet, statsURL, nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestBulkCreateURL(t *testing.T) {
+	app, db := setup()
+	token, _ := generateToken(uint(1))
+
+	var bulk struct {
+		Payload urlshortener.BulkCreateResponse `json:"payload"`
+	}
+
+	// Atomic mode creates nothing when any row is invalid
+	payload := []byte(`[{"original_url":"https://a.example.com", "alias":"bulk-atomic"}, {"alias":"bulk-missing"}]`)
+	req, _ := http.NewRequest(http.MethodPost, "/url/bulk", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+	json.Unmarshal(resp.Body.Bytes(), &bulk)
+	assert.Equal(t, 0, bulk.Payload.Created)
+	assert.Equal(t, http.StatusFailedDependency, bulk.Payload.Results[0].StatusCode)
+	assert.Equal(t, http.StatusBadRequest, bulk.Payload.Results[1].StatusCode)
+
+	var count int64
+	db.Model(&urlshortener.ShortenedURL{}).Where("shortened = ?", "bulk-atomic").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// Best effort mode keeps the rows that succeeded
+	req, _ = http.NewRequest(http.MethodPost, "/url/bulk?mode=best_effort", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusMultiStatus, resp.Code)
+
+	json.Unmarshal(resp.Body.Bytes(), &bulk)
+	assert.Equal(t, 1, bulk.Payload.Created)
+	assert.Equal(t, "bulk-atomic", bulk.Payload.Results[0].ShortenedURL.Shortened)
+
+	// CSV uploads are accepted with a header row
+	csvPayload := []byte("original_url,alias,max_clicks\nhttps://b.example.com,bulk-csv-1,5\nhttps://c.example.com,,\n")
+	req, _ = http.NewRequest(http.MethodPost, "/url/bulk", bytes.NewBuffer(csvPayload))
+	req.Header.Add("Authorization", token.TokenString)
+	req.Header.Set("Content-Type", "text/csv")
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	json.Unmarshal(resp.Body.Bytes(), &bulk)
+	assert.Equal(t, 2, bulk.Payload.Created)
+	assert.Equal(t, uint(5), bulk.Payload.Results[0].ShortenedURL.MaxClicks)
+
+	req, _ = http.NewRequest(http.MethodPost, "/url/bulk?mode=sometimes", bytes.NewBuffer(csvPayload))
+	req.Header.Add("Authorization", token.TokenString)
+	req.Header.Set("Content-Type", "text/csv")
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGetURLsPagination(t *testing.T) {
+	app, _ := setup()
+	token, _ := generateToken(uint(3))
+
+	payload := []byte(`[
+		{"original_url":"https://shop.example.com/a", "tags":["Spring"]},
+		{"original_url":"https://shop.example.com/b", "tags":["spring", "email"]},
+		{"original_url":"https://blog.example.com/c"},
+		{"original_url":"https://shop.example.com/d", "tags":["email"]},
+		{"original_url":"https://blog.example.com/e", "tags":["spring"]}
+	]`)
+	req, _ := http.NewRequest(http.MethodPost, "/url/bulk", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	list := func(query string) urlshortener.GetResponse {
+		req, _ := http.NewRequest(http.MethodGet, "/url?"+query, nil)
+		req.Header.Add("Authorization", token.TokenString)
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusOK, resp.Code, query)
+
+		var page struct {
+			Payload urlshortener.GetResponse `json:"payload"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &page)
+		return page.Payload
+	}
+
+	var seen []string
+	page := list("limit=2&order=asc")
+	for {
+		for _, u := range page.ShortenedURLs {
+			seen = append(seen, u.Original)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		assert.Len(t, page.ShortenedURLs, 2)
+		page = list("limit=2&order=asc&cursor=" + page.NextCursor)
+	}
+	assert.Equal(t, []string{
+		"https://shop.example.com/a",
+		"https://shop.example.com/b",
+		"https://blog.example.com/c",
+		"https://shop.example.com/d",
+		"https://blog.example.com/e",
+	}, seen)
+
+	page = list("tag=spring")
+	assert.Len(t, page.ShortenedURLs, 3)
+
+	page = list("tag=email&q=SHOP")
+	assert.Len(t, page.ShortenedURLs, 2)
+
+	page = list("q=blog&sort=clicks")
+	assert.Len(t, page.ShortenedURLs, 2)
+
+	page = list("created_to=2000-01-01T00:00:00Z")
+	assert.Len(t, page.ShortenedURLs, 0)
+
+	for _, query := range []string{"limit=500", "sort=name", "cursor=garbage", "created_from=yesterday"} {
+		req, _ := http.NewRequest(http.MethodGet, "/url?"+query, nil)
+		req.Header.Add("Authorization", token.TokenString)
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+}
+
+func TestRedirectQuarantinedURL(t *testing.T) {
+	app, db := setup()
+	quarantinedAt := time.Now().UTC()
+	db.Create(&urlshortener.ShortenedURL{
+		Original:         "https://phish.example.com/login",
+		Shortened:        "quarantineTest",
+		UserID:           1,
+		QuarantinedAt:    &quarantinedAt,
+		QuarantineReason: "Domain phish.example.com is blocklisted",
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/r/quarantineTest", nil)
+	resp := executeRequest(req, app)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Location"))
+	assert.Contains(t, resp.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, resp.Body.String(), "flagged as potentially harmful")
+
+	req, _ = http.NewRequest(http.MethodGet, "/lookup/quarantineTest", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"quarantined":true`)
+	assert.NotContains(t, resp.Body.String(), "phish.example.com/login")
+}
+
+func TestUpdateURLAndRollback(t *testing.T) {
+	app, db := setup()
+	token, _ := generateToken(uint(1))
+
+	payload := []byte(`{"original_url":"https://www.example.com/v1", "alias":"flyer-link"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	urlPath := fmt.Sprintf("/url/%d", created.Payload.ShortenedURL.ID)
+
+	payload = []byte(`{"original_url":"https://www.example.com/v2", "redirect_type":"permanent", "alias":"flyer-v2"}`)
+	req, _ = http.NewRequest(http.MethodPatch, urlPath, bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/flyer-v2", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusMovedPermanently, resp.Code)
+	assert.Equal(t, "https://www.example.com/v2", resp.Header().Get("Location"))
+
+	req, _ = http.NewRequest(http.MethodGet, urlPath+"/revisions", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var revisions struct {
+		Payload urlshortener.GetRevisionsResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &revisions)
+	assert.Len(t, revisions.Payload.Revisions, 1)
+	assert.Equal(t, "https://www.example.com/v1", revisions.Payload.Revisions[0].Original)
+
+	rollbackPath := fmt.Sprintf("%s/revisions/%d/rollback", urlPath, revisions.Payload.Revisions[0].ID)
+	req, _ = http.NewRequest(http.MethodPost, rollbackPath, nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/flyer-link", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusFound, resp.Code)
+	assert.Equal(t, "https://www.example.com/v1", resp.Header().Get("Location"))
+
+	// Writing back a stale copy of the link keeps the clicks counted since.
+	var stale urlshortener.ShortenedURL
+	db.First(&stale, created.Payload.ShortenedURL.ID)
+	req, _ = http.NewRequest(http.MethodGet, "/r/flyer-link", nil)
+	executeRequest(req, app)
+
+	stale.Original = "https://www.example.com/v3"
+	assert.Nil(t, urlshortener.NewGormRepository(db).Update(&stale, urlshortener.ColumnOriginal))
+
+	var current urlshortener.ShortenedURL
+	db.First(&current, created.Payload.ShortenedURL.ID)
+	assert.Equal(t, "https://www.example.com/v3", current.Original)
+	assert.Equal(t, stale.Clicks+1, current.Clicks)
+
+	// Only the owner may edit the link
+	other, _ := generateToken(uint(2))
+	req, _ = http.NewRequest(http.MethodPatch, urlPath, bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", other.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	payload = []byte(`{"alias":"dcu.be/test1"}`)
+	req, _ = http.NewRequest(http.MethodPatch, urlPath, bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	payload = []byte(`{"alias":"taken-alias"}`)
+	req, _ = http.NewRequest(http.MethodPatch, urlPath, bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+}
+
+func TestDeleteURLSuccess(t *testing.T) {
+	app, db := setup()
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, "user_id", 1)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, "/url/1", nil)
+	token, _ := generateToken(uint(1))
+	req.Header.Add("Authorization", token.TokenString)
+
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var url urlshortener.ShortenedURL
+	err := db.Model(&urlshortener.ShortenedURL{}).First(&url, urlshortener.ShortenedURL{ID: 1}).Error
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+}
+
+func TestDeleteURLFail(t *testing.T) {
+	app, _ := setup()
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, "user_id", 1)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, "/url/1", nil)
+
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req, _ = http.NewRequestWithContext(ctx, http.MethodDelete, "/url/200", nil)
+	token, _ := generateToken(uint(1))
+	req.Header.Add("Authorization", token.TokenString)
+
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	req, _ = http.NewRequestWithContext(ctx, http.MethodDelete, "/url/3", nil)
+	token, _ = generateToken(uint(1))
+	req.Header.Add("Authorization", token.TokenString)
+
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestTrashAndRestoreURL(t *testing.T) {
+	app, db := setup()
+	token, _ := generateToken(uint(1))
+
+	payload := []byte(`{"original_url":"https://example.com/trash", "alias":"trash-me"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	linkPath := fmt.Sprintf("/url/%d", created.Payload.ShortenedURL.ID)
+
+	req, _ = http.NewRequest(http.MethodDelete, linkPath, nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/trash-me", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url/trash", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "trash-me")
+
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, linkPath+"/restore", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/trash-me", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusFound, resp.Code)
+
+	// Purging retires the code until the reuse delay has passed.
+	repository := urlshortener.NewGormRepository(db)
+	assert.Nil(t, repository.Delete(created.Payload.ShortenedURL.ID, time.Now().Add(time.Hour)))
+
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	released, _ := repository.ReleaseCodes(time.Now().Add(time.Hour))
+	assert.Equal(t, int64(1), released)
+
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+}
+
+func TestPurgeTrashDeletesClicks(t *testing.T) {
+	app, db := setup()
+	token, _ := generateToken(uint(1))
+
+	payload := []byte(`{"original_url":"https://example.com/purge"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	linkID := created.Payload.ShortenedURL.ID
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/"+created.Payload.ShortenedURL.Shortened, nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusFound, resp.Code)
+	analyticsManager.Flush()
+
+	var clicks int64
+	db.Model(&analytics.ClickEvent{}).Where("shortened_url_id = ?", linkID).Count(&clicks)
+	assert.Equal(t, int64(1), clicks)
+
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/url/%d", linkID), nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Age the link past the trash retention so that it is purged.
+	db.Unscoped().Model(&urlshortener.ShortenedURL{}).
+		Where("id = ?", linkID).
+		Update("deleted_at", time.Now().Add(-2*defaultTrashRetention))
+
+	purged, err := urlShortenerManager.PurgeTrash()
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, purged.Purged, int64(1))
+
+	var links int64
+	db.Unscoped().Model(&urlshortener.ShortenedURL{}).Where("id = ?", linkID).Count(&links)
+	assert.Equal(t, int64(0), links)
+
+	db.Model(&analytics.ClickEvent{}).Where("shortened_url_id = ?", linkID).Count(&clicks)
+	assert.Equal(t, int64(0), clicks)
+}
+
+func TestURLQRCode(t *testing.T) {
+	app, _ := setup()
+	token, _ := generateToken(uint(1))
+
+	payload := []byte(`{"original_url":"https://example.com/print", "alias":"qr-me"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	qrPath := fmt.Sprintf("/url/%d/qr", created.Payload.ShortenedURL.ID)
+
+	req, _ = http.NewRequest(http.MethodGet, qrPath, nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "image/png", resp.Header().Get("Content-Type"))
+
+	img, e := png.Decode(resp.Body)
+	assert.Nil(t, e)
+	assert.Equal(t, qrcode.DefaultSize, img.Bounds().Dx())
+
+	// The code encodes the configured public address, not the request's host.
+	assert.Equal(t, "https://dcu.be/r/qr-me", shortLinkURL("qr-me"))
+
+	req, _ = http.NewRequest(http.MethodGet, qrPath+"?format=svg&size=128&ecc=q&fg=ff0000&margin=0", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "image/svg+xml", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Body.String(), `width="128"`)
+	assert.Contains(t, resp.Body.String(), `fill="#ff0000"`)
+
+	for _, query := range []string{"?size=10", "?format=gif", "?fg=red", "?logo=true", "?margin=x"} {
+		req, _ = http.NewRequest(http.MethodGet, qrPath+query, nil)
+		req.Header.Add("Authorization", token.TokenString)
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+
+	token, _ = generateToken(uint(2))
+	req, _ = http.NewRequest(http.MethodGet, qrPath, nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	app, _ := setup()
+	token, _ := generateToken(uint(1))
+
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+	}))
+	defer receiver.Close()
+
+	payload := []byte(`{"url":"` + receiver.URL + `", "events":["link.created","link.clicked"], "click_thresholds":[1]}`)
+	req, _ := http.NewRequest(http.MethodPost, "/webhooks", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload webhook.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	assert.NotEmpty(t, created.Payload.Secret)
+	webhookPath := fmt.Sprintf("/webhooks/%d", created.Payload.Subscription.ID)
+
+	payload = []byte(`{"original_url":"https://example.com/hooked", "alias":"hook-me"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/hook-me", nil)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusFound, resp.Code)
+
+	dispatched, err := webhookManager.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dispatched.Delivered)
+	assert.Len(t, received, 2)
+
+	for i, r := range received {
+		var timestamp int64
+		var signature string
+		fmt.Sscanf(r.Header.Get(webhook.HeaderSignature), "t=%d,v1=%s", &timestamp, &signature)
+		assert.Equal(t, webhook.Sign(created.Payload.Secret, timestamp, bodies[i]), signature)
+		assert.Contains(t, string(bodies[i]), `"shortened":"hook-me"`)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, webhookPath+"/deliveries?status=delivered", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var deliveries struct {
+		Payload webhook.DeliveriesResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &deliveries)
+	assert.Len(t, deliveries.Payload.Deliveries, 2)
+	assert.Equal(t, webhook.EventLinkClicked, deliveries.Payload.Deliveries[0].Event)
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks/dead-letters", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"deliveries":[]`)
+
+	req, _ = http.NewRequest(http.MethodGet, webhookPath+"/deliveries?status=lost", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	otherToken, _ := generateToken(uint(2))
+	req, _ = http.NewRequest(http.MethodDelete, webhookPath, nil)
+	req.Header.Add("Authorization", otherToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, webhookPath, nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), receiver.URL)
+}
+
+func TestWorkspaceLinks(t *testing.T) {
+	app, db := setup()
+
+	for _, username := range []string{"wsowner", "wseditor"} {
+		payload := []byte(`{"username":"` + username + `", "password":"password1"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+	}
+
+	var owner, editor user.User
+	db.Where("username = ?", "wsowner").First(&owner)
+	db.Where("username = ?", "wseditor").First(&editor)
+	ownerToken, _ := generateToken(owner.ID)
+	editorToken, _ := generateToken(editor.ID)
+	viewerToken, _ := generateToken(2)
+	outsiderToken, _ := generateToken(3)
+
+	req, _ := http.NewRequest(http.MethodPost, "/workspaces", bytes.NewBuffer([]byte(`{"name":"Team"}`)))
+	req.Header.Add("Authorization", ownerToken.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload workspace.WorkspaceResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	id := fmt.Sprint(created.Payload.Workspace.ID)
+
+	for username, role := range map[string]string{"wseditor": "editor", "test2": "viewer"} {
+		payload := []byte(`{"username":"` + username + `", "role":"` + role + `"}`)
+		req, _ = http.NewRequest(http.MethodPost, "/workspaces/"+id+"/members", bytes.NewBuffer(payload))
+		req.Header.Add("Authorization", ownerToken.TokenString)
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+	}
+
+	payload := []byte(`{"original_url":"https://example.com/team", "workspace_id":` + id + `}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", viewerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", editorToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var link struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &link)
+	linkID := fmt.Sprint(link.Payload.ShortenedURL.ID)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url?workspace="+id, nil)
+	req.Header.Add("Authorization", viewerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "https://example.com/team")
+
+	req, _ = http.NewRequest(http.MethodGet, "/url?workspace="+id, nil)
+	req.Header.Add("Authorization", outsiderToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/url/"+linkID, nil)
+	req.Header.Add("Authorization", viewerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	// The workspace keeps the editor's link when their account is deleted.
+	req, _ = http.NewRequest(http.MethodDelete, "/me", bytes.NewBuffer([]byte(`{"password":"password1"}`)))
+	req.Header.Add("Authorization", editorToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var stored urlshortener.ShortenedURL
+	db.First(&stored, link.Payload.ShortenedURL.ID)
+	assert.Equal(t, owner.ID, stored.UserID)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/url/"+linkID, nil)
+	req.Header.Add("Authorization", ownerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// An owner left as the only member can still delete their account, which
+	// deletes the workspace and its links.
+	req, _ = http.NewRequest(http.MethodDelete, "/workspaces/"+id+"/members/test2", nil)
+	req.Header.Add("Authorization", ownerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/me", bytes.NewBuffer([]byte(`{"password":"password1"}`)))
+	req.Header.Add("Authorization", ownerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var workspaces, links int64
+	db.Model(&workspace.Workspace{}).Where("id = ?", created.Payload.Workspace.ID).Count(&workspaces)
+	db.Unscoped().Model(&urlshortener.ShortenedURL{}).Where("id = ?", link.Payload.ShortenedURL.ID).Count(&links)
+	assert.Equal(t, int64(0), workspaces)
+	assert.Equal(t, int64(0), links)
+}
+
+func TestRemoveWorkspaceMemberRollsBack(t *testing.T) {
+	app, db := setup()
+
+	for _, username := range []string{"rbowner", "rbeditor"} {
+		payload := []byte(`{"username":"` + username + `", "password":"password1"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+	}
+
+	var owner, editor user.User
+	db.Where("username = ?", "rbowner").First(&owner)
+	db.Where("username = ?", "rbeditor").First(&editor)
+	ownerToken, _ := generateToken(owner.ID)
+	editorToken, _ := generateToken(editor.ID)
+
+	req, _ := http.NewRequest(http.MethodPost, "/workspaces", bytes.NewBuffer([]byte(`{"name":"Rollback"}`)))
+	req.Header.Add("Authorization", ownerToken.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload workspace.WorkspaceResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	id := fmt.Sprint(created.Payload.Workspace.ID)
+
+	payload := []byte(`{"username":"rbeditor", "role":"editor"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/workspaces/"+id+"/members", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", ownerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	payload = []byte(`{"original_url":"https://example.com/rollback", "workspace_id":` + id + `}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", editorToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var link struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &link)
+
+	// If the links cannot be handed over, the editor stays a member.
+	t.Run("transfer fails", func(t *testing.T) {
+		failWrites(t, db, "shortened_urls")
+
+		req, _ = http.NewRequest(http.MethodDelete, "/workspaces/"+id+"/members/rbeditor", nil)
+		req.Header.Add("Authorization", ownerToken.TokenString)
+		resp = executeRequest(req, app)
+		assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	})
+
+	var members int64
+	db.Model(&workspace.Membership{}).
+		Where("workspace_id = ? AND user_id = ?", created.Payload.Workspace.ID, editor.ID).
+		Count(&members)
+	assert.Equal(t, int64(1), members)
+
+	var stored urlshortener.ShortenedURL
+	db.First(&stored, link.Payload.ShortenedURL.ID)
+	assert.Equal(t, editor.ID, stored.UserID)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/workspaces/"+id+"/members/rbeditor", nil)
+	req.Header.Add("Authorization", ownerToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	db.Model(&workspace.Membership{}).
+		Where("workspace_id = ? AND user_id = ?", created.Payload.Workspace.ID, editor.ID).
+		Count(&members)
+	assert.Equal(t, int64(0), members)
+
+	db.First(&stored, link.Payload.ShortenedURL.ID)
+	assert.Equal(t, owner.ID, stored.UserID)
+}
+
+func TestAPIKeys(t *testing.T) {
+	app, _ := setup()
+	token, _ := generateToken(1)
+
+	payload := []byte(`{"name":"ci", "scopes":["links:read"]}`)
+	req, _ := http.NewRequest(http.MethodPost, "/me/keys", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", token.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		Payload apikey.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	secret := created.Payload.Secret
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", secret)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Authorization"))
+
+	payload = []byte(`{"original_url":"https://example.com/ci"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", secret)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	// Keys cannot manage the account, including other keys.
+	req, _ = http.NewRequest(http.MethodGet, "/me/keys", nil)
+	req.Header.Add("Authorization", secret)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/me/keys", nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), created.Payload.Key.Prefix)
+	assert.NotContains(t, resp.Body.String(), secret)
+
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/me/keys/%d", created.Payload.Key.ID), nil)
+	req.Header.Add("Authorization", token.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", secret)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAdminConsole(t *testing.T) {
+	app, db := setup()
+
+	for _, username := range []string{"console", "suspect"} {
+		payload := []byte(`{"username":"` + username + `", "password":"password1"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+	}
+
+	var admin, suspect user.User
+	db.Where("username = ?", "console").First(&admin)
+	db.Where("username = ?", "suspect").First(&suspect)
+	adminToken, _ := generateToken(admin.ID)
+	suspectToken, _ := generateToken(suspect.ID)
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/stats", nil)
+	req.Header.Add("Authorization", adminToken.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	db.Model(&admin).Update("role", user.RoleAdmin)
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/stats", nil)
+	req.Header.Add("Authorization", adminToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/users?q=suspect", nil)
+	req.Header.Add("Authorization", adminToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), fmt.Sprintf(`"id":%d`, suspect.ID))
+
+	payload := []byte(`{"original_url":"https://example.com/suspect"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", suspectToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var link struct {
+		Payload urlshortener.CreateResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &link)
+	linkPath := fmt.Sprintf("/admin/urls/%d", link.Payload.ShortenedURL.ID)
+
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/admin/urls?user_id=%d", suspect.ID), nil)
+	req.Header.Add("Authorization", adminToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "https://example.com/suspect")
+
+	payload = []byte(`{"reason":"Reported as phishing"}`)
+	req, _ = http.NewRequest(http.MethodPost, linkPath+"/quarantine", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", adminToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/r/"+link.Payload.ShortenedURL.Shortened, nil)
+	resp = executeRequest(req, app)
+	assert.Contains(t, resp.Body.String(), "Reported as phishing")
+
+	payload = []byte(fmt.Sprintf(`{"user_id":%d}`, admin.ID))
+	req, _ = http.NewRequest(http.MethodPost, linkPath+"/transfer", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", adminToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	payload = []byte(`{"disabled":true}`)
+	req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/admin/users/%d", suspect.ID), bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", adminToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	payload = []byte(`{"username":"suspect", "password":"password1"}`)
+	req, _ = http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	// A profile update made from a copy read before the account was disabled
+	// does not enable it again.
+	suspect.DisplayName = "Stale"
+	assert.Nil(t, user.NewGormRepository(db).Update(&suspect, user.ColumnDisplayName))
+
+	var stored user.User
+	db.First(&stored, suspect.ID)
+	assert.Equal(t, "Stale", stored.DisplayName)
+	assert.NotNil(t, stored.DisabledAt)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", suspectToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAuditLog(t *testing.T) {
+	app, db := setup()
+
+	for _, username := range []string{"auditor", "audited"} {
+		payload := []byte(`{"username":"` + username + `", "password":"password1"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(payload))
+		resp := executeRequest(req, app)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+	}
+
+	var auditor, audited user.User
+	db.Where("username = ?", "auditor").First(&auditor)
+	db.Where("username = ?", "audited").First(&audited)
+	auditorToken, _ := generateToken(auditor.ID)
+	auditedToken, _ := generateToken(audited.ID)
+
+	payload := []byte(`{"original_url":"https://example.com/audited"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/url", bytes.NewBuffer(payload))
+	req.Header.Add("Authorization", auditedToken.TokenString)
+	req.Header.Add("X-Request-ID", "audit-test-1")
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "audit-test-1", resp.Header().Get("X-Request-ID"))
+
+	var trail struct {
+		Payload audit.ListResponse `json:"payload"`
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/me/audit", nil)
+	req.Header.Add("Authorization", auditedToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	json.Unmarshal(resp.Body.Bytes(), &trail)
+	assert.Len(t, trail.Payload.Entries, 2)
+	assert.Equal(t, audit.ActionURLCreate, trail.Payload.Entries[0].Action)
+	assert.Equal(t, "audit-test-1", trail.Payload.Entries[0].RequestID)
+	assert.Contains(t, string(trail.Payload.Entries[0].After), "https://example.com/audited")
+	assert.Equal(t, audit.ActionSignUp, trail.Payload.Entries[1].Action)
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/audit", nil)
+	req.Header.Add("Authorization", auditedToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	db.Model(&user.User{}).Where("username = ?", "auditor").Update("role", user.RoleAdmin)
+
+	path := fmt.Sprintf("/admin/audit?actor_id=%d&action=%s", audited.ID, audit.ActionURLCreate)
+	req, _ = http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Add("Authorization", auditorToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	json.Unmarshal(resp.Body.Bytes(), &trail)
+	assert.Len(t, trail.Payload.Entries, 1)
+
+	var verified struct {
+		Payload audit.VerifyResponse `json:"payload"`
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/audit/verify", nil)
+	req.Header.Add("Authorization", auditorToken.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	json.Unmarshal(resp.Body.Bytes(), &verified)
+	assert.True(t, verified.Payload.Valid)
+
+	db.Model(&audit.Entry{}).Where("id = ?", trail.Payload.Entries[0].ID).Update("after", `{"original":"x"}`)
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/audit/verify", nil)
+	req.Header.Add("Authorization", auditorToken.TokenString)
+	resp = executeRequest(req, app)
+	json.Unmarshal(resp.Body.Bytes(), &verified)
+	assert.False(t, verified.Payload.Valid)
+	assert.Equal(t, trail.Payload.Entries[0].ID, verified.Payload.BrokenAt)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	app, _ := setup()
+	payload := []byte(`{"username":"test1", "password":"password1"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(payload))
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var signIn struct {
+		Payload session.TokenResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &signIn)
+	assert.NotEmpty(t, signIn.Payload.RefreshToken)
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		payload := []byte(`{"refresh_token":"` + token + `"}`)
+		req, _ := http.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(payload))
+		return executeRequest(req, app)
+	}
+
+	resp = refresh(signIn.Payload.RefreshToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	accessToken := resp.Header().Get("Authorization")
+	assert.NotEmpty(t, accessToken)
+
+	var rotated struct {
+		Payload session.TokenResponse `json:"payload"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &rotated)
+	assert.NotEqual(t, signIn.Payload.RefreshToken, rotated.Payload.RefreshToken)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", accessToken)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Reusing an exchanged refresh token revokes the whole session
+	resp = refresh(signIn.Payload.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = refresh(rotated.Payload.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", accessToken)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = refresh("not-a-real-token")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestSignOut(t *testing.T) {
+	app, _ := setup()
+	first, _ := generateToken(uint(1))
+	second, _ := generateToken(uint(1))
+	other, _ := generateToken(uint(2))
+
+	req, _ := http.NewRequest(http.MethodPost, "/signout", nil)
+	req.Header.Add("Authorization", first.TokenString)
+	resp := executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", first.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// Other sessions are unaffected by a single sign out
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", second.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/signout/all", nil)
+	req.Header.Add("Authorization", second.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", second.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/url", nil)
+	req.Header.Add("Authorization", other.TokenString)
+	resp = executeRequest(req, app)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func generateToken(userID uint) (session.Session, error) {
+	resp, err := sessionManager.CreateSession(userID)
+
+	if err != nil {
+		return session.Session{}, errors.New(err.Message())
+	}
+
+	return resp.AccessToken, nil
+}
+
+// currentTOTPCode computes the code an authenticator app would show for
+// secret right now.
+func currentTOTPCode(secret string) string {
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// failWrites makes updates and deletes of table fail until the test ends.
+func failWrites(t *testing.T, db *gorm.DB, table string) {
+	name := "test:fail_" + table
+	fail := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			tx.AddError(errors.New("injected failure"))
+		}
+	}
+
+	db.Callback().Update().Before("gorm:update").Register(name, fail)
+	db.Callback().Delete().Before("gorm:delete").Register(name, fail)
+	t.Cleanup(func() {
+		db.Callback().Update().Remove(name)
+		db.Callback().Delete().Remove(name)
+	})
 }
 
 func executeRequest(req *http.Request, app *Application) *httptest.ResponseRecorder {
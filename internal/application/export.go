@@ -0,0 +1,66 @@
+package application
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/analytics"
+	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
+	"github.com/Imranr2/DCUBE_API/internal/user"
+)
+
+const (
+	exportFormatJSON = "json"
+	exportFormatZIP  = "zip"
+)
+
+// accountExport is the data portability archive for a single account.
+type accountExport struct {
+	ExportedAt time.Time                  `json:"exported_at"`
+	User       user.User                  `json:"user"`
+	Logins     []user.LoginAttempt        `json:"logins"`
+	URLs       []urlshortener.ExportedURL `json:"urls"`
+	Clicks     []analytics.ExportedClick  `json:"clicks"`
+}
+
+// zip packs the export as one JSON file per section.
+func (e accountExport) zip() ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"account.json", struct {
+			ExportedAt time.Time `json:"exported_at"`
+			User       user.User `json:"user"`
+		}{e.ExportedAt, e.User}},
+		{"logins.json", e.Logins},
+		{"urls.json", e.URLs},
+		{"clicks.json", e.Clicks},
+	}
+
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: e.ExportedAt})
+
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
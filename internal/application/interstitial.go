@@ -0,0 +1,34 @@
+package application
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
+)
+
+// interstitialTemplate is shown instead of redirecting to a quarantined link.
+// The destination is printed as plain text so that it cannot be followed
+// with a single click.
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Warning: suspicious link</title>
+</head>
+<body>
+<h1>This link has been flagged as potentially harmful</h1>
+<p>{{.QuarantineReason}}</p>
+<p>It points to: <code>{{.OriginalURL}}</code></p>
+<p>We recommend that you do not visit this address.</p>
+</body>
+</html>
+`))
+
+func (app *Application) renderInterstitial(w http.ResponseWriter, resp *urlshortener.RedirectResponse) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	interstitialTemplate.Execute(w, resp)
+}
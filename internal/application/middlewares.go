@@ -2,9 +2,20 @@ package application
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/Imranr2/DCUBE_API/internal/apikey"
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"github.com/Imranr2/DCUBE_API/internal/ratelimit"
 	"github.com/Imranr2/DCUBE_API/internal/session"
+	"github.com/Imranr2/DCUBE_API/internal/utils"
+	"github.com/gorilla/mux"
 )
 
 func commonMiddleware(next http.Handler) http.Handler {
@@ -14,24 +25,88 @@ func commonMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// maxRequestIDLength bounds request IDs taken from the X-Request-ID header.
+const maxRequestIDLength = 64
+
+// requestIDMiddleware tags every request with an ID that is returned in the
+// X-Request-ID header and recorded in the audit log. An ID set by a proxy in
+// front of the API is kept if it looks sane.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+
+		if !isValidRequestID(requestID) {
+			raw := make([]byte, 16)
+			rand.Read(raw)
+			requestID = hex.EncodeToString(raw)
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := context.WithValue(r.Context(), "request_id", requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range requestID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// tokenValidatorMiddleware accepts either a session token or an API key. For
+// API keys, the key's scopes are added to the request context so that
+// scopeMiddleware can restrict what the key is used for.
 func tokenValidatorMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, err := session.VerifyToken(r)
+		if token, err := session.GetToken(r); err == nil && apikey.IsAPIKey(token) {
+			key, err := apiKeyManager.Authenticate(token)
+			if err != nil {
+				w.WriteHeader(err.StatusCode())
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user_id", key.UserID)
+			ctx = context.WithValue(ctx, "api_key_scopes", key.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		claims, err := session.VerifyToken(r)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "user_id", id)
+		ctx := context.WithValue(r.Context(), "user_id", claims.ID)
+		ctx = context.WithValue(ctx, "session_id", claims.SessionID)
 		next.ServeHTTP(w, r.WithContext((ctx)))
 	})
 }
 
+// setAuthHeaderMiddleware renews the session token on every request. Requests
+// made with an API key are left alone, since a session token would escape the
+// key's scopes.
 func setAuthHeaderMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, _ := r.Context().Value("user_id").(uint)
+		sessionID, _ := r.Context().Value("session_id").(string)
+
+		if sessionID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		newToken, err := session.GenerateToken(userID)
+		newToken, err := session.GenerateToken(userID, sessionID)
 
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -42,3 +117,121 @@ func setAuthHeaderMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// scopeMiddleware restricts requests made with an API key to keys holding
+// readScope for GET and HEAD requests and writeScope for anything else.
+// Session tokens are not restricted. It must run after
+// tokenValidatorMiddleware.
+func (app *Application) scopeMiddleware(readScope string, writeScope string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := r.Context().Value("api_key_scopes").(apikey.Scopes)
+
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scope := writeScope
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = readScope
+			}
+
+			if !scopes.Contains(scope) {
+				app.respondWithError(w, dcubeerrs.New(http.StatusForbidden, "API key is missing the "+scope+" scope"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sessionOnlyMiddleware rejects API keys on routes that manage the account
+// itself, including its API keys.
+func (app *Application) sessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("api_key_scopes").(apikey.Scopes); ok {
+			app.respondWithError(w, dcubeerrs.New(http.StatusForbidden, "API keys cannot be used for this endpoint"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminMiddleware restricts routes to administrators. It must run after
+// tokenValidatorMiddleware.
+func (app *Application) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value("user_id").(uint)
+
+		if err := userManager.RequireAdmin(userID); err != nil {
+			app.respondWithError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rate limit policies. Authentication endpoints are strict to slow down
+// credential stuffing, redirects are generous since they are public traffic.
+// Sign-in, sign-up, password resets and token refreshes each have their own
+// bucket so that routine refreshes cannot lock a client out of signing in.
+var (
+	signInRateLimit   = ratelimit.Policy{Name: "signin", Limit: 10, Period: time.Minute}
+	signUpRateLimit   = ratelimit.Policy{Name: "signup", Limit: 10, Period: time.Minute}
+	passwordRateLimit = ratelimit.Policy{Name: "password", Limit: 10, Period: time.Minute}
+	refreshRateLimit  = ratelimit.Policy{Name: "refresh", Limit: 60, Period: time.Minute}
+	redirectRateLimit = ratelimit.Policy{Name: "redirect", Limit: 600, Period: time.Minute}
+	apiRateLimit      = ratelimit.Policy{Name: "api", Limit: 300, Period: time.Minute}
+	createRateLimit   = ratelimit.Policy{Name: "create", Limit: 60, Period: time.Minute}
+)
+
+// rateLimitMiddleware enforces policy per user, or per client IP for requests
+// without an authenticated user. It must run after tokenValidatorMiddleware
+// to see the user. Requests are let through if the store is unavailable.
+func (app *Application) rateLimitMiddleware(policy ratelimit.Policy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := rateLimitStore.Take(rateLimitKey(policy, r), policy, time.Now())
+
+			if err != nil {
+				log.Printf("rate limit: %s", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds())))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				app.respondWithError(w, dcubeerrs.New(http.StatusTooManyRequests, "Too many requests, please try again later"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimited applies policy to a single route.
+func (app *Application) rateLimited(policy ratelimit.Policy, handler http.HandlerFunc) http.Handler {
+	return app.rateLimitMiddleware(policy)(handler)
+}
+
+func rateLimitKey(policy ratelimit.Policy, r *http.Request) string {
+	if userID, ok := r.Context().Value("user_id").(uint); ok {
+		return fmt.Sprintf("%s:user:%d", policy.Name, userID)
+	}
+
+	return fmt.Sprintf("%s:ip:%s", policy.Name, utils.GetClientIP(r))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Anchor keeps the head of the chain outside the audit table, so that
+// entries removed from the end of the log are noticed. The head only ever
+// moves forward.
+type Anchor interface {
+	// Load returns the anchored head, or nil if nothing has been anchored.
+	Load() (*Head, error)
+	// Store anchors head unless a later entry is anchored already.
+	Store(head Head) error
+}
+
+// FileAnchor keeps the head in a file, which should live outside the
+// database and be writable only by the service.
+type FileAnchor struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileAnchor(path string) *FileAnchor {
+	return &FileAnchor{path: path}
+}
+
+func (a *FileAnchor) Load() (*Head, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.load()
+}
+
+func (a *FileAnchor) load() (*Head, error) {
+	data, err := os.ReadFile(a.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var head Head
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+
+	return &head, nil
+}
+
+// Store writes the head to a temporary file and renames it into place, so
+// that a crash cannot leave a partly written anchor.
+func (a *FileAnchor) Store(head Head) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	current, err := a.load()
+
+	if err != nil {
+		return err
+	}
+	if current != nil && current.ID >= head.ID {
+		return nil
+	}
+
+	data, _ := json.Marshal(head)
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), ".audit-anchor-*")
+
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), a.path)
+}
+
+// MemoryAnchor keeps the head in process memory. It is meant for tests and
+// local development, not for production use.
+type MemoryAnchor struct {
+	mu   sync.Mutex
+	head *Head
+}
+
+func NewMemoryAnchor() *MemoryAnchor {
+	return &MemoryAnchor{}
+}
+
+func (a *MemoryAnchor) Load() (*Head, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.head == nil {
+		return nil, nil
+	}
+
+	head := *a.head
+
+	return &head, nil
+}
+
+func (a *MemoryAnchor) Store(head Head) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.head == nil || a.head.ID < head.ID {
+		a.head = &head
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionSignUp         = "user.signup"
+	ActionSignIn         = "user.signin"
+	ActionPasswordChange = "user.password_change"
+	ActionPasswordReset  = "user.password_reset"
+	ActionProfileUpdate  = "user.profile_update"
+	ActionTwoFactorOn    = "user.2fa_enable"
+	ActionTwoFactorOff   = "user.2fa_disable"
+	ActionAccountDelete  = "user.delete"
+	ActionAdminUpdate    = "user.admin_update"
+	ActionKeyCreate      = "api_key.create"
+	ActionKeyRevoke      = "api_key.revoke"
+	ActionURLCreate      = "url.create"
+	ActionURLUpdate      = "url.update"
+	ActionURLRollback    = "url.rollback"
+	ActionURLDelete      = "url.delete"
+	ActionURLRestore     = "url.restore"
+	ActionURLExpire      = "url.expire"
+	ActionURLQuarantine  = "url.quarantine"
+	ActionURLRelease     = "url.release"
+	ActionURLTransfer    = "url.transfer"
+	ActionWebhookCreate  = "webhook.create"
+	ActionWebhookDelete  = "webhook.delete"
+)
+
+// Kinds of record an entry can target.
+const (
+	TargetUser    = "user"
+	TargetURL     = "url"
+	TargetAPIKey  = "api_key"
+	TargetWebhook = "webhook"
+)
+
+// Entry is one record of the audit log. Entries are never deleted, and only
+// updated to redact the personal fields of deleted accounts. Each one stores
+// the hash of the entry before it, so that changing or removing an entry
+// breaks the chain from that point on. The hash covers digests of the
+// snapshots, both as recorded and as they will read once redacted, rather
+// than the snapshots themselves, so that redacting them does not break the
+// chain but any other edit does.
+type Entry struct {
+	ID         uint     `json:"id" gorm:"primaryKey"`
+	ActorID    *uint    `json:"actorId,omitempty" gorm:"index"`
+	Action     string   `json:"action" gorm:"index;not null"`
+	TargetType string   `json:"targetType" gorm:"index:idx_audit_target;not null"`
+	TargetID   uint     `json:"targetId" gorm:"index:idx_audit_target;not null"`
+	Before     Snapshot `json:"before" gorm:"type:text"`
+	After      Snapshot `json:"after" gorm:"type:text"`
+	// BeforeDigest and AfterDigest are the SHA-256 digests of the snapshots
+	// as they were recorded.
+	BeforeDigest string `json:"-" gorm:"not null;default:''"`
+	AfterDigest  string `json:"-" gorm:"not null;default:''"`
+	// RedactedBeforeDigest and RedactedAfterDigest are the digests of the
+	// snapshots with their personal fields redacted, which they must match
+	// once RedactedAt is set.
+	RedactedBeforeDigest string     `json:"-" gorm:"not null;default:''"`
+	RedactedAfterDigest  string     `json:"-" gorm:"not null;default:''"`
+	RedactedAt           *time.Time `json:"redactedAt,omitempty"`
+	RequestID            string     `json:"requestId"`
+	IP                   string     `json:"ip"`
+	CreatedAt            time.Time  `json:"createdAt" gorm:"not null"`
+	// PrevHash is unique so that two entries appended concurrently cannot
+	// both follow the same entry.
+	PrevHash string `json:"prevHash" gorm:"uniqueIndex;not null"`
+	Hash     string `json:"hash" gorm:"uniqueIndex;not null"`
+}
+
+// Snapshot is the JSON encoding of a record before or after a change.
+type Snapshot string
+
+func NewSnapshot(v interface{}) (Snapshot, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	encoded, err := json.Marshal(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	return Snapshot(encoded), nil
+}
+
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte("null"), nil
+	}
+
+	return []byte(s), nil
+}
+
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = ""
+	} else {
+		*s = Snapshot(data)
+	}
+
+	return nil
+}
+
+// Digest returns the hex encoded SHA-256 digest of the snapshot, or an empty
+// string for an empty snapshot.
+func (s Snapshot) Digest() string {
+	if s == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// personalFields are the keys of account snapshots that identify a person.
+var personalFields = []string{"username", "displayName", "email"}
+
+const redacted = "[redacted]"
+
+// redact replaces the personal fields of a JSON object snapshot. Other
+// snapshots are returned unchanged.
+func (s Snapshot) redact() Snapshot {
+	var fields map[string]json.RawMessage
+
+	if s == "" || json.Unmarshal([]byte(s), &fields) != nil {
+		return s
+	}
+
+	for _, field := range personalFields {
+		if _, ok := fields[field]; ok {
+			fields[field], _ = json.Marshal(redacted)
+		}
+	}
+
+	encoded, err := json.Marshal(fields)
+
+	if err != nil {
+		return s
+	}
+
+	return Snapshot(encoded)
+}
+
+// computeHash returns the HMAC-SHA256, keyed with key, of the entry's fields
+// together with the hash of the entry before it. Without the key, an edited
+// entry and those after it cannot be rehashed to match.
+func (e *Entry) computeHash(key []byte) string {
+	fields, _ := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.ActorID,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.BeforeDigest,
+		e.AfterDigest,
+		e.RedactedBeforeDigest,
+		e.RedactedAfterDigest,
+		e.RequestID,
+		e.IP,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	mac := hmac.New(sha256.New, key)
+	mac.Write(fields)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Head identifies the newest entry of the chain.
+type Head struct {
+	ID   uint   `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// RecordRequest describes a change to record. Before and After are encoded
+// as JSON and may be nil. With Redact set, their personal fields are redacted
+// before they are stored, for changes to accounts that are being deleted.
+// OccurredAt defaults to the time Record is called.
+type RecordRequest struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   uint
+	Before     interface{}
+	After      interface{}
+	Redact     bool
+	RequestID  string
+	IP         string
+	OccurredAt time.Time
+}
+
+// RedactRequest redacts the personal fields of every snapshot of UserID's
+// account.
+type RedactRequest struct {
+	UserID uint
+}
+
+// ListRequest pages through entries newest first. With SubjectID set, only
+// entries made by that user or about their account are returned.
+type ListRequest struct {
+	SubjectID *uint
+	ActorID   *uint
+	Action    string
+	BeforeID  uint
+	Limit     int
+}
+
+type ListResponse struct {
+	Entries []Entry `json:"entries"`
+	// NextBefore is passed as BeforeID to fetch the next page. It is zero on
+	// the last page.
+	NextBefore uint `json:"next_before,omitempty"`
+}
+
+// VerifyResponse reports whether the chain is intact. BrokenAt is the ID of
+// the first entry that does not match the chain, or of the anchored head if
+// entries after it have been removed. Pending counts the changes that could
+// not be recorded yet and are waiting to be retried.
+type VerifyResponse struct {
+	Valid    bool `json:"valid"`
+	Entries  int  `json:"entries"`
+	BrokenAt uint `json:"broken_at,omitempty"`
+	Pending  int  `json:"pending"`
+}
@@ -0,0 +1,323 @@
+package audit
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+)
+
+// genesisHash is the PrevHash of the first entry.
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// appendAttempts bounds how often Record retries when another process
+// appends to the log at the same time.
+const appendAttempts = 5
+
+// maxPending bounds how many changes are kept for RetryPending when the log
+// cannot be written.
+const maxPending = 10000
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+	verifyBatchSize  = 500
+)
+
+type AuditManager interface {
+	// Record appends a change to the log. A change that cannot be appended
+	// is queued for RetryPending, and the error is still returned.
+	Record(RecordRequest) dcubeerrs.Error
+	// RetryPending records the queued changes, oldest first, and returns how
+	// many were recorded.
+	RetryPending() (int, dcubeerrs.Error)
+	List(ListRequest) (*ListResponse, dcubeerrs.Error)
+	// Verify walks the whole log and checks every entry against the chain
+	// and the chain against its anchor.
+	Verify() (*VerifyResponse, dcubeerrs.Error)
+	// Redact removes the personal fields of a deleted account from the log.
+	Redact(RedactRequest) dcubeerrs.Error
+}
+
+type AuditManagerImpl struct {
+	repository Repository
+	key        []byte
+	anchor     Anchor
+	// mu serialises appends from this process. Appends from other processes
+	// are caught by the unique PrevHash and retried.
+	mu sync.Mutex
+
+	pendingMu sync.Mutex
+	pending   []RecordRequest
+}
+
+// NewAuditManager chains entries with an HMAC keyed with key, which must be
+// kept secret and stay the same for the lifetime of the log.
+func NewAuditManager(repository Repository, key []byte, anchor Anchor) AuditManager {
+	return &AuditManagerImpl{
+		repository: repository,
+		key:        key,
+		anchor:     anchor,
+	}
+}
+
+func (m *AuditManagerImpl) Record(req RecordRequest) dcubeerrs.Error {
+	if req.OccurredAt.IsZero() {
+		req.OccurredAt = time.Now().UTC()
+	}
+
+	entry, e := newEntry(req)
+
+	if e != nil {
+		return e
+	}
+
+	appended, e := m.append(entry)
+
+	if !appended {
+		m.enqueue(req)
+	}
+
+	return e
+}
+
+func newEntry(req RecordRequest) (*Entry, dcubeerrs.Error) {
+	before, err := NewSnapshot(req.Before)
+
+	if err != nil {
+		log.Printf("Error encoding audit snapshot: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while recording the audit log")
+	}
+
+	after, err := NewSnapshot(req.After)
+
+	if err != nil {
+		log.Printf("Error encoding audit snapshot: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while recording the audit log")
+	}
+
+	if req.Redact {
+		before, after = before.redact(), after.redact()
+	}
+
+	return &Entry{
+		ActorID:      req.ActorID,
+		Action:       req.Action,
+		TargetType:   req.TargetType,
+		TargetID:     req.TargetID,
+		Before:       before,
+		After:        after,
+		BeforeDigest: before.Digest(),
+		AfterDigest:  after.Digest(),
+		// Redaction is decided on now, so that a later redaction can be told
+		// apart from any other edit.
+		RedactedBeforeDigest: before.redact().Digest(),
+		RedactedAfterDigest:  after.redact().Digest(),
+		RequestID:            req.RequestID,
+		IP:                   req.IP,
+		// Postgres keeps microseconds, so anything finer would not survive a
+		// round trip and the hash would no longer match.
+		CreatedAt: req.OccurredAt.UTC().Truncate(time.Microsecond),
+	}, nil
+}
+
+// append chains entry onto the log and anchors it. It reports whether the
+// entry was appended; the error may still be set if anchoring failed.
+func (m *AuditManagerImpl) append(entry *Entry) (bool, dcubeerrs.Error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		entry.PrevHash = genesisHash
+		last, err := m.repository.Last()
+
+		switch {
+		case err == nil:
+			entry.PrevHash = last.Hash
+		case !errors.Is(err, ErrNotFound):
+			log.Printf("Error reading audit log: %s", err.Error())
+			return false, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while recording the audit log")
+		}
+
+		entry.ID = 0
+		entry.Hash = entry.computeHash(m.key)
+		err = m.repository.Append(entry)
+
+		if err == nil {
+			if err := m.anchor.Store(Head{ID: entry.ID, Hash: entry.Hash}); err != nil {
+				log.Printf("Error anchoring audit log: %s", err.Error())
+				return true, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while anchoring the audit log")
+			}
+			return true, nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			log.Printf("Error appending to audit log: %s", err.Error())
+			return false, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while recording the audit log")
+		}
+	}
+
+	log.Printf("Error appending to audit log: gave up after %d conflicting attempts", appendAttempts)
+	return false, dcubeerrs.New(http.StatusServiceUnavailable, "The audit log is busy, please try again")
+}
+
+func (m *AuditManagerImpl) enqueue(req RecordRequest) {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+
+	if len(m.pending) >= maxPending {
+		log.Printf("Error recording %s of %s %d: retry queue is full, dropping it", req.Action, req.TargetType, req.TargetID)
+		return
+	}
+
+	m.pending = append(m.pending, req)
+}
+
+// RetryPending stops at the first change that still cannot be recorded, so
+// that queued changes keep their order.
+func (m *AuditManagerImpl) RetryPending() (int, dcubeerrs.Error) {
+	m.pendingMu.Lock()
+	queued := m.pending
+	m.pending = nil
+	m.pendingMu.Unlock()
+
+	for i, req := range queued {
+		entry, e := newEntry(req)
+
+		if e == nil {
+			var appended bool
+			if appended, e = m.append(entry); appended {
+				continue
+			}
+		}
+
+		m.pendingMu.Lock()
+		m.pending = append(queued[i:], m.pending...)
+		m.pendingMu.Unlock()
+
+		return i, e
+	}
+
+	return len(queued), nil
+}
+
+func (m *AuditManagerImpl) pendingCount() int {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+
+	return len(m.pending)
+}
+
+func (m *AuditManagerImpl) List(req ListRequest) (*ListResponse, dcubeerrs.Error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	} else if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	entries, err := m.repository.List(ListFilter{
+		SubjectID: req.SubjectID,
+		ActorID:   req.ActorID,
+		Action:    req.Action,
+		BeforeID:  req.BeforeID,
+		Limit:     limit + 1,
+	})
+
+	if err != nil {
+		log.Printf("Error listing audit log: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while retrieving the audit log")
+	}
+
+	res := &ListResponse{Entries: entries}
+	if len(entries) > limit {
+		res.Entries = entries[:limit]
+		res.NextBefore = res.Entries[limit-1].ID
+	}
+	if res.Entries == nil {
+		res.Entries = []Entry{}
+	}
+
+	return res, nil
+}
+
+func (m *AuditManagerImpl) Verify() (*VerifyResponse, dcubeerrs.Error) {
+	res := &VerifyResponse{Valid: true, Pending: m.pendingCount()}
+	prevHash := genesisHash
+	var afterID uint
+
+	// The anchor is read first so that entries appended during the walk are
+	// not mistaken for a mismatch.
+	head, err := m.anchor.Load()
+
+	if err != nil {
+		log.Printf("Error reading audit anchor: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while verifying the audit log")
+	}
+
+	for {
+		entries, err := m.repository.Range(afterID, verifyBatchSize)
+
+		if err != nil {
+			log.Printf("Error reading audit log: %s", err.Error())
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while verifying the audit log")
+		}
+
+		for _, entry := range entries {
+			if entry.PrevHash != prevHash || entry.computeHash(m.key) != entry.Hash || !entry.matchesSnapshots() ||
+				(head != nil && entry.ID == head.ID && entry.Hash != head.Hash) {
+				res.Valid = false
+				res.BrokenAt = entry.ID
+				return res, nil
+			}
+
+			prevHash = entry.Hash
+			afterID = entry.ID
+			res.Entries++
+		}
+
+		if len(entries) < verifyBatchSize {
+			break
+		}
+	}
+
+	if head != nil && afterID < head.ID {
+		res.Valid = false
+		res.BrokenAt = head.ID
+	}
+
+	return res, nil
+}
+
+// matchesSnapshots reports whether the snapshots are the ones recorded, or
+// their redacted form once the entry has been redacted.
+func (e *Entry) matchesSnapshots() bool {
+	if e.RedactedAt != nil {
+		return e.Before.Digest() == e.RedactedBeforeDigest && e.After.Digest() == e.RedactedAfterDigest
+	}
+
+	return e.Before.Digest() == e.BeforeDigest && e.After.Digest() == e.AfterDigest
+}
+
+func (m *AuditManagerImpl) Redact(req RedactRequest) dcubeerrs.Error {
+	err := m.repository.Redact(TargetUser, req.UserID, Snapshot.redact, time.Now().UTC())
+
+	if err != nil {
+		log.Printf("Error redacting audit log: %s", err.Error())
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while redacting the audit log")
+	}
+
+	// Changes still waiting to be recorded are redacted when they are.
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+
+	for i := range m.pending {
+		if m.pending[i].TargetType == TargetUser && m.pending[i].TargetID == req.UserID {
+			m.pending[i].Redact = true
+		}
+	}
+
+	return nil
+}
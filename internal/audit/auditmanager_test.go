@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("audit-test-key")
+
+func newTestManager(repository Repository) (AuditManager, Anchor) {
+	anchor := NewMemoryAnchor()
+	return NewAuditManager(repository, testKey, anchor), anchor
+}
+
+func record(t *testing.T, manager AuditManager, actorID uint, action string, targetType string, targetID uint) {
+	err := manager.Record(RecordRequest{
+		ActorID:    &actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		After:      map[string]uint{"id": targetID},
+	})
+	assert.Nil(t, err)
+}
+
+func TestRecordAndList(t *testing.T) {
+	manager, _ := newTestManager(NewMemoryRepository())
+	record(t, manager, 1, ActionSignUp, TargetUser, 1)
+	record(t, manager, 1, ActionURLCreate, TargetURL, 7)
+	record(t, manager, 2, ActionSignUp, TargetUser, 2)
+	record(t, manager, 2, ActionAdminUpdate, TargetUser, 1)
+
+	subject := uint(1)
+	trail, err := manager.List(ListRequest{SubjectID: &subject})
+	assert.Nil(t, err)
+	assert.Len(t, trail.Entries, 3)
+	assert.Equal(t, ActionAdminUpdate, trail.Entries[0].Action)
+	assert.Equal(t, Snapshot(`{"id":1}`), trail.Entries[0].After)
+	assert.Zero(t, trail.NextBefore)
+
+	page, _ := manager.List(ListRequest{Limit: 3})
+	assert.Len(t, page.Entries, 3)
+	assert.Equal(t, uint(2), page.NextBefore)
+
+	page, _ = manager.List(ListRequest{Limit: 3, BeforeID: page.NextBefore})
+	assert.Len(t, page.Entries, 1)
+	assert.Equal(t, ActionSignUp, page.Entries[0].Action)
+
+	signups, _ := manager.List(ListRequest{Action: ActionSignUp})
+	assert.Len(t, signups.Entries, 2)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	repository := NewMemoryRepository()
+	manager, _ := newTestManager(repository)
+
+	verified, err := manager.Verify()
+	assert.Nil(t, err)
+	assert.True(t, verified.Valid)
+
+	for id := uint(1); id <= 3; id++ {
+		record(t, manager, 1, ActionURLUpdate, TargetURL, id)
+	}
+
+	verified, _ = manager.Verify()
+	assert.True(t, verified.Valid)
+	assert.Equal(t, 3, verified.Entries)
+
+	entries := repository.(*MemoryRepository).entries
+	entries[1].After = `{"id":9}`
+
+	verified, _ = manager.Verify()
+	assert.False(t, verified.Valid)
+	assert.Equal(t, uint(2), verified.BrokenAt)
+
+	// Without the key, rewriting the digest and rehashing the edited entry
+	// does not match either.
+	entries[1].AfterDigest = entries[1].After.Digest()
+	entries[1].Hash = entries[1].computeHash([]byte("guessed-key"))
+
+	verified, _ = manager.Verify()
+	assert.False(t, verified.Valid)
+	assert.Equal(t, uint(2), verified.BrokenAt)
+
+	// Rehashing with the key still leaves the next one pointing at the
+	// original.
+	entries[1].Hash = entries[1].computeHash(testKey)
+
+	verified, _ = manager.Verify()
+	assert.False(t, verified.Valid)
+	assert.Equal(t, uint(3), verified.BrokenAt)
+}
+
+func TestVerifyDetectsTruncation(t *testing.T) {
+	repository := NewMemoryRepository().(*MemoryRepository)
+	manager, _ := newTestManager(repository)
+
+	for id := uint(1); id <= 3; id++ {
+		record(t, manager, 1, ActionURLUpdate, TargetURL, id)
+	}
+
+	repository.entries = repository.entries[:2]
+
+	verified, err := manager.Verify()
+	assert.Nil(t, err)
+	assert.False(t, verified.Valid)
+	assert.Equal(t, uint(3), verified.BrokenAt)
+}
+
+func TestRedactKeepsChainValid(t *testing.T) {
+	repository := NewMemoryRepository().(*MemoryRepository)
+	manager, _ := newTestManager(repository)
+	profile := map[string]string{"username": "grace", "email": "grace@example.com", "role": "user"}
+
+	assert.Nil(t, manager.Record(RecordRequest{
+		Action:     ActionProfileUpdate,
+		TargetType: TargetUser,
+		TargetID:   1,
+		After:      profile,
+	}))
+	assert.Nil(t, manager.Record(RecordRequest{
+		Action:     ActionProfileUpdate,
+		TargetType: TargetUser,
+		TargetID:   2,
+		After:      profile,
+	}))
+	assert.Nil(t, manager.Record(RecordRequest{
+		Action:     ActionAccountDelete,
+		TargetType: TargetUser,
+		TargetID:   1,
+		Before:     profile,
+		Redact:     true,
+	}))
+	assert.NotContains(t, string(repository.entries[2].Before), "grace")
+
+	assert.Nil(t, manager.Redact(RedactRequest{UserID: 1}))
+
+	assert.Equal(t, Snapshot(`{"email":"[redacted]","role":"user","username":"[redacted]"}`), repository.entries[0].After)
+	assert.NotNil(t, repository.entries[0].RedactedAt)
+	assert.Contains(t, string(repository.entries[1].After), "grace")
+
+	verified, _ := manager.Verify()
+	assert.True(t, verified.Valid)
+	assert.Equal(t, 3, verified.Entries)
+}
+
+func TestVerifyDetectsForgedRedaction(t *testing.T) {
+	repository := NewMemoryRepository().(*MemoryRepository)
+	manager, _ := newTestManager(repository)
+	profile := map[string]string{"username": "grace", "role": "user"}
+
+	assert.Nil(t, manager.Record(RecordRequest{
+		Action:     ActionAdminUpdate,
+		TargetType: TargetUser,
+		TargetID:   1,
+		After:      profile,
+	}))
+
+	// Marking the entry redacted does not excuse changes other than the
+	// redaction itself.
+	now := time.Now()
+	repository.entries[0].RedactedAt = &now
+	repository.entries[0].After = `{"role":"admin","username":"[redacted]"}`
+
+	verified, _ := manager.Verify()
+	assert.False(t, verified.Valid)
+	assert.Equal(t, uint(1), verified.BrokenAt)
+
+	repository.entries[0].RedactedAfterDigest = repository.entries[0].After.Digest()
+
+	verified, _ = manager.Verify()
+	assert.False(t, verified.Valid)
+	assert.Equal(t, uint(1), verified.BrokenAt)
+
+	repository.entries[0].After = `{"role":"user","username":"[redacted]"}`
+	repository.entries[0].RedactedAfterDigest = repository.entries[0].After.Digest()
+
+	verified, _ = manager.Verify()
+	assert.True(t, verified.Valid)
+}
+
+// failingRepository fails appends while failing is set.
+type failingRepository struct {
+	Repository
+	failing bool
+}
+
+func (r *failingRepository) Append(entry *Entry) error {
+	if r.failing {
+		return errors.New("database unavailable")
+	}
+	return r.Repository.Append(entry)
+}
+
+func TestRecordQueuesFailedAppends(t *testing.T) {
+	repository := &failingRepository{Repository: NewMemoryRepository(), failing: true}
+	manager, _ := newTestManager(repository)
+	occurredAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	err := manager.Record(RecordRequest{Action: ActionSignIn, TargetType: TargetUser, TargetID: 1, OccurredAt: occurredAt})
+	assert.NotNil(t, err)
+
+	verified, _ := manager.Verify()
+	assert.Equal(t, 1, verified.Pending)
+
+	recorded, err := manager.RetryPending()
+	assert.Equal(t, 0, recorded)
+	assert.NotNil(t, err)
+
+	repository.failing = false
+	recorded, err = manager.RetryPending()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, recorded)
+
+	trail, _ := manager.List(ListRequest{})
+	assert.Len(t, trail.Entries, 1)
+	assert.Equal(t, occurredAt, trail.Entries[0].CreatedAt)
+
+	verified, _ = manager.Verify()
+	assert.True(t, verified.Valid)
+	assert.Zero(t, verified.Pending)
+}
+
+func TestFileAnchor(t *testing.T) {
+	anchor := NewFileAnchor(filepath.Join(t.TempDir(), "anchor.json"))
+
+	head, err := anchor.Load()
+	assert.Nil(t, err)
+	assert.Nil(t, head)
+
+	assert.Nil(t, anchor.Store(Head{ID: 2, Hash: "b"}))
+	assert.Nil(t, anchor.Store(Head{ID: 1, Hash: "a"}))
+
+	head, err = anchor.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, &Head{ID: 2, Hash: "b"}, head)
+}
+
+func TestAppendRejectsForks(t *testing.T) {
+	repository := NewMemoryRepository()
+	manager, _ := newTestManager(repository)
+	record(t, manager, 1, ActionSignIn, TargetUser, 1)
+
+	fork := Entry{Action: ActionSignIn, TargetType: TargetUser, TargetID: 1, PrevHash: genesisHash}
+	fork.Hash = fork.computeHash(testKey)
+	assert.ErrorIs(t, repository.Append(&fork), ErrConflict)
+}
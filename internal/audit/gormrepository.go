@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormRepository struct {
+	database *gorm.DB
+}
+
+func NewGormRepository(database *gorm.DB) Repository {
+	return &GormRepository{
+		database: database,
+	}
+}
+
+func (r *GormRepository) Last() (*Entry, error) {
+	var entry Entry
+	err := r.database.Order("id DESC").First(&entry).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (r *GormRepository) Append(entry *Entry) error {
+	err := r.database.Create(entry).Error
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrConflict
+	}
+
+	return err
+}
+
+func (r *GormRepository) List(filter ListFilter) ([]Entry, error) {
+	var entries []Entry
+	query := r.database.Model(&Entry{})
+
+	if filter.SubjectID != nil {
+		query = query.Where(
+			"actor_id = ? OR (target_type = ? AND target_id = ?)",
+			*filter.SubjectID, TargetUser, *filter.SubjectID,
+		)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	err := query.Order("id DESC").Limit(filter.Limit).Find(&entries).Error
+
+	return entries, err
+}
+
+func (r *GormRepository) Range(afterID uint, limit int) ([]Entry, error) {
+	var entries []Entry
+	err := r.database.Where("id > ?", afterID).Order("id").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+func (r *GormRepository) Redact(targetType string, targetID uint, redact func(Snapshot) Snapshot, now time.Time) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		var entries []Entry
+		err := tx.Where("target_type = ? AND target_id = ? AND redacted_at IS NULL", targetType, targetID).
+			Find(&entries).Error
+
+		if err != nil {
+			return err
+		}
+
+		for i := range entries {
+			entries[i].Before = redact(entries[i].Before)
+			entries[i].After = redact(entries[i].After)
+			entries[i].RedactedAt = &now
+
+			err := tx.Model(&entries[i]).Select("before", "after", "redacted_at").Updates(&entries[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
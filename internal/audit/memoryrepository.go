@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps the audit log in process memory. It is meant for
+// tests and local development, not for production use.
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+func NewMemoryRepository() Repository {
+	return &MemoryRepository{}
+}
+
+func (r *MemoryRepository) Last() (*Entry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.entries) == 0 {
+		return nil, ErrNotFound
+	}
+
+	entry := r.entries[len(r.entries)-1]
+
+	return &entry, nil
+}
+
+func (r *MemoryRepository) Append(entry *Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.entries {
+		if existing.PrevHash == entry.PrevHash {
+			return ErrConflict
+		}
+	}
+
+	entry.ID = uint(len(r.entries) + 1)
+	r.entries = append(r.entries, *entry)
+
+	return nil
+}
+
+func (r *MemoryRepository) List(filter ListFilter) ([]Entry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []Entry
+	for i := len(r.entries) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		if matchesFilter(r.entries[i], filter) {
+			entries = append(entries, r.entries[i])
+		}
+	}
+
+	return entries, nil
+}
+
+func matchesFilter(entry Entry, filter ListFilter) bool {
+	switch {
+	case filter.SubjectID != nil && !isActor(entry, *filter.SubjectID) &&
+		(entry.TargetType != TargetUser || entry.TargetID != *filter.SubjectID):
+		return false
+	case filter.ActorID != nil && !isActor(entry, *filter.ActorID):
+		return false
+	case filter.Action != "" && entry.Action != filter.Action:
+		return false
+	case filter.BeforeID != 0 && entry.ID >= filter.BeforeID:
+		return false
+	}
+	return true
+}
+
+func isActor(entry Entry, userID uint) bool {
+	return entry.ActorID != nil && *entry.ActorID == userID
+}
+
+func (r *MemoryRepository) Range(afterID uint, limit int) ([]Entry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if int(afterID) >= len(r.entries) {
+		return nil, nil
+	}
+
+	end := len(r.entries)
+	if int(afterID)+limit < end {
+		end = int(afterID) + limit
+	}
+
+	return append([]Entry(nil), r.entries[afterID:end]...), nil
+}
+
+func (r *MemoryRepository) Redact(
+	targetType string,
+	targetID uint,
+	redact func(Snapshot) Snapshot,
+	now time.Time,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.entries {
+		entry := &r.entries[i]
+
+		if entry.TargetType != targetType || entry.TargetID != targetID || entry.RedactedAt != nil {
+			continue
+		}
+
+		entry.Before = redact(entry.Before)
+		entry.After = redact(entry.After)
+		entry.RedactedAt = &now
+	}
+
+	return nil
+}
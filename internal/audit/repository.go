@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("audit entry not found")
+
+// ErrConflict is returned by Append when another entry already follows the
+// entry named by PrevHash.
+var ErrConflict = errors.New("audit entry already has a successor")
+
+// ListFilter narrows down the entries returned by Repository.List.
+type ListFilter struct {
+	// SubjectID matches entries made by the user or targeting their account.
+	SubjectID *uint
+	ActorID   *uint
+	Action    string
+	BeforeID  uint
+	Limit     int
+}
+
+// Repository abstracts audit log storage so that AuditManagerImpl does not
+// depend on a particular database. It has no way to remove entries, and the
+// only change it allows is redacting snapshots.
+type Repository interface {
+	// Last returns the newest entry, or ErrNotFound if the log is empty.
+	Last() (*Entry, error)
+	Append(entry *Entry) error
+	// List returns matching entries newest first.
+	List(filter ListFilter) ([]Entry, error)
+	// Range returns up to limit entries after afterID, oldest first.
+	Range(afterID uint, limit int) ([]Entry, error)
+	// Redact rewrites the snapshots of the unredacted entries targeting
+	// targetType targetID with redact, and marks them as redacted at now.
+	Redact(targetType string, targetID uint, redact func(Snapshot) Snapshot, now time.Time) error
+}
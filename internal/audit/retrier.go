@@ -0,0 +1,28 @@
+package audit
+
+import (
+	"log"
+	"time"
+)
+
+// RunRetrier periodically records the changes that could not be recorded
+// when they happened. It blocks until stop is closed.
+func RunRetrier(manager AuditManager, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			recorded, err := manager.RetryPending()
+			if recorded > 0 {
+				log.Printf("audit retrier: recorded %d queued changes", recorded)
+			}
+			if err != nil {
+				log.Printf("audit retrier: %s", err.Message())
+			}
+		}
+	}
+}
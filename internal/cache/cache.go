@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"log"
+	"time"
+)
+
+// Cache stores opaque values by key for a limited time.
+type Cache interface {
+	// Get returns the value stored under key and whether it was found.
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+// Tiered checks each tier in order, usually a fast in-process cache followed
+// by a shared one, and copies values found in a later tier into the earlier
+// ones with a ttl of zero, so every tier but the last must cap ttl itself as
+// LRU does. Writes and deletes go to every tier.
+type Tiered struct {
+	tiers []Cache
+}
+
+func NewTiered(tiers ...Cache) *Tiered {
+	return &Tiered{tiers: tiers}
+}
+
+func (t *Tiered) Get(key string) ([]byte, bool, error) {
+	for i, tier := range t.tiers {
+		value, ok, err := tier.Get(key)
+
+		if err != nil {
+			// A failing tier is treated as a miss so that an unavailable
+			// shared cache only costs a database lookup.
+			log.Printf("cache: get %s: %s", key, err)
+			continue
+		}
+
+		if ok {
+			for _, earlier := range t.tiers[:i] {
+				earlier.Set(key, value, 0)
+			}
+			return value, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+func (t *Tiered) Set(key string, value []byte, ttl time.Duration) error {
+	var firstErr error
+
+	for _, tier := range t.tiers {
+		if err := tier.Set(key, value, ttl); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (t *Tiered) Delete(keys ...string) error {
+	var firstErr error
+
+	for _, tier := range t.tiers {
+		if err := tier.Delete(keys...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEviction(t *testing.T) {
+	lru := NewLRU(2, time.Minute)
+
+	lru.Set("a", []byte("1"), 0)
+	lru.Set("b", []byte("2"), 0)
+	lru.Get("a")
+	lru.Set("c", []byte("3"), 0)
+
+	_, ok, _ := lru.Get("b")
+	assert.False(t, ok)
+
+	value, ok, _ := lru.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 2, lru.Len())
+
+	lru.Delete("a", "c")
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestLRUExpiry(t *testing.T) {
+	lru := NewLRU(10, time.Millisecond)
+
+	lru.Set("a", []byte("1"), time.Hour)
+	time.Sleep(2 * time.Millisecond)
+
+	_, ok, _ := lru.Get("a")
+	assert.False(t, ok)
+}
+
+func TestTieredWithRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	shared, err := NewRedis("redis://"+server.Addr(), "test:")
+	assert.Nil(t, err)
+	defer shared.Close()
+
+	local := NewLRU(10, time.Minute)
+	tiered := NewTiered(local, shared)
+
+	tiered.Set("a", []byte("1"), time.Minute)
+	assert.True(t, server.Exists("test:a"))
+
+	// A miss in the local tier is filled from Redis.
+	local.Delete("a")
+	value, ok, _ := tiered.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 1, local.Len())
+
+	tiered.Delete("a")
+	_, ok, _ = tiered.Get("a")
+	assert.False(t, ok)
+}
+
+func TestRedisInvalidationReachesOtherInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	shared, _ := NewRedis("redis://"+server.Addr(), "test:")
+	defer shared.Close()
+
+	local := NewLRU(10, time.Minute)
+	local.Set("a", []byte("1"), 0)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go shared.ListenForInvalidations(local, stop)
+
+	// Wait for the subscription before publishing.
+	assert.Eventually(t, func() bool { return len(server.PubSubChannels("")) == 1 }, time.Second, time.Millisecond)
+
+	shared.Delete("a")
+
+	assert.Eventually(t, func() bool { return local.Len() == 0 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const invalidationChannel = "dcube:cache:invalidate"
+const redisTimeout = 500 * time.Millisecond
+
+// Redis is a Cache shared between instances, backed by any server speaking
+// the Redis protocol. Deletes are also published so that other instances can
+// drop the keys from their in-process tier.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis connects to the server at url, e.g. redis://localhost:6379/0.
+// Keys are stored under prefix.
+func NewRedis(url string, prefix string) (*Redis, error) {
+	options, err := redis.ParseURL(url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Redis{client: redis.NewClient(options), prefix: prefix}, nil
+}
+
+func (c *Redis) Get(key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set stores value for ttl. A ttl of zero leaves the entry without expiry, so
+// callers should always pass one.
+func (c *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+func (c *Redis) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+
+	if err := c.client.Del(ctx, prefixed...).Err(); err != nil {
+		return err
+	}
+
+	return c.client.Publish(ctx, invalidationChannel, strings.Join(prefixed, "\n")).Err()
+}
+
+// ListenForInvalidations deletes keys from local whenever any instance
+// deletes them from Redis. It blocks until stop is closed.
+func (c *Redis) ListenForInvalidations(local Cache, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pubsub := c.client.Subscribe(ctx, invalidationChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var keys []string
+			for _, key := range strings.Split(message.Payload, "\n") {
+				if strings.HasPrefix(key, c.prefix) {
+					keys = append(keys, strings.TrimPrefix(key, c.prefix))
+				}
+			}
+
+			if err := local.Delete(keys...); err != nil {
+				log.Printf("cache: invalidate: %s", err)
+			}
+		}
+	}
+}
+
+func (c *Redis) Close() error {
+	return c.client.Close()
+}
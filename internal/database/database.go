@@ -5,12 +5,22 @@ import (
 	"log"
 	"os"
 
+	"github.com/Imranr2/DCUBE_API/internal/analytics"
+	"github.com/Imranr2/DCUBE_API/internal/apikey"
+	"github.com/Imranr2/DCUBE_API/internal/audit"
+	"github.com/Imranr2/DCUBE_API/internal/session"
 	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
 	"github.com/Imranr2/DCUBE_API/internal/user"
+	"github.com/Imranr2/DCUBE_API/internal/webhook"
+	"github.com/Imranr2/DCUBE_API/internal/workspace"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const driverSQLite = "sqlite"
+const defaultSQLitePath = "dcube.db"
+
 func getDatabaseURL() (databaseURL string) {
 	if os.Getenv("ENV") == "PROD" {
 		databaseURL = os.Getenv("DATABASE_URL")
@@ -28,8 +38,23 @@ func getDatabaseURL() (databaseURL string) {
 	return
 }
 
+// getDialector picks the database driver from DATABASE_DRIVER. Postgres is the
+// default; "sqlite" runs against a local file so the service can be started
+// without any external dependencies during development.
+func getDialector() gorm.Dialector {
+	if os.Getenv("DATABASE_DRIVER") == driverSQLite {
+		path := os.Getenv("DATABASE_PATH")
+		if path == "" {
+			path = defaultSQLitePath
+		}
+		return sqlite.Open(path)
+	}
+
+	return postgres.Open(getDatabaseURL())
+}
+
 func InitDB() (db *gorm.DB) {
-	db, err := gorm.Open(postgres.Open(getDatabaseURL()), &gorm.Config{})
+	db, err := gorm.Open(getDialector(), &gorm.Config{TranslateError: true})
 
 	if err != nil {
 		log.Fatal("Unable to connect to database")
@@ -37,7 +62,22 @@ func InitDB() (db *gorm.DB) {
 
 	err = db.AutoMigrate(
 		&user.User{},
+		&user.LoginAttempt{},
+		&user.RecoveryCode{},
+		&user.PasswordResetToken{},
 		&urlshortener.ShortenedURL{},
+		&urlshortener.URLRevision{},
+		&urlshortener.CodeSequence{},
+		&urlshortener.RetiredCode{},
+		&workspace.Workspace{},
+		&workspace.Membership{},
+		&analytics.ClickEvent{},
+		&session.LoginSession{},
+		&session.RefreshToken{},
+		&apikey.APIKey{},
+		&audit.Entry{},
+		&webhook.Subscription{},
+		&webhook.Delivery{},
 	)
 
 	if err != nil {
@@ -1,5 +1,10 @@
 package dcubeerrs
 
+import (
+	"net/http"
+	"strings"
+)
+
 type Error interface {
 	StatusCode() int
 	Message() string
@@ -21,3 +26,38 @@ func (e *DcubeError) StatusCode() int {
 func (e *DcubeError) Message() string {
 	return e.message
 }
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is implemented by errors that carry per-field details.
+type FieldErrors interface {
+	Error
+	Fields() []FieldError
+}
+
+type ValidationError struct {
+	DcubeError
+	fields []FieldError
+}
+
+// NewValidation returns a 400 error listing the rejected fields. Its message
+// joins the individual field messages.
+func NewValidation(fields ...FieldError) *ValidationError {
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Message
+	}
+
+	return &ValidationError{
+		DcubeError: DcubeError{statusCode: http.StatusBadRequest, message: strings.Join(messages, "; ")},
+		fields:     fields,
+	}
+}
+
+func (e *ValidationError) Fields() []FieldError {
+	return e.fields
+}
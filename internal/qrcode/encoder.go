@@ -0,0 +1,542 @@
+package qrcode
+
+import (
+	"errors"
+	"strings"
+)
+
+// Level is the error correction level of a code. Higher levels survive more
+// damage, such as a logo printed over the centre, at the cost of capacity.
+type Level int
+
+const (
+	LevelL Level = iota
+	LevelM
+	LevelQ
+	LevelH
+)
+
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+var ErrTooLong = errors.New("data does not fit in a QR code")
+
+var ErrInvalidLevel = errors.New("error correction level must be L, M, Q or H")
+
+// formatBits are the two bits that identify each level in the format
+// information, which does not follow the order of the levels.
+var formatBits = [...]int{LevelL: 1, LevelM: 0, LevelQ: 3, LevelH: 2}
+
+// eccCodewordsPerBlock and numBlocks are indexed by level and version - 1.
+var eccCodewordsPerBlock = [4][maxVersion]int{
+	{7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28,
+		28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30,
+		28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28,
+		30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numBlocks = [4][maxVersion]int{
+	{1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8,
+		8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20,
+		23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25,
+		25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Penalty weights used to pick the mask, from the specification.
+const (
+	penaltyRun     = 3
+	penaltyBlock   = 3
+	penaltyFinder  = 40
+	penaltyBalance = 10
+)
+
+// ParseLevel parses one of L, M, Q or H in either case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return LevelL, nil
+	case "M":
+		return LevelM, nil
+	case "Q":
+		return LevelQ, nil
+	case "H":
+		return LevelH, nil
+	}
+	return 0, ErrInvalidLevel
+}
+
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// Code is an encoded QR code. Modules are addressed by column and row, with
+// the origin in the top left corner.
+type Code struct {
+	Version int
+	Level   Level
+	Mask    int
+	Size    int
+
+	modules    []bool
+	isFunction []bool
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y*c.Size+x]
+}
+
+// Encode encodes data in byte mode using the smallest version that fits at
+// the given level.
+func Encode(data []byte, level Level) (*Code, error) {
+	version := minVersion
+
+	for ; ; version++ {
+		if version > maxVersion {
+			return nil, ErrTooLong
+		}
+		if 4+countBits(version)+len(data)*8 <= numDataCodewords(version, level)*8 {
+			break
+		}
+	}
+
+	codewords := addECCAndInterleave(dataCodewords(data, version, level), version, level)
+
+	code := newCode(version, level)
+	code.drawFunctionPatterns()
+	code.drawCodewords(codewords)
+
+	bestPenalty := -1
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+
+		if penalty := code.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			code.Mask = mask
+			bestPenalty = penalty
+		}
+
+		// Masks are their own inverse.
+		code.applyMask(mask)
+	}
+
+	code.applyMask(code.Mask)
+	code.drawFormatBits(code.Mask)
+
+	return code, nil
+}
+
+func newCode(version int, level Level) *Code {
+	size := version*4 + 17
+
+	return &Code{
+		Version:    version,
+		Level:      level,
+		Size:       size,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+}
+
+// countBits is the width of the byte mode character count.
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// numRawDataModules counts the modules available for data and error
+// correction once the function patterns are drawn.
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+
+		if version >= 7 {
+			result -= 36
+		}
+	}
+
+	return result
+}
+
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 -
+		eccCodewordsPerBlock[level][version-1]*numBlocks[level][version-1]
+}
+
+// dataCodewords lays out the mode indicator, character count, data and
+// padding that fill the data capacity of the version.
+func dataCodewords(data []byte, version int, level Level) []byte {
+	capacity := numDataCodewords(version, level) * 8
+	var buffer bitBuffer
+
+	buffer.append(0b0100, 4)
+	buffer.append(len(data), countBits(version))
+	for _, b := range data {
+		buffer.append(int(b), 8)
+	}
+
+	terminator := capacity - len(buffer)
+	if terminator > 4 {
+		terminator = 4
+	}
+	buffer.append(0, terminator)
+	buffer.append(0, (8-len(buffer)%8)%8)
+
+	for pad := 0xEC; len(buffer) < capacity; pad ^= 0xEC ^ 0x11 {
+		buffer.append(pad, 8)
+	}
+
+	return buffer.bytes()
+}
+
+// addECCAndInterleave splits the data into blocks, appends the error
+// correction codewords of each and interleaves the result.
+func addECCAndInterleave(data []byte, version int, level Level) []byte {
+	blocks := numBlocks[level][version-1]
+	eccLen := eccCodewordsPerBlock[level][version-1]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := blocks - rawCodewords%blocks
+	shortBlockLen := rawCodewords / blocks
+	divisor := reedSolomonDivisor(eccLen)
+
+	parts := make([][]byte, blocks)
+	for i, k := 0, 0; i < blocks; i++ {
+		length := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			length++
+		}
+
+		dat := data[k : k+length]
+		k += length
+		block := append([]byte(nil), dat...)
+
+		// Short blocks get a placeholder so that all blocks line up, which
+		// is skipped when interleaving.
+		if i < numShortBlocks {
+			block = append(block, 0)
+		}
+
+		parts[i] = append(block, reedSolomonRemainder(dat, divisor)...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range parts[0] {
+		for j, part := range parts {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, part[i])
+			}
+		}
+	}
+
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y*c.Size+x] = dark
+	c.isFunction[y*c.Size+x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinderPattern(3, 3)
+	c.drawFinderPattern(c.Size-4, 3)
+	c.drawFinderPattern(3, c.Size-4)
+
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// The corners other than the bottom right hold finder patterns.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			c.drawAlignmentPattern(x, y)
+		}
+	}
+
+	// Reserve the format areas so that codewords are not drawn over them.
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinderPattern draws a finder pattern and its separator centred on x, y.
+func (c *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+
+			if xx >= 0 && xx < c.Size && yy >= 0 && yy < c.Size {
+				distance := maxInt(absInt(dx), absInt(dy))
+				c.setFunction(xx, yy, distance != 2 && distance != 4)
+			}
+		}
+	}
+}
+
+func (c *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the rows and columns that alignment patterns are
+// centred on.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	if version == 32 {
+		step = 26
+	}
+
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+
+	return result
+}
+
+// formatInfo returns the 15 bit format information for the level and mask,
+// protected by a BCH code and masked so that it is never all light.
+func formatInfo(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ rem>>9*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatInfo(c.Level, mask)
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// versionInfo returns the 18 bit version information carried by versions 7
+// and up.
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ rem>>11*0x1F25
+	}
+	return version<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	bits := versionInfo(c.Version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in two module wide columns that zigzag
+// up and down from the bottom right corner, skipping function patterns.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// The vertical timing pattern shifts every column to its left.
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+
+				if !c.isFunction[y*c.Size+x] && i < len(codewords)*8 {
+					c.modules[y*c.Size+x] = codewords[i>>3]>>(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y*c.Size+x] && maskInverts(mask, x, y) {
+				c.modules[y*c.Size+x] = !c.modules[y*c.Size+x]
+			}
+		}
+	}
+}
+
+func maskInverts(mask int, x int, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty scores how hard the code is to scan; the mask with the lowest
+// score is used.
+func (c *Code) penalty() int {
+	result := 0
+	dark := 0
+
+	for i := 0; i < c.Size; i++ {
+		result += c.linePenalty(func(j int) bool { return c.Dark(j, i) })
+		result += c.linePenalty(func(j int) bool { return c.Dark(i, j) })
+	}
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				v := c.Dark(x, y)
+				if v == c.Dark(x+1, y) && v == c.Dark(x, y+1) && v == c.Dark(x+1, y+1) {
+					result += penaltyBlock
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	result += absInt(dark*20-total*10) / total * penaltyBalance
+
+	return result
+}
+
+// linePenalty scores runs of five or more modules of the same colour and
+// finder-like 1:1:3:1:1 patterns with four light modules on either side.
+func (c *Code) linePenalty(dark func(int) bool) int {
+	result := 0
+	run := 0
+
+	for i := 0; i < c.Size; i++ {
+		if i > 0 && dark(i) == dark(i-1) {
+			run++
+		} else {
+			run = 1
+		}
+		if run == 5 {
+			result += penaltyRun
+		} else if run > 5 {
+			result++
+		}
+	}
+
+	light := func(from int, to int) bool {
+		for i := from; i < to; i++ {
+			if i >= 0 && i < c.Size && dark(i) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i+7 <= c.Size; i++ {
+		if dark(i) && !dark(i+1) && dark(i+2) && dark(i+3) && dark(i+4) && !dark(i+5) && dark(i+6) &&
+			(light(i-4, i) || light(i+7, i+11)) {
+			result += penaltyFinder
+		}
+	}
+
+	return result
+}
+
+func bit(x int, i int) bool {
+	return x>>i&1 != 0
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value int, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, bit(value, i))
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, v := range b {
+		if v {
+			result[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return result
+}
@@ -0,0 +1,206 @@
+package qrcode
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the worked example in the specification.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ecc := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, ecc)
+}
+
+func TestFunctionPatternBits(t *testing.T) {
+	assert.Equal(t, 0b111011111000100, formatInfo(LevelL, 0))
+	assert.Equal(t, 0b110011000101111, formatInfo(LevelL, 4))
+	assert.Equal(t, 0b101010000010010, formatInfo(LevelM, 0))
+	assert.Equal(t, 0b011010101011111, formatInfo(LevelQ, 0))
+	assert.Equal(t, 0b001011010001001, formatInfo(LevelH, 0))
+
+	assert.Equal(t, 0b000111110010010100, versionInfo(7))
+	assert.Equal(t, 0b101000110001101001, versionInfo(40))
+
+	assert.Empty(t, alignmentPositions(1))
+	assert.Equal(t, []int{6, 18}, alignmentPositions(2))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPositions(7))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPositions(32))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, alignmentPositions(40))
+}
+
+func TestEncodePicksSmallestVersion(t *testing.T) {
+	for _, c := range []struct {
+		level    Level
+		capacity int
+		version  int
+	}{
+		{LevelL, 17, 1},
+		{LevelH, 7, 1},
+		{LevelM, 213, 10},
+		{LevelH, 119, 10},
+		{LevelL, 2953, 40},
+	} {
+		code, err := Encode(bytes.Repeat([]byte("a"), c.capacity), c.level)
+		assert.Nil(t, err)
+		assert.Equal(t, c.version, code.Version)
+		assert.Equal(t, c.version*4+17, code.Size)
+
+		if c.version < maxVersion {
+			code, _ = Encode(bytes.Repeat([]byte("a"), c.capacity+1), c.level)
+			assert.Equal(t, c.version+1, code.Version)
+		}
+	}
+
+	_, err := Encode(bytes.Repeat([]byte("a"), 2954), LevelL)
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestEncodeReadsBack(t *testing.T) {
+	for _, c := range []struct {
+		data  string
+		level Level
+	}{
+		{"https://dcu.be/r/abc123", LevelM},
+		{"https://dcu.be/r/abc123", LevelH},
+		{string(bytes.Repeat([]byte("https://example.com/"), 20)), LevelQ},
+		{string(bytes.Repeat([]byte("0123456789"), 100)), LevelL},
+	} {
+		code, err := Encode([]byte(c.data), c.level)
+		assert.Nil(t, err)
+		assert.Equal(t, c.data, string(readBack(t, code)))
+	}
+}
+
+// readBack decodes code the way a scanner would once it has located the
+// modules: it reads the format, unmasks, collects the codewords, checks each
+// block against its error correction and parses the byte mode segment.
+func readBack(t *testing.T, code *Code) []byte {
+	level, mask := readFormat(t, code)
+	assert.Equal(t, code.Level, level)
+
+	template := newCode(code.Version, level)
+	template.drawFunctionPatterns()
+
+	assert.True(t, code.Dark(0, 0) && !code.Dark(1, 1) && code.Dark(3, 3))
+	assert.True(t, code.Dark(8, code.Size-8))
+
+	codewords := make([]byte, numRawDataModules(code.Version)/8)
+	i := 0
+	for right := code.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < code.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = code.Size - 1 - vert
+				}
+				if template.isFunction[y*code.Size+x] || i >= len(codewords)*8 {
+					continue
+				}
+				if code.Dark(x, y) != maskInverts(mask, x, y) {
+					codewords[i>>3] |= 1 << (7 - i&7)
+				}
+				i++
+			}
+		}
+	}
+
+	blocks := numBlocks[level][code.Version-1]
+	eccLen := eccCodewordsPerBlock[level][code.Version-1]
+	numShortBlocks := blocks - len(codewords)%blocks
+	shortDataLen := len(codewords)/blocks - eccLen
+
+	parts := make([][]byte, blocks)
+	k := 0
+	for i := 0; i <= shortDataLen; i++ {
+		for j := range parts {
+			if i < shortDataLen || j >= numShortBlocks {
+				parts[j] = append(parts[j], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range parts {
+			parts[j] = append(parts[j], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for _, part := range parts {
+		// A valid block evaluates to zero at every root of the generator.
+		root := byte(1)
+		for i := 0; i < eccLen; i++ {
+			syndrome := byte(0)
+			for _, b := range part {
+				syndrome = gfMultiply(syndrome, root) ^ b
+			}
+			assert.Zero(t, syndrome)
+			root = gfMultiply(root, 0x02)
+		}
+
+		data = append(data, part[:len(part)-eccLen]...)
+	}
+
+	assert.Equal(t, byte(0b0100), data[0]>>4)
+
+	reader := bitReader{data: data, pos: 4}
+	length := reader.read(countBits(code.Version))
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = byte(reader.read(8))
+	}
+
+	return result
+}
+
+func readFormat(t *testing.T, code *Code) (Level, int) {
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		bits |= boolBit(code.Dark(8, i)) << i
+	}
+	bits |= boolBit(code.Dark(8, 7)) << 6
+	bits |= boolBit(code.Dark(8, 8)) << 7
+	bits |= boolBit(code.Dark(7, 8)) << 8
+	for i := 9; i < 15; i++ {
+		bits |= boolBit(code.Dark(14-i, 8)) << i
+	}
+
+	for _, level := range []Level{LevelL, LevelM, LevelQ, LevelH} {
+		for mask := 0; mask < 8; mask++ {
+			if formatInfo(level, mask) == bits {
+				return level, mask
+			}
+		}
+	}
+
+	t.Fatalf("format bits %015b are not valid", bits)
+	return 0, 0
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) int {
+	result := 0
+	for i := 0; i < n; i++ {
+		result = result<<1 | int(r.data[r.pos>>3]>>(7-r.pos&7)&1)
+		r.pos++
+	}
+	return result
+}
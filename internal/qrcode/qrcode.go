@@ -0,0 +1,33 @@
+package qrcode
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+const (
+	DefaultSize       = 256
+	DefaultMargin     = 4
+	DefaultForeground = "#000000"
+	DefaultBackground = "#ffffff"
+)
+
+type RenderRequest struct {
+	// LinkID and Content identify what is encoded for caching. Content is
+	// the full short link, so changing the code of a link changes the key.
+	LinkID  uint
+	Content string `validate:"required"`
+	Format  string `validate:"oneof=png svg"`
+	Size    int    `validate:"min=64,max=2048"`
+	// Level defaults to M, or to H when a logo is drawn.
+	Level      string `validate:"omitempty,oneof=L M Q H"`
+	Margin     int    `validate:"min=0,max=16"`
+	Foreground string `validate:"hexcolor"`
+	Background string `validate:"hexcolor"`
+	Logo       bool
+}
+
+type RenderResponse struct {
+	ContentType string
+	Image       []byte
+}
@@ -0,0 +1,194 @@
+package qrcode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	// Logos may be PNG or JPEG files.
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+)
+
+type QRCodeManager interface {
+	// Render draws a QR code, reusing an earlier rendering with the same
+	// content and options when the cache still holds it.
+	Render(RenderRequest) (*RenderResponse, dcubeerrs.Error)
+}
+
+// Logo is the image drawn over the centre of codes that ask for one.
+type Logo struct {
+	Image image.Image
+	// digest is part of every cache key so that replacing the logo does not
+	// serve codes rendered with the old one from a shared cache.
+	digest string
+}
+
+// DecodeLogo reads a PNG or JPEG logo.
+func DecodeLogo(data []byte) (*Logo, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Logo{Image: img, digest: fmt.Sprintf("%x", sha256.Sum256(data))}, nil
+}
+
+type QRCodeManagerImpl struct {
+	cache cache.Cache
+	ttl   time.Duration
+	logo  *Logo
+}
+
+// NewQRCodeManager returns a manager that keeps rendered codes in cache for
+// ttl. logo may be nil, in which case requests for a logo are rejected.
+func NewQRCodeManager(cache cache.Cache, ttl time.Duration, logo *Logo) QRCodeManager {
+	return &QRCodeManagerImpl{
+		cache: cache,
+		ttl:   ttl,
+		logo:  logo,
+	}
+}
+
+func (m *QRCodeManagerImpl) Render(req RenderRequest) (*RenderResponse, dcubeerrs.Error) {
+	if req.Level == "" {
+		req.Level = LevelM.String()
+		if req.Logo {
+			req.Level = LevelH.String()
+		}
+	}
+
+	level, err := ParseLevel(req.Level)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Error correction level must be L, M, Q or H")
+	}
+
+	if req.Logo {
+		if m.logo == nil {
+			return nil, dcubeerrs.New(http.StatusBadRequest, "No logo is configured for QR codes")
+		}
+		if level < LevelQ {
+			return nil, dcubeerrs.New(http.StatusBadRequest, "A logo needs error correction level Q or H")
+		}
+	}
+
+	foreground, err := parseHexColor(req.Foreground)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Foreground is not a hex colour")
+	}
+
+	background, err := parseHexColor(req.Background)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Background is not a hex colour")
+	}
+
+	res := &RenderResponse{ContentType: contentType(req.Format)}
+	key := m.cacheKey(req)
+	cached, ok, err := m.cache.Get(key)
+
+	if err != nil {
+		log.Printf("Error reading cached QR code: %s", err.Error())
+	} else if ok {
+		res.Image = cached
+		return res, nil
+	}
+
+	code, err := Encode([]byte(req.Content), level)
+
+	if errors.Is(err, ErrTooLong) {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Link is too long for a QR code")
+	}
+	if err != nil {
+		log.Printf("Error encoding QR code: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while rendering the QR code")
+	}
+
+	opts := Options{
+		Size:       req.Size,
+		Margin:     req.Margin,
+		Foreground: foreground,
+		Background: background,
+	}
+	if req.Logo {
+		opts.Logo = m.logo.Image
+	}
+
+	if req.Format == FormatSVG {
+		res.Image, err = code.SVG(opts)
+	} else {
+		res.Image, err = code.PNG(opts)
+	}
+
+	if err != nil {
+		log.Printf("Error rendering QR code: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while rendering the QR code")
+	}
+
+	if err := m.cache.Set(key, res.Image, m.ttl); err != nil {
+		log.Printf("Error caching QR code: %s", err.Error())
+	}
+
+	return res, nil
+}
+
+func (m *QRCodeManagerImpl) cacheKey(req RenderRequest) string {
+	logo := ""
+	if req.Logo {
+		logo = m.logo.digest
+	}
+
+	options := strings.Join([]string{
+		req.Content,
+		req.Format,
+		strconv.Itoa(req.Size),
+		req.Level,
+		strconv.Itoa(req.Margin),
+		strings.ToLower(req.Foreground),
+		strings.ToLower(req.Background),
+		logo,
+	}, "\n")
+
+	return fmt.Sprintf("qr:%d:%x", req.LinkID, sha256.Sum256([]byte(options)))
+}
+
+func contentType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// parseHexColor parses an opaque colour written as #rgb or #rrggbb.
+func parseHexColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+
+	rgb, err := strconv.ParseUint(s, 16, 32)
+
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+
+	return color.NRGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, nil
+}
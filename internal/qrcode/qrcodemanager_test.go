@@ -0,0 +1,121 @@
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func renderRequest() RenderRequest {
+	return RenderRequest{
+		LinkID:     1,
+		Content:    "https://dcu.be/r/abc123",
+		Format:     FormatPNG,
+		Size:       DefaultSize,
+		Margin:     DefaultMargin,
+		Foreground: "#c00",
+		Background: DefaultBackground,
+	}
+}
+
+func testLogo(t *testing.T) *Logo {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+
+	var buffer bytes.Buffer
+	assert.Nil(t, png.Encode(&buffer, img))
+
+	logo, err := DecodeLogo(buffer.Bytes())
+	assert.Nil(t, err)
+
+	return logo
+}
+
+func TestRenderPNG(t *testing.T) {
+	manager := NewQRCodeManager(cache.NewLRU(10, time.Hour), time.Hour, nil)
+
+	res, err := manager.Render(renderRequest())
+	assert.Nil(t, err)
+	assert.Equal(t, "image/png", res.ContentType)
+
+	img, e := png.Decode(bytes.NewReader(res.Image))
+	assert.Nil(t, e)
+	assert.Equal(t, image.Rect(0, 0, DefaultSize, DefaultSize), img.Bounds())
+
+	// A version 2 code with a margin of 4 is 33 modules across, so the
+	// corner is quiet zone and the finder pattern starts 4 modules in.
+	assert.Equal(t, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, color.NRGBAModel.Convert(img.At(0, 0)))
+	assert.Equal(t, color.NRGBA{R: 0xcc, A: 0xff}, color.NRGBAModel.Convert(img.At(4*256/33+1, 4*256/33+1)))
+}
+
+func TestRenderSVG(t *testing.T) {
+	manager := NewQRCodeManager(cache.NewLRU(10, time.Hour), time.Hour, testLogo(t))
+	req := renderRequest()
+	req.Format = FormatSVG
+	req.Logo = true
+
+	res, err := manager.Render(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "image/svg+xml", res.ContentType)
+
+	svg := string(res.Image)
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	assert.Contains(t, svg, `viewBox="0 0 37 37"`)
+	assert.Contains(t, svg, `fill="#cc0000"`)
+	assert.Contains(t, svg, `xlink:href="data:image/png;base64,`)
+}
+
+func TestRenderUsesCache(t *testing.T) {
+	store := cache.NewLRU(10, time.Hour)
+	manager := NewQRCodeManager(store, time.Hour, nil)
+	req := renderRequest()
+	req.Level = "M"
+
+	first, _ := manager.Render(req)
+	second, _ := manager.Render(req)
+	assert.Equal(t, first.Image, second.Image)
+
+	key := manager.(*QRCodeManagerImpl).cacheKey(req)
+	assert.Nil(t, store.Set(key, []byte("cached"), time.Hour))
+
+	cached, _ := manager.Render(req)
+	assert.Equal(t, []byte("cached"), cached.Image)
+
+	req.Margin = 0
+	uncached, _ := manager.Render(req)
+	assert.NotEqual(t, []byte("cached"), uncached.Image)
+}
+
+func TestRenderLogo(t *testing.T) {
+	req := renderRequest()
+	req.Logo = true
+
+	_, err := NewQRCodeManager(cache.NewLRU(10, time.Hour), time.Hour, nil).Render(req)
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	manager := NewQRCodeManager(cache.NewLRU(10, time.Hour), time.Hour, testLogo(t))
+
+	req.Level = "M"
+	_, err = manager.Render(req)
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	req.Level = ""
+	res, err := manager.Render(req)
+	assert.Nil(t, err)
+
+	img, _ := png.Decode(bytes.NewReader(res.Image))
+	centre := color.NRGBAModel.Convert(img.At(DefaultSize/2, DefaultSize/2)).(color.NRGBA)
+	assert.Equal(t, uint8(0xff), centre.A)
+	assert.NotEqual(t, uint8(0xff), centre.G)
+	assert.NotEqual(t, uint8(0x00), centre.G)
+}
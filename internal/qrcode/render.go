@@ -0,0 +1,183 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// logoRatio is the share of the symbol width cleared for a logo. It hides
+// about 4% of the modules, which levels Q and H recover from comfortably.
+const logoRatio = 0.2
+
+// Options controls how a Code is drawn.
+type Options struct {
+	// Size is the width and height of the image in pixels.
+	Size int
+	// Margin is the width of the quiet zone around the symbol in modules.
+	Margin     int
+	Foreground color.NRGBA
+	Background color.NRGBA
+	// Logo is drawn over the centre of the symbol when set.
+	Logo image.Image
+}
+
+// PNG draws the code as a PNG image. Modules are stretched to fill exactly
+// Size pixels, so some may be a pixel wider than others.
+func (c *Code) PNG(opts Options) ([]byte, error) {
+	total := c.Size + 2*opts.Margin
+	symbol := image.NewPaletted(
+		image.Rect(0, 0, opts.Size, opts.Size),
+		color.Palette{opts.Background, opts.Foreground},
+	)
+
+	for py := 0; py < opts.Size; py++ {
+		y := py*total/opts.Size - opts.Margin
+
+		for px := 0; px < opts.Size; px++ {
+			x := px*total/opts.Size - opts.Margin
+
+			if c.visible(x, y, opts) {
+				symbol.SetColorIndex(px, py, 1)
+			}
+		}
+	}
+
+	var img image.Image = symbol
+
+	if opts.Logo != nil {
+		from, to := c.logoBox()
+		start := (opts.Margin + from) * opts.Size / total
+		end := (opts.Margin + to) * opts.Size / total
+
+		withLogo := image.NewNRGBA(symbol.Bounds())
+		draw.Draw(withLogo, withLogo.Bounds(), symbol, image.Point{}, draw.Src)
+		drawScaled(withLogo, image.Rect(start, start, end, end), opts.Logo)
+		img = withLogo
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// SVG draws the code as an SVG image with one unit per module.
+func (c *Code) SVG(opts Options) ([]byte, error) {
+	total := c.Size + 2*opts.Margin
+	var buffer bytes.Buffer
+
+	fmt.Fprintf(
+		&buffer,
+		`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" `+
+			`width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, total, total,
+	)
+	fmt.Fprintf(&buffer, `<rect width="%d" height="%d" fill="%s"/>`, total, total, hexColor(opts.Background))
+	fmt.Fprintf(&buffer, `<path fill="%s" d="`, hexColor(opts.Foreground))
+
+	// Runs of dark modules in a row are drawn as a single rectangle.
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.visible(x, y, opts) {
+				x++
+				continue
+			}
+
+			run := 1
+			for x+run < c.Size && c.visible(x+run, y, opts) {
+				run++
+			}
+
+			fmt.Fprintf(&buffer, "M%d %dh%dv1h-%dz", x+opts.Margin, y+opts.Margin, run, run)
+			x += run
+		}
+	}
+
+	buffer.WriteString(`"/>`)
+
+	if opts.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, opts.Logo); err != nil {
+			return nil, err
+		}
+
+		from, to := c.logoBox()
+		fmt.Fprintf(
+			&buffer,
+			`<image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="xMidYMid meet" `+
+				`xlink:href="data:image/png;base64,%s"/>`,
+			from+opts.Margin, from+opts.Margin, to-from, to-from, base64.StdEncoding.EncodeToString(logo.Bytes()),
+		)
+	}
+
+	buffer.WriteString(`</svg>`)
+
+	return buffer.Bytes(), nil
+}
+
+// visible reports whether the module at x, y is drawn dark, which excludes
+// the quiet zone and the area under a logo.
+func (c *Code) visible(x int, y int, opts Options) bool {
+	if x < 0 || x >= c.Size || y < 0 || y >= c.Size || !c.Dark(x, y) {
+		return false
+	}
+
+	if opts.Logo != nil {
+		from, to := c.logoBox()
+		return x < from || x >= to || y < from || y >= to
+	}
+
+	return true
+}
+
+// logoBox returns the first and last plus one module of the square cleared
+// for a logo, centred on the symbol.
+func (c *Code) logoBox() (int, int) {
+	side := int(float64(c.Size) * logoRatio)
+
+	if side%2 != c.Size%2 {
+		side++
+	}
+
+	from := (c.Size - side) / 2
+
+	return from, from + side
+}
+
+// drawScaled draws src over the centre of rect in dst, scaled with nearest
+// neighbour sampling to fit while keeping its aspect ratio.
+func drawScaled(dst draw.Image, rect image.Rectangle, src image.Image) {
+	bounds := src.Bounds()
+	width, height := rect.Dx(), rect.Dy()
+
+	if bounds.Dx()*height > bounds.Dy()*width {
+		height = bounds.Dy() * width / bounds.Dx()
+	} else {
+		width = bounds.Dx() * height / bounds.Dy()
+	}
+
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			scaled.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+
+	offset := image.Pt(rect.Min.X+(rect.Dx()-width)/2, rect.Min.Y+(rect.Dy()-height)/2)
+	draw.Draw(dst, scaled.Bounds().Add(offset), scaled, image.Point{}, draw.Over)
+}
+
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
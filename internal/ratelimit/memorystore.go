@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many takes pass between removals of full buckets.
+const sweepEvery = 10000
+
+type bucket struct {
+	policy  Policy
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in process memory, so each instance enforces its
+// own limits.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.takes++
+	if s.takes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+
+	if !ok {
+		b = &bucket{policy: policy, tokens: float64(policy.Limit), updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = refill(policy, b.tokens, b.updated, now)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return newResult(policy, false, b.tokens), nil
+	}
+
+	b.tokens--
+
+	return newResult(policy, true, b.tokens), nil
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket
+// would be identical.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if refill(b.policy, b.tokens, b.updated, now) >= float64(b.policy.Limit) {
+			delete(s.buckets, key)
+		}
+	}
+}
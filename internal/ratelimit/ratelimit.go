@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Policy describes a token bucket that holds up to Limit requests and refills
+// completely over Period.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// refillRate returns how many tokens the bucket regains per second.
+func (p Policy) refillRate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed. It is
+	// zero when Allowed is true.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. MemoryStore serves a single instance; a shared
+// implementation such as RedisStore lets several instances enforce one limit.
+type Store interface {
+	Take(key string, policy Policy, now time.Time) (Result, error)
+}
+
+// newResult builds the Result for a bucket left with tokens after the take.
+func newResult(policy Policy, allowed bool, tokens float64) Result {
+	rate := policy.refillRate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(policy.Limit) - tokens) / rate),
+	}
+
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+
+	return result
+}
+
+// refill returns the tokens in a bucket that held tokens at last, capped at
+// the policy limit.
+func refill(policy Policy, tokens float64, last time.Time, now time.Time) float64 {
+	elapsed := now.Sub(last).Seconds()
+
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return math.Min(float64(policy.Limit), tokens+elapsed*policy.refillRate())
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
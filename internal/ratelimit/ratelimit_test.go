@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+	policy := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take("key", policy, now)
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, _ := store.Take("key", policy, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// Other keys have their own bucket.
+	result, _ = store.Take("other", policy, now)
+	assert.True(t, result.Allowed)
+
+	// One token comes back every second.
+	result, _ = store.Take("key", policy, now.Add(time.Second))
+	assert.True(t, result.Allowed)
+	result, _ = store.Take("key", policy, now.Add(time.Second))
+	assert.False(t, result.Allowed)
+
+	result, _ = store.Take("key", policy, now.Add(time.Hour))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://"+server.Addr(), "test:")
+	assert.Nil(t, err)
+	defer store.Close()
+
+	testStore(t, store)
+	assert.True(t, server.Exists("test:key"))
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisTimeout = 500 * time.Millisecond
+
+var errUnexpectedReply = errors.New("unexpected reply from rate limit script")
+
+// takeScript refills and takes from a bucket stored as a hash of tokens and
+// the time of the last update in milliseconds, atomically on the server.
+var takeScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or limit
+local updated = tonumber(bucket[2]) or now
+
+local elapsed = math.max(0, now - updated) / 1000
+tokens = math.min(limit, tokens + elapsed * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil((limit - tokens) / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore keeps buckets in Redis so that every instance shares them.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore connects to the server at url, e.g. redis://localhost:6379/0.
+func NewRedisStore(url string, prefix string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisStore{client: redis.NewClient(options), prefix: prefix}, nil
+}
+
+func (s *RedisStore) Take(key string, policy Policy, now time.Time) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	reply, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		policy.Limit, policy.refillRate(), now.UnixMilli()).Slice()
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(reply) != 2 {
+		return Result{}, errUnexpectedReply
+	}
+
+	allowed, ok := reply[0].(int64)
+	rawTokens, ok2 := reply[1].(string)
+
+	if !ok || !ok2 {
+		return Result{}, errUnexpectedReply
+	}
+
+	tokens, err := strconv.ParseFloat(rawTokens, 64)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(policy, allowed == 1, tokens), nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
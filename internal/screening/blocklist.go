@@ -0,0 +1,163 @@
+package screening
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const regexPrefix = "regex:"
+
+// Blocklist is a local Provider backed by a file of blocked domains and
+// patterns. Each non-empty line is either a domain, which also blocks its
+// subdomains, or "regex:<pattern>" matched against the full URL. Lines
+// starting with '#' are comments.
+type Blocklist struct {
+	path string
+
+	mu       sync.RWMutex
+	domains  []string
+	patterns []*regexp.Regexp
+	modTime  time.Time
+	size     int64
+}
+
+// NewBlocklist loads the blocklist at path.
+func NewBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Blocklist) Name() string {
+	return "blocklist"
+}
+
+func (b *Blocklist) Check(destination *url.URL) (Verdict, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, domain := range b.domains {
+		if matchesDomain(destination.Hostname(), domain) {
+			return Verdict{Blocked: true, Reason: fmt.Sprintf("Domain %s is blocklisted", domain)}, nil
+		}
+	}
+
+	for _, pattern := range b.patterns {
+		if pattern.MatchString(destination.String()) {
+			return Verdict{Blocked: true, Reason: "URL matches a blocklisted pattern"}, nil
+		}
+	}
+
+	return Verdict{}, nil
+}
+
+// Reload re-reads the blocklist file. The current entries are kept if the
+// file cannot be read or contains an invalid pattern.
+func (b *Blocklist) Reload() error {
+	file, err := os.Open(b.path)
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	domains, patterns, err := parseBlocklist(file)
+
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.domains = domains
+	b.patterns = patterns
+	b.modTime = info.ModTime()
+	b.size = info.Size()
+
+	return nil
+}
+
+// Watch reloads the blocklist whenever the file changes on disk, checking
+// every interval. It blocks until stop is closed.
+func (b *Blocklist) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !b.changed() {
+				continue
+			}
+			if err := b.Reload(); err != nil {
+				log.Printf("blocklist: reload failed: %s", err)
+				continue
+			}
+			log.Printf("blocklist: reloaded %s", b.path)
+		}
+	}
+}
+
+func (b *Blocklist) changed() bool {
+	info, err := os.Stat(b.path)
+
+	if err != nil {
+		return false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return !info.ModTime().Equal(b.modTime) || info.Size() != b.size
+}
+
+func parseBlocklist(r io.Reader) ([]string, []*regexp.Regexp, error) {
+	var domains []string
+	var patterns []*regexp.Regexp
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		entry := strings.TrimSpace(scanner.Text())
+
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(entry, regexPrefix) {
+			pattern, err := regexp.Compile(strings.TrimPrefix(entry, regexPrefix))
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			patterns = append(patterns, pattern)
+			continue
+		}
+
+		domains = append(domains, strings.TrimSuffix(strings.ToLower(entry), "."))
+	}
+
+	return domains, patterns, scanner.Err()
+}
@@ -0,0 +1,42 @@
+package screening
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(path, []byte("# phishing\nevil.example\nregex:/wp-login\\.php$\n"), 0o600)
+
+	blocklist, err := NewBlocklist(path)
+	assert.Nil(t, err)
+
+	screener := NewScreener(blocklist)
+	assert.True(t, screener.Screen("https://evil.example/login").Blocked)
+	assert.True(t, screener.Screen("https://login.EVIL.example/").Blocked)
+	assert.True(t, screener.Screen("https://example.com/wp-login.php").Blocked)
+	assert.False(t, screener.Screen("https://notevil.example/").Blocked)
+	assert.Equal(t, "blocklist", screener.Screen("https://evil.example").Provider)
+
+	os.WriteFile(path, []byte("regex:(\n"), 0o600)
+	assert.NotNil(t, blocklist.Reload())
+	assert.True(t, screener.Screen("https://evil.example").Blocked)
+
+	os.WriteFile(path, []byte("other.example\n"), 0o600)
+	assert.Nil(t, blocklist.Reload())
+	assert.False(t, screener.Screen("https://evil.example").Blocked)
+	assert.True(t, screener.Screen("https://other.example").Blocked)
+}
+
+func TestReputationServiceWithoutEndpoint(t *testing.T) {
+	u, _ := url.Parse("https://example.com")
+	verdict, err := NewReputationService("", "").Check(u)
+
+	assert.Nil(t, err)
+	assert.False(t, verdict.Blocked)
+}
@@ -0,0 +1,54 @@
+package screening
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+)
+
+// CachedProvider remembers another provider's verdicts for ttl, so that
+// redirects to a popular destination do not each wait on a remote service.
+// Failed checks are not cached.
+type CachedProvider struct {
+	provider Provider
+	cache    cache.Cache
+	ttl      time.Duration
+}
+
+func NewCachedProvider(provider Provider, c cache.Cache, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{provider: provider, cache: c, ttl: ttl}
+}
+
+func (p *CachedProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *CachedProvider) Check(destination *url.URL) (Verdict, error) {
+	sum := sha256.Sum256([]byte(destination.String()))
+	key := "screening:" + p.provider.Name() + ":" + hex.EncodeToString(sum[:])
+
+	if data, ok, err := p.cache.Get(key); err == nil && ok {
+		var verdict Verdict
+		if err := json.Unmarshal(data, &verdict); err == nil {
+			return verdict, nil
+		}
+	}
+
+	verdict, err := p.provider.Check(destination)
+
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	data, _ := json.Marshal(verdict)
+	if err := p.cache.Set(key, data, p.ttl); err != nil {
+		log.Printf("screening: caching verdict: %s", err)
+	}
+
+	return verdict, nil
+}
@@ -0,0 +1,44 @@
+package screening
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingProvider struct {
+	calls   int
+	verdict Verdict
+	err     error
+}
+
+func (p *countingProvider) Name() string {
+	return "counting"
+}
+
+func (p *countingProvider) Check(*url.URL) (Verdict, error) {
+	p.calls++
+	return p.verdict, p.err
+}
+
+func TestCachedProvider(t *testing.T) {
+	inner := &countingProvider{verdict: Verdict{Blocked: true, Reason: "phishing"}}
+	screener := NewScreener(NewCachedProvider(inner, cache.NewLRU(10, time.Minute), time.Minute))
+
+	assert.Equal(t, Verdict{Blocked: true, Provider: "counting", Reason: "phishing"}, screener.Screen("https://a.example"))
+	assert.True(t, screener.Screen("https://a.example").Blocked)
+	assert.Equal(t, 1, inner.calls)
+
+	screener.Screen("https://b.example")
+	assert.Equal(t, 2, inner.calls)
+
+	failing := &countingProvider{err: errors.New("unavailable")}
+	screener = NewScreener(NewCachedProvider(failing, cache.NewLRU(10, time.Minute), time.Minute))
+	screener.Screen("https://a.example")
+	screener.Screen("https://a.example")
+	assert.Equal(t, 2, failing.calls)
+}
@@ -0,0 +1,74 @@
+package screening
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const reputationTimeout = 2 * time.Second
+
+// ReputationService is a Provider that asks an external URL reputation API
+// about each destination. It posts {"url": ...} to endpoint and expects
+// {"malicious": bool, "reason": string} back. This is a stub for wiring a
+// real vendor; with an empty endpoint every URL is allowed.
+type ReputationService struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func NewReputationService(endpoint string, apiKey string) *ReputationService {
+	return &ReputationService{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: reputationTimeout},
+	}
+}
+
+func (s *ReputationService) Name() string {
+	return "reputation"
+}
+
+func (s *ReputationService) Check(destination *url.URL) (Verdict, error) {
+	if s.endpoint == "" {
+		return Verdict{}, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"url": destination.String()})
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Malicious bool   `json:"malicious"`
+		Reason    string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, err
+	}
+
+	return Verdict{Blocked: result.Malicious, Reason: result.Reason}, nil
+}
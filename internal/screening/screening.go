@@ -0,0 +1,62 @@
+package screening
+
+import (
+	"log"
+	"net/url"
+	"strings"
+)
+
+// Verdict is the outcome of screening a destination URL.
+type Verdict struct {
+	Blocked  bool   `json:"blocked"`
+	Provider string `json:"provider,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Provider checks a destination URL against one source of reputation data.
+type Provider interface {
+	Name() string
+	Check(destination *url.URL) (Verdict, error)
+}
+
+// Screener consults its providers in order and reports the first one that
+// blocks the destination.
+type Screener struct {
+	providers []Provider
+}
+
+func NewScreener(providers ...Provider) *Screener {
+	return &Screener{providers: providers}
+}
+
+// Screen checks destination against every provider. Providers that fail are
+// logged and skipped so that an unavailable service does not block every link.
+func (s *Screener) Screen(destination string) Verdict {
+	u, err := url.Parse(destination)
+
+	if err != nil {
+		return Verdict{Blocked: true, Provider: "screener", Reason: "URL could not be parsed"}
+	}
+
+	for _, provider := range s.providers {
+		verdict, err := provider.Check(u)
+
+		if err != nil {
+			log.Printf("screening: provider %s failed: %s", provider.Name(), err)
+			continue
+		}
+
+		if verdict.Blocked {
+			verdict.Provider = provider.Name()
+			return verdict
+		}
+	}
+
+	return Verdict{}
+}
+
+// matchesDomain reports whether host is domain or one of its subdomains.
+func matchesDomain(host string, domain string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
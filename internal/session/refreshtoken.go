@@ -0,0 +1,38 @@
+package session
+
+import "time"
+
+// LoginSession groups every access and refresh token issued from a single
+// sign-in. Revoking it invalidates all of them at once.
+type LoginSession struct {
+	ID        string     `json:"id" gorm:"primaryKey;size:64"`
+	UserID    uint       `json:"-" gorm:"index;not null"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// RefreshToken stores only a hash of the opaque token handed to the client.
+// A token may be used exactly once; presenting it again is treated as theft.
+type RefreshToken struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	SessionID string     `json:"-" gorm:"index;not null;size:64"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-" gorm:"type:timestamp;default:current_timestamp"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type SignOutRequest struct {
+	UserID    uint
+	SessionID string
+}
+
+type TokenResponse struct {
+	AccessToken           Session   `json:"-"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
@@ -9,13 +9,29 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
-const invalidUserID uint = 0
 const validDuration = 5 * time.Minute
 
+// mfaValidDuration bounds how long a user has to enter their second factor
+// after the password step.
+const mfaValidDuration = 5 * time.Minute
+const purposeMFA = "mfa"
+
 var jwtKey = []byte(os.Getenv("JWT_KEY"))
 
+// revocationChecker is consulted by VerifyToken so that access tokens stop
+// working as soon as the session they belong to is revoked.
+var revocationChecker RevocationChecker
+
+type RevocationChecker interface {
+	IsRevoked(sessionID string) bool
+}
+
 type Claims struct {
-	ID uint `json:"id"`
+	ID        uint   `json:"id"`
+	SessionID string `json:"sid"`
+	// Purpose is empty for access tokens and "mfa" for the token handed out
+	// between the password and second factor steps of sign-in.
+	Purpose string `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -24,6 +40,10 @@ type Session struct {
 	ExpirationTime time.Time
 }
 
+func SetRevocationChecker(checker RevocationChecker) {
+	revocationChecker = checker
+}
+
 func GetToken(r *http.Request) (string, error) {
 	val, ok := r.Header["Authorization"]
 
@@ -34,14 +54,20 @@ func GetToken(r *http.Request) (string, error) {
 	return val[0], nil
 }
 
-func GenerateToken(id uint) (Session, error) {
-	expirationTime := time.Now().Add(validDuration)
+func GenerateToken(id uint, sessionID string) (Session, error) {
+	return signClaims(&Claims{ID: id, SessionID: sessionID}, validDuration)
+}
+
+// GenerateMFAToken issues the short-lived token that proves the password step
+// of sign-in succeeded. It cannot be used as an access token.
+func GenerateMFAToken(id uint) (Session, error) {
+	return signClaims(&Claims{ID: id, Purpose: purposeMFA}, mfaValidDuration)
+}
 
-	claims := &Claims{
-		ID: id,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+func signClaims(claims *Claims, duration time.Duration) (Session, error) {
+	expirationTime := time.Now().Add(duration)
+	claims.StandardClaims = jwt.StandardClaims{
+		ExpiresAt: expirationTime.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -56,13 +82,51 @@ func GenerateToken(id uint) (Session, error) {
 	}, nil
 }
 
-func VerifyToken(r *http.Request) (uint, error) {
+func VerifyToken(r *http.Request) (*Claims, error) {
 	token, err := GetToken(r)
 
 	if err != nil {
-		return invalidUserID, err
+		return nil, err
+	}
+
+	claims, err := parseClaims(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != "" {
+		return nil, errors.New("token is not an access token")
 	}
 
+	if claims.SessionID == "" {
+		return nil, errors.New("token is not bound to a session")
+	}
+
+	if revocationChecker != nil && revocationChecker.IsRevoked(claims.SessionID) {
+		return nil, errors.New("session has been revoked")
+	}
+
+	return claims, nil
+}
+
+// VerifyMFAToken checks a token issued by GenerateMFAToken and returns the
+// user it was issued for.
+func VerifyMFAToken(token string) (uint, error) {
+	claims, err := parseClaims(token)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if claims.Purpose != purposeMFA {
+		return 0, errors.New("token is not a second factor token")
+	}
+
+	return claims.ID, nil
+}
+
+func parseClaims(token string) (*Claims, error) {
 	claims := &Claims{}
 
 	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
@@ -70,12 +134,12 @@ func VerifyToken(r *http.Request) (uint, error) {
 	})
 
 	if err != nil {
-		return invalidUserID, err
+		return nil, err
 	}
 
 	if !tkn.Valid {
-		return invalidUserID, errors.New("token has expired")
+		return nil, errors.New("token has expired")
 	}
 
-	return claims.ID, nil
+	return claims, nil
 }
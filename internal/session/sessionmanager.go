@@ -0,0 +1,216 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"gorm.io/gorm"
+)
+
+const refreshTokenBytes = 32
+const sessionIDBytes = 16
+
+type SessionManager interface {
+	CreateSession(userID uint) (*TokenResponse, dcubeerrs.Error)
+	Refresh(RefreshRequest) (*TokenResponse, dcubeerrs.Error)
+	SignOut(SignOutRequest) dcubeerrs.Error
+	SignOutAll(SignOutRequest) dcubeerrs.Error
+	IsRevoked(sessionID string) bool
+}
+
+type SessionManagerImpl struct {
+	database        *gorm.DB
+	refreshTokenTTL time.Duration
+}
+
+func NewSessionManager(database *gorm.DB, refreshTokenTTL time.Duration) SessionManager {
+	return &SessionManagerImpl{
+		database:        database,
+		refreshTokenTTL: refreshTokenTTL,
+	}
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *SessionManagerImpl) CreateSession(userID uint) (*TokenResponse, dcubeerrs.Error) {
+	sessionID, err := randomString(sessionIDBytes, hex.EncodeToString)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating session")
+	}
+
+	loginSession := LoginSession{ID: sessionID, UserID: userID}
+	err = m.database.Create(&loginSession).Error
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating session")
+	}
+
+	return m.issueTokens(m.database, loginSession)
+}
+
+func (m *SessionManagerImpl) issueTokens(tx *gorm.DB, loginSession LoginSession) (*TokenResponse, dcubeerrs.Error) {
+	token, err := randomString(refreshTokenBytes, base64.RawURLEncoding.EncodeToString)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while issuing tokens")
+	}
+
+	refreshToken := RefreshToken{
+		SessionID: loginSession.ID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: time.Now().UTC().Add(m.refreshTokenTTL),
+	}
+
+	err = tx.Create(&refreshToken).Error
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while issuing tokens")
+	}
+
+	accessToken, err := GenerateToken(loginSession.UserID, loginSession.ID)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while issuing tokens")
+	}
+
+	return &TokenResponse{
+		AccessToken:           accessToken,
+		RefreshToken:          token,
+		RefreshTokenExpiresAt: refreshToken.ExpiresAt,
+	}, nil
+}
+
+func (m *SessionManagerImpl) Refresh(req RefreshRequest) (*TokenResponse, dcubeerrs.Error) {
+	var resp *TokenResponse
+	var dcubeErr dcubeerrs.Error
+	var reusedSessionID string
+
+	err := m.database.Transaction(func(tx *gorm.DB) error {
+		resp, reusedSessionID, dcubeErr = m.rotate(tx, hashRefreshToken(req.RefreshToken))
+
+		if dcubeErr != nil {
+			return errors.New(dcubeErr.Message())
+		}
+		return nil
+	})
+
+	// Revocation happens outside the transaction, which has been rolled back.
+	if reusedSessionID != "" {
+		if e := m.revoke(m.database.Where("id = ?", reusedSessionID)); e != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while refreshing session")
+		}
+	}
+
+	if dcubeErr != nil {
+		return nil, dcubeErr
+	}
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while refreshing session")
+	}
+
+	return resp, nil
+}
+
+// rotate exchanges the refresh token with the given hash for a new token pair.
+// When the token has already been used it returns the owning session's ID so
+// the caller can revoke it.
+func (m *SessionManagerImpl) rotate(tx *gorm.DB, tokenHash string) (*TokenResponse, string, dcubeerrs.Error) {
+	var refreshToken RefreshToken
+	err := tx.First(&refreshToken, RefreshToken{TokenHash: tokenHash}).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", dcubeerrs.New(http.StatusUnauthorized, "Invalid refresh token")
+		}
+		return nil, "", dcubeerrs.New(http.StatusInternalServerError, "An error occurred while refreshing session")
+	}
+
+	var loginSession LoginSession
+	err = tx.First(&loginSession, LoginSession{ID: refreshToken.SessionID}).Error
+
+	if err != nil {
+		return nil, "", dcubeerrs.New(http.StatusInternalServerError, "An error occurred while refreshing session")
+	}
+
+	if loginSession.RevokedAt != nil {
+		return nil, "", dcubeerrs.New(http.StatusUnauthorized, "Session has been revoked")
+	}
+
+	now := time.Now().UTC()
+	if !now.Before(refreshToken.ExpiresAt) {
+		return nil, "", dcubeerrs.New(http.StatusUnauthorized, "Refresh token has expired")
+	}
+
+	// A refresh token that was already exchanged is being presented again,
+	// so one of the two holders is not the legitimate client.
+	result := tx.Model(&RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", refreshToken.ID).
+		UpdateColumn("used_at", now)
+
+	if result.Error != nil {
+		return nil, "", dcubeerrs.New(http.StatusInternalServerError, "An error occurred while refreshing session")
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, loginSession.ID, dcubeerrs.New(http.StatusUnauthorized, "Refresh token has already been used; session revoked")
+	}
+
+	resp, dcubeErr := m.issueTokens(tx, loginSession)
+	return resp, "", dcubeErr
+}
+
+func (m *SessionManagerImpl) revoke(query *gorm.DB) error {
+	return query.Model(&LoginSession{}).
+		Where("revoked_at IS NULL").
+		UpdateColumn("revoked_at", time.Now().UTC()).Error
+}
+
+func (m *SessionManagerImpl) SignOut(req SignOutRequest) dcubeerrs.Error {
+	err := m.revoke(m.database.Where("id = ? AND user_id = ?", req.SessionID, req.UserID))
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while signing out")
+	}
+
+	return nil
+}
+
+func (m *SessionManagerImpl) SignOutAll(req SignOutRequest) dcubeerrs.Error {
+	err := m.revoke(m.database.Where("user_id = ?", req.UserID))
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while signing out")
+	}
+
+	return nil
+}
+
+func (m *SessionManagerImpl) IsRevoked(sessionID string) bool {
+	var loginSession LoginSession
+	err := m.database.First(&loginSession, LoginSession{ID: sessionID}).Error
+
+	if err != nil {
+		return true
+	}
+
+	return loginSession.RevokedAt != nil
+}
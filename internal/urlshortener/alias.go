@@ -0,0 +1,58 @@
+package urlshortener
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+)
+
+const minAliasLength = 3
+const maxAliasLength = 32
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// reservedAliases are path segments that must never be handed out as a
+// custom alias or generated code, stored lower-cased. The API's own top-level
+// routes are added with ReserveAliases when the router is built.
+var reservedAliases = map[string]bool{
+	"api": true,
+}
+var reservedMu sync.RWMutex
+
+// ReserveAliases prevents segments from being used as aliases or codes,
+// regardless of case.
+func ReserveAliases(segments ...string) {
+	reservedMu.Lock()
+	defer reservedMu.Unlock()
+
+	for _, segment := range segments {
+		reservedAliases[strings.ToLower(segment)] = true
+	}
+}
+
+func isReserved(alias string) bool {
+	reservedMu.RLock()
+	defer reservedMu.RUnlock()
+
+	return reservedAliases[strings.ToLower(alias)]
+}
+
+func validateAlias(alias string) dcubeerrs.Error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return dcubeerrs.New(http.StatusBadRequest, fmt.Sprintf("Alias must be between %d and %d characters long", minAliasLength, maxAliasLength))
+	}
+
+	if !aliasPattern.MatchString(alias) {
+		return dcubeerrs.New(http.StatusBadRequest, "Alias may only contain letters, digits, '-' and '_', and must start with a letter or digit")
+	}
+
+	if isReserved(alias) {
+		return dcubeerrs.New(http.StatusBadRequest, "Alias is reserved")
+	}
+
+	return nil
+}
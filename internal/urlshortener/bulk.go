@@ -0,0 +1,100 @@
+package urlshortener
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns lists the columns understood in bulk CSV uploads, in the order
+// assumed when the file has no header row.
+var csvColumns = []string{"original_url", "alias", "expires_at", "max_clicks", "redirect_type"}
+
+// ParseCSV reads bulk create rows from r. A header row naming the columns is
+// optional; without one the columns are read in csvColumns order.
+func ParseCSV(r io.Reader) ([]CreateRequest, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("csv file is empty")
+	}
+
+	columns := csvColumns
+	if strings.EqualFold(strings.TrimSpace(records[0][0]), csvColumns[0]) {
+		columns = make([]string, len(records[0]))
+		for i, name := range records[0] {
+			columns[i] = strings.ToLower(strings.TrimSpace(name))
+		}
+		records = records[1:]
+	}
+
+	if len(records) > MaxBulkURLs {
+		return nil, fmt.Errorf("csv file has more than %d rows", MaxBulkURLs)
+	}
+
+	requests := make([]CreateRequest, 0, len(records))
+
+	for i, record := range records {
+		req, err := parseCSVRecord(columns, record)
+
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+func parseCSVRecord(columns []string, record []string) (CreateRequest, error) {
+	var req CreateRequest
+
+	for i, value := range record {
+		if i >= len(columns) {
+			return req, errors.New("too many columns")
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		switch columns[i] {
+		case "original_url":
+			req.OriginalURL = value
+		case "alias":
+			req.Alias = value
+		case "expires_at":
+			expiresAt, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return req, errors.New("expires_at must be an RFC 3339 timestamp")
+			}
+			req.ExpiresAt = &expiresAt
+		case "max_clicks":
+			maxClicks, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return req, errors.New("max_clicks must be a non-negative integer")
+			}
+			req.MaxClicks = uint(maxClicks)
+		case "redirect_type":
+			req.RedirectType = value
+		default:
+			return req, fmt.Errorf("unknown column %q", columns[i])
+		}
+	}
+
+	return req, nil
+}
@@ -0,0 +1,250 @@
+package urlshortener
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+)
+
+const cacheKeyPrefix = "url:"
+
+// CachedRepository is a read-through cache for FindByShortened, the lookup
+// behind every redirect. Unknown codes are cached too, for negativeTTL. Every
+// write that can change what a code resolves to invalidates it; writes made
+// inside a transaction are invalidated once it commits.
+//
+// Clicks in a cached link may lag behind the database. Redirect does not
+// depend on them since IncrementClicks enforces the click budget itself.
+type CachedRepository struct {
+	Repository
+	cache       cache.Cache
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// generation is bumped on every invalidation. A lookup that raced with
+	// one does not store what it read, as it may predate the write.
+	generation *atomic.Uint64
+	// pending collects the codes to invalidate when the surrounding
+	// transaction commits. It is nil outside transactions.
+	pending *[]string
+}
+
+// cachedURL is the value stored in the cache. Found is false for codes that
+// do not exist.
+type cachedURL struct {
+	Found bool
+	URL   ShortenedURL
+}
+
+func NewCachedRepository(
+	repository Repository,
+	cache cache.Cache,
+	ttl time.Duration,
+	negativeTTL time.Duration,
+) Repository {
+	return &CachedRepository{
+		Repository:  repository,
+		cache:       cache,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		generation:  &atomic.Uint64{},
+	}
+}
+
+func (r *CachedRepository) FindByShortened(shortened string) (*ShortenedURL, error) {
+	// Reads inside a transaction must see its uncommitted writes.
+	if r.pending != nil {
+		return r.Repository.FindByShortened(shortened)
+	}
+
+	key := cacheKeyPrefix + shortened
+
+	if entry, ok := r.lookup(key); ok {
+		if !entry.Found {
+			return nil, ErrNotFound
+		}
+		return &entry.URL, nil
+	}
+
+	generation := r.generation.Load()
+	shortenedURL, err := r.Repository.FindByShortened(shortened)
+
+	switch {
+	case r.generation.Load() != generation:
+	case errors.Is(err, ErrNotFound):
+		r.store(key, cachedURL{}, r.negativeTTL)
+	case err == nil:
+		r.store(key, cachedURL{Found: true, URL: *shortenedURL}, r.ttl)
+	}
+
+	return shortenedURL, err
+}
+
+func (r *CachedRepository) Create(shortenedURL *ShortenedURL) error {
+	err := r.Repository.Create(shortenedURL)
+
+	if err == nil {
+		r.invalidate(shortenedURL.Shortened)
+	}
+
+	return err
+}
+
+func (r *CachedRepository) Update(shortenedURL *ShortenedURL, columns ...string) error {
+	codes := r.codesOf(shortenedURL.ID)
+	err := r.Repository.Update(shortenedURL, columns...)
+
+	if err == nil {
+		r.invalidate(append(codes, shortenedURL.Shortened)...)
+	}
+
+	return err
+}
+
+func (r *CachedRepository) Trash(id uint, now time.Time) error {
+	codes := r.codesOf(id)
+	err := r.Repository.Trash(id, now)
+
+	if err == nil {
+		r.invalidate(codes...)
+	}
+
+	return err
+}
+
+// Restore also clears the not found entry cached for the link's code while it
+// was in the trash.
+func (r *CachedRepository) Restore(id uint) error {
+	codes := r.codesOf(id)
+	err := r.Repository.Restore(id)
+
+	if err == nil {
+		r.invalidate(codes...)
+	}
+
+	return err
+}
+
+func (r *CachedRepository) Delete(id uint, reusableAt time.Time) error {
+	codes := r.codesOf(id)
+	err := r.Repository.Delete(id, reusableAt)
+
+	if err == nil {
+		r.invalidate(codes...)
+	}
+
+	return err
+}
+
+func (r *CachedRepository) Quarantine(id uint, reason string, now time.Time) error {
+	codes := r.codesOf(id)
+	err := r.Repository.Quarantine(id, reason, now)
+
+	if err == nil {
+		r.invalidate(codes...)
+	}
+
+	return err
+}
+
+func (r *CachedRepository) Transaction(fn func(Repository) error) error {
+	var commit func()
+
+	err := r.Repository.Transaction(func(tx Repository) error {
+		var joined Repository
+		joined, commit = r.Join(tx)
+		return fn(joined)
+	})
+
+	if err == nil {
+		commit()
+	}
+
+	return err
+}
+
+// Join caches lookups through tx, a repository bound to a transaction the
+// caller began, for transactions that span other tables too. Codes changed
+// through it are invalidated when the returned function is called, which
+// must only happen once the transaction has committed.
+func (r *CachedRepository) Join(tx Repository) (Repository, func()) {
+	var pending []string
+
+	joined := &CachedRepository{
+		Repository:  tx,
+		cache:       r.cache,
+		ttl:         r.ttl,
+		negativeTTL: r.negativeTTL,
+		generation:  r.generation,
+		pending:     &pending,
+	}
+
+	return joined, func() { r.invalidate(pending...) }
+}
+
+// codesOf returns the short code currently stored for id, if any, whether or
+// not the link is in the trash.
+func (r *CachedRepository) codesOf(id uint) []string {
+	shortenedURL, err := r.Repository.FindByID(id)
+
+	if errors.Is(err, ErrNotFound) {
+		shortenedURL, err = r.Repository.FindTrashed(id)
+	}
+	if err != nil {
+		return nil
+	}
+
+	return []string{shortenedURL.Shortened}
+}
+
+func (r *CachedRepository) invalidate(codes ...string) {
+	if r.pending != nil {
+		*r.pending = append(*r.pending, codes...)
+		return
+	}
+
+	if len(codes) == 0 {
+		return
+	}
+
+	r.generation.Add(1)
+	keys := make([]string, len(codes))
+	for i, code := range codes {
+		keys[i] = cacheKeyPrefix + code
+	}
+
+	if err := r.cache.Delete(keys...); err != nil {
+		log.Printf("url cache: invalidate %v: %s", codes, err)
+	}
+}
+
+func (r *CachedRepository) lookup(key string) (cachedURL, bool) {
+	var entry cachedURL
+	value, ok, err := r.cache.Get(key)
+
+	if err != nil || !ok {
+		return entry, false
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&entry); err != nil {
+		return entry, false
+	}
+
+	return entry, true
+}
+
+func (r *CachedRepository) store(key string, entry cachedURL, ttl time.Duration) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return
+	}
+
+	if err := r.cache.Set(key, buf.Bytes(), ttl); err != nil {
+		log.Printf("url cache: store %s: %s", key, err)
+	}
+}
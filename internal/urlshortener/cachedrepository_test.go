@@ -0,0 +1,89 @@
+package urlshortener
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCachedRepository() (Repository, Repository) {
+	backing := NewMemoryRepository()
+	cached := NewCachedRepository(backing, cache.NewLRU(100, time.Minute), time.Minute, time.Minute)
+	return cached, backing
+}
+
+func TestCachedRepositoryServesFromCache(t *testing.T) {
+	cached, backing := newTestCachedRepository()
+
+	backing.Create(&ShortenedURL{Original: "https://a.com", Shortened: "cached", UserID: 1})
+	found, err := cached.FindByShortened("cached")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), found.UserID)
+
+	// Writes that bypass the cache are not seen until the entry is invalidated.
+	backing.Delete(found.ID, time.Now())
+	found, err = cached.FindByShortened("cached")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://a.com", found.Original)
+}
+
+func TestCachedRepositoryNegativeCaching(t *testing.T) {
+	cached, backing := newTestCachedRepository()
+
+	_, err := cached.FindByShortened("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	backing.Create(&ShortenedURL{Original: "https://a.com", Shortened: "missing", UserID: 1})
+	_, err = cached.FindByShortened("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Creating through the cache clears the negative entry.
+	cached.Create(&ShortenedURL{Original: "https://b.com", Shortened: "created", UserID: 1})
+	cached.FindByShortened("created")
+	found, err := cached.FindByShortened("created")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://b.com", found.Original)
+}
+
+func TestCachedRepositoryInvalidation(t *testing.T) {
+	cached, _ := newTestCachedRepository()
+
+	shortenedURL := &ShortenedURL{Original: "https://a.com", Shortened: "old-code", UserID: 1}
+	cached.Create(shortenedURL)
+	cached.FindByShortened("old-code")
+	cached.FindByShortened("new-code")
+
+	err := cached.Transaction(func(tx Repository) error {
+		shortenedURL.Original = "https://b.com"
+		shortenedURL.Shortened = "new-code"
+		return tx.Update(shortenedURL, ColumnOriginal, ColumnShortened)
+	})
+	assert.Nil(t, err)
+
+	_, err = cached.FindByShortened("old-code")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	found, err := cached.FindByShortened("new-code")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://b.com", found.Original)
+
+	cached.Quarantine(found.ID, "flagged", time.Now())
+	found, _ = cached.FindByShortened("new-code")
+	assert.NotNil(t, found.QuarantinedAt)
+
+	cached.Trash(found.ID, time.Now())
+	_, err = cached.FindByShortened("new-code")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Restoring clears the not found entry cached while the link was in the
+	// trash.
+	cached.Restore(found.ID)
+	_, err = cached.FindByShortened("new-code")
+	assert.Nil(t, err)
+
+	cached.Delete(found.ID, time.Now())
+	_, err = cached.FindByShortened("new-code")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,226 @@
+package urlshortener
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const base62Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+const (
+	CodeStrategyRandom     = "random"
+	CodeStrategySequence   = "sequence"
+	CodeStrategyObfuscated = "obfuscated"
+	CodeStrategyHash       = "hash"
+)
+
+const DefaultCodeLength = 10
+const minCodeLength = 4
+
+// maxObfuscatedCodeLength keeps 62^length within a uint64.
+const maxObfuscatedCodeLength = 10
+const feistelRounds = 4
+
+var ErrSequenceExhausted = errors.New("code sequence exhausted")
+
+// CodeRequest carries what a CodeGenerator may base a short code on.
+type CodeRequest struct {
+	UserID   uint
+	Original string
+	// Attempt starts at zero and increases each time the previous code was
+	// already taken.
+	Attempt int
+	// NextSequence allocates a sequence number that is never handed out
+	// again.
+	NextSequence func() (uint64, error)
+}
+
+// CodeGenerator produces candidate short codes. Uniqueness is enforced by
+// the repository, which rejects taken codes with ErrDuplicate so that the
+// caller can ask for another candidate.
+type CodeGenerator interface {
+	Generate(req CodeRequest) (string, error)
+}
+
+// deduplicator is implemented by generators that derive the code from the
+// destination, so that a taken code may already be the link being created.
+type deduplicator interface {
+	Deduplicates() bool
+}
+
+// NewCodeGenerator returns the generator for strategy. salt keys the
+// obfuscated strategy and is ignored by the others.
+func NewCodeGenerator(strategy string, length int, salt string) (CodeGenerator, error) {
+	if length < minCodeLength || length > maxAliasLength {
+		return nil, fmt.Errorf("code length must be between %d and %d", minCodeLength, maxAliasLength)
+	}
+
+	switch strategy {
+	case CodeStrategyRandom, "":
+		return &RandomCodeGenerator{length: length}, nil
+	case CodeStrategySequence:
+		return &SequenceCodeGenerator{length: length}, nil
+	case CodeStrategyObfuscated:
+		if length > maxObfuscatedCodeLength {
+			return nil, fmt.Errorf("obfuscated codes may be at most %d characters long", maxObfuscatedCodeLength)
+		}
+		if salt == "" {
+			return nil, errors.New("obfuscated codes require a salt")
+		}
+		return &ObfuscatedCodeGenerator{length: length, key: []byte(salt)}, nil
+	case CodeStrategyHash:
+		return &HashCodeGenerator{length: length}, nil
+	}
+
+	return nil, fmt.Errorf("unknown code strategy %q", strategy)
+}
+
+// RandomCodeGenerator draws codes uniformly from the base62 alphabet using a
+// cryptographically secure source.
+type RandomCodeGenerator struct {
+	length int
+}
+
+func (g *RandomCodeGenerator) Generate(req CodeRequest) (string, error) {
+	limit := big.NewInt(int64(len(base62Alphabet)))
+	code := make([]byte, g.length)
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		code[i] = base62Alphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// SequenceCodeGenerator base62-encodes a database sequence, left-padded to
+// length. Codes are short and never collide but reveal how many links exist.
+type SequenceCodeGenerator struct {
+	length int
+}
+
+func (g *SequenceCodeGenerator) Generate(req CodeRequest) (string, error) {
+	n, err := req.NextSequence()
+
+	if err != nil {
+		return "", err
+	}
+
+	code := encodeBase62(n)
+
+	if len(code) < g.length {
+		code = strings.Repeat(base62Alphabet[:1], g.length-len(code)) + code
+	}
+
+	return code, nil
+}
+
+// ObfuscatedCodeGenerator maps a database sequence through a keyed
+// permutation of [0, 62^length), in the spirit of hashids: codes are unique
+// and fixed-length like sequence codes but cannot be enumerated without the
+// key.
+type ObfuscatedCodeGenerator struct {
+	length int
+	key    []byte
+}
+
+func (g *ObfuscatedCodeGenerator) Generate(req CodeRequest) (string, error) {
+	n, err := req.NextSequence()
+
+	if err != nil {
+		return "", err
+	}
+
+	domain := uint64(1)
+	for i := 0; i < g.length; i++ {
+		domain *= uint64(len(base62Alphabet))
+	}
+
+	if n >= domain {
+		return "", ErrSequenceExhausted
+	}
+
+	// Cycle-walk the Feistel permutation, which covers a power of four, until
+	// it lands back inside the domain. This keeps the mapping a bijection.
+	halfBits := uint(bits.Len64(domain-1)+1) / 2
+	permuted := g.feistel(n, halfBits)
+	for permuted >= domain {
+		permuted = g.feistel(permuted, halfBits)
+	}
+
+	code := encodeBase62(permuted)
+
+	return strings.Repeat(base62Alphabet[:1], g.length-len(code)) + code, nil
+}
+
+func (g *ObfuscatedCodeGenerator) feistel(n uint64, halfBits uint) uint64 {
+	mask := uint64(1)<<halfBits - 1
+	left, right := n>>halfBits, n&mask
+
+	for round := 0; round < feistelRounds; round++ {
+		mac := hmac.New(sha256.New, g.key)
+		var block [9]byte
+		block[0] = byte(round)
+		binary.BigEndian.PutUint64(block[1:], right)
+		mac.Write(block[:])
+
+		f := binary.BigEndian.Uint64(mac.Sum(nil)) & mask
+		left, right = right, left^f
+	}
+
+	return left<<halfBits | right
+}
+
+// HashCodeGenerator derives the code from the owner and destination, so that
+// shortening the same URL twice returns the existing link. Later attempts
+// mix in the attempt number to get past codes taken by other links.
+type HashCodeGenerator struct {
+	length int
+}
+
+func (g *HashCodeGenerator) Generate(req CodeRequest) (string, error) {
+	input := strconv.FormatUint(uint64(req.UserID), 10) + "\n" + req.Original
+	if req.Attempt > 0 {
+		input += "\n" + strconv.Itoa(req.Attempt)
+	}
+
+	sum := sha256.Sum256([]byte(input))
+	code := new(big.Int).SetBytes(sum[:]).Text(len(base62Alphabet))
+
+	if len(code) < g.length {
+		code = strings.Repeat("0", g.length-len(code)) + code
+	}
+
+	return code[len(code)-g.length:], nil
+}
+
+func (g *HashCodeGenerator) Deduplicates() bool {
+	return true
+}
+
+func encodeBase62(n uint64) string {
+	if n == 0 {
+		return base62Alphabet[:1]
+	}
+
+	base := uint64(len(base62Alphabet))
+	var code []byte
+
+	for n > 0 {
+		code = append([]byte{base62Alphabet[n%base]}, code...)
+		n /= base
+	}
+
+	return string(code)
+}
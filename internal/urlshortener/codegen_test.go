@@ -0,0 +1,110 @@
+package urlshortener
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sequenceFrom(start uint64) func() (uint64, error) {
+	next := start
+	return func() (uint64, error) {
+		next++
+		return next - 1, nil
+	}
+}
+
+func TestCodeGeneratorStrategies(t *testing.T) {
+	for _, strategy := range []string{
+		CodeStrategyRandom, CodeStrategySequence, CodeStrategyObfuscated, CodeStrategyHash,
+	} {
+		codes, err := NewCodeGenerator(strategy, 6, "salt")
+		assert.Nil(t, err)
+
+		seen := map[string]bool{}
+		sequence := sequenceFrom(1)
+
+		for i := 0; i < 1000; i++ {
+			code, err := codes.Generate(CodeRequest{
+				UserID:       1,
+				Original:     "https://example.com/" + encodeBase62(uint64(i)),
+				NextSequence: sequence,
+			})
+			assert.Nil(t, err)
+			assert.Len(t, code, 6, strategy)
+			assert.Regexp(t, "^[A-Za-z0-9]+$", code)
+			assert.False(t, seen[code], strategy)
+			seen[code] = true
+		}
+	}
+}
+
+func TestCodeGeneratorConfiguration(t *testing.T) {
+	_, err := NewCodeGenerator(CodeStrategyRandom, 2, "")
+	assert.NotNil(t, err)
+
+	_, err = NewCodeGenerator(CodeStrategyObfuscated, 8, "")
+	assert.NotNil(t, err)
+
+	_, err = NewCodeGenerator(CodeStrategyObfuscated, 12, "salt")
+	assert.NotNil(t, err)
+
+	_, err = NewCodeGenerator("sequential", 8, "")
+	assert.NotNil(t, err)
+}
+
+func TestSequenceAndObfuscatedCodes(t *testing.T) {
+	sequence, _ := NewCodeGenerator(CodeStrategySequence, 4, "")
+	code, _ := sequence.Generate(CodeRequest{NextSequence: sequenceFrom(62)})
+	assert.Equal(t, "aaba", code)
+
+	first, _ := NewCodeGenerator(CodeStrategyObfuscated, 4, "one")
+	second, _ := NewCodeGenerator(CodeStrategyObfuscated, 4, "two")
+	a, _ := first.Generate(CodeRequest{NextSequence: sequenceFrom(1)})
+	b, _ := second.Generate(CodeRequest{NextSequence: sequenceFrom(1)})
+	again, _ := first.Generate(CodeRequest{NextSequence: sequenceFrom(1)})
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, a, again)
+
+	_, err := first.Generate(CodeRequest{NextSequence: sequenceFrom(62 * 62 * 62 * 62)})
+	assert.ErrorIs(t, err, ErrSequenceExhausted)
+}
+
+func TestHashCodesDeduplicate(t *testing.T) {
+	codes, _ := NewCodeGenerator(CodeStrategyHash, DefaultCodeLength, "")
+	manager, _ := newTestManagerWithCodes(codes)
+
+	first, err := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com/dedupe"})
+	assert.Nil(t, err)
+
+	second, err := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com/dedupe"})
+	assert.Nil(t, err)
+	assert.Equal(t, first.ShortenedURL.ID, second.ShortenedURL.ID)
+
+	other, err := manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.com/dedupe"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.ShortenedURL.Shortened, other.ShortenedURL.Shortened)
+}
+
+// fixedCodes hands out its codes in order, to force collisions.
+type fixedCodes []string
+
+func (f fixedCodes) Generate(req CodeRequest) (string, error) {
+	return f[req.Attempt%len(f)], nil
+}
+
+func TestGeneratedCodeRetriesOnCollision(t *testing.T) {
+	manager, repository := newTestManagerWithCodes(fixedCodes{"taken", "API", "fresh"})
+	repository.Create(&ShortenedURL{Original: "https://a.com", Shortened: "taken", UserID: 1})
+
+	created, err := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", created.ShortenedURL.Shortened)
+
+	manager, repository = newTestManagerWithCodes(fixedCodes{"taken"})
+	repository.Create(&ShortenedURL{Original: "https://a.com", Shortened: "taken", UserID: 1})
+
+	_, err = manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com"})
+	assert.Equal(t, http.StatusServiceUnavailable, err.StatusCode())
+}
@@ -0,0 +1,92 @@
+package urlshortener
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	SortCreatedAt = "created_at"
+	SortClicks    = "clicks"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last link of a page. It records the sort it was issued for
+// so that it cannot be replayed against a different ordering.
+//
+// Links are numbered in creation order, so sorting by created_at is done on
+// the ID. This keeps cursors exact even where the database stores created_at
+// with only second precision.
+type Cursor struct {
+	Sort   string `json:"s"`
+	Order  string `json:"o"`
+	ID     uint   `json:"i"`
+	Clicks uint   `json:"k,omitempty"`
+}
+
+func newCursor(sort string, order string, last ShortenedURL) Cursor {
+	return Cursor{
+		Sort:   sort,
+		Order:  order,
+		ID:     last.ID,
+		Clicks: last.Clicks,
+	}
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, sort string, order string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var cursor Cursor
+
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+
+	if cursor.Sort != sort || cursor.Order != order {
+		return nil, errInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// after reports whether s sorts strictly after the cursor position.
+func (c Cursor) after(s ShortenedURL) bool {
+	var cmp int
+
+	if c.Sort == SortClicks {
+		cmp = compareUint(s.Clicks, c.Clicks)
+	}
+
+	if cmp == 0 {
+		cmp = compareUint(s.ID, c.ID)
+	}
+
+	if c.Order == OrderAsc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func compareUint(a uint, b uint) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
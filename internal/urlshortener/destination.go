@@ -0,0 +1,118 @@
+package urlshortener
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"golang.org/x/net/idna"
+)
+
+const maxDestinationLength = 2048
+const destinationField = "original_url"
+
+// allowedSchemes lists the schemes a short link may redirect to, mapped to
+// their default port so it can be stripped from the normalized URL.
+var allowedSchemes = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// DestinationValidator parses and normalizes destination URLs, rejecting
+// anything that is not an absolute web URL or that points back at one of our
+// own short links.
+type DestinationValidator struct {
+	selfHosts map[string]bool
+}
+
+// NewDestinationValidator builds a validator that treats the given hosts as
+// our own short link domains.
+func NewDestinationValidator(selfHosts []string) *DestinationValidator {
+	v := &DestinationValidator{selfHosts: make(map[string]bool)}
+
+	for _, host := range selfHosts {
+		host = strings.TrimSpace(host)
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if host == "" {
+			continue
+		}
+		if normalized, err := normalizeHost(host); err == nil {
+			v.selfHosts[normalized] = true
+		}
+	}
+
+	return v
+}
+
+// Normalize returns the canonical form of raw: lowercase scheme and host, the
+// host converted to punycode and the scheme's default port removed.
+func (v *DestinationValidator) Normalize(raw string) (string, dcubeerrs.Error) {
+	raw = strings.TrimSpace(raw)
+
+	if raw == "" {
+		return "", invalidDestination("URL is required")
+	}
+	if len(raw) > maxDestinationLength {
+		return "", invalidDestination(fmt.Sprintf("URL must be at most %d characters long", maxDestinationLength))
+	}
+
+	u, err := url.Parse(raw)
+
+	if err != nil {
+		return "", invalidDestination("URL could not be parsed")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	defaultPort, ok := allowedSchemes[u.Scheme]
+
+	if !ok {
+		return "", invalidDestination("URL must be an absolute http or https URL")
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", invalidDestination("URL must include a host")
+	}
+	if u.User != nil {
+		return "", invalidDestination("URL must not contain credentials")
+	}
+
+	host, err := normalizeHost(u.Hostname())
+
+	if err != nil {
+		return "", invalidDestination("URL host is not a valid domain name")
+	}
+
+	if v.selfHosts[host] && strings.HasPrefix(u.EscapedPath(), "/r/") {
+		return "", invalidDestination("URL must not point to another short link")
+	}
+
+	switch port := u.Port(); {
+	case port != "" && port != defaultPort:
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	return u.String(), nil
+}
+
+// normalizeHost lowercases host, drops a trailing dot and converts
+// internationalized names to their ASCII form. IP literals are left as is.
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	return idna.Lookup.ToASCII(host)
+}
+
+func invalidDestination(message string) dcubeerrs.Error {
+	return dcubeerrs.NewValidation(dcubeerrs.FieldError{Field: destinationField, Message: message})
+}
@@ -0,0 +1,36 @@
+package urlshortener
+
+// Events is told about changes to links once they have been made, for
+// example to notify webhook subscribers. LinkClicked is called while
+// redirecting, so implementations must not wait on anything slow.
+type Events interface {
+	LinkCreated(ShortenedURL)
+	// LinkDeleted is called when a link is moved to the trash.
+	LinkDeleted(ShortenedURL)
+	// LinkExpired is called when the expiry sweeper archives a link that
+	// has expired or used up its click budget.
+	LinkExpired(ShortenedURL)
+	// LinkClicked is called for every counted click with the click count
+	// including it.
+	LinkClicked(shortenedURL ShortenedURL, clicks uint)
+}
+
+// NopEvents ignores all events.
+type NopEvents struct{}
+
+func (NopEvents) LinkCreated(ShortenedURL)       {}
+func (NopEvents) LinkDeleted(ShortenedURL)       {}
+func (NopEvents) LinkExpired(ShortenedURL)       {}
+func (NopEvents) LinkClicked(ShortenedURL, uint) {}
+
+// Purger removes what other packages keep about links, such as their clicks,
+// when the links are deleted for good. It is called before the links
+// themselves are deleted, so that nothing is left behind if it fails.
+type Purger interface {
+	PurgeLinks(shortenedURLIDs []uint) error
+}
+
+// NopPurger has nothing to remove.
+type NopPurger struct{}
+
+func (NopPurger) PurgeLinks([]uint) error { return nil }
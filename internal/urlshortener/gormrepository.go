@@ -0,0 +1,349 @@
+package urlshortener
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormRepository struct {
+	database *gorm.DB
+}
+
+func NewGormRepository(database *gorm.DB) Repository {
+	return &GormRepository{
+		database: database,
+	}
+}
+
+func (r *GormRepository) find(query ShortenedURL) (*ShortenedURL, error) {
+	var shortenedURL ShortenedURL
+	err := r.database.First(&shortenedURL, query).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &shortenedURL, nil
+}
+
+func (r *GormRepository) FindByID(id uint) (*ShortenedURL, error) {
+	return r.find(ShortenedURL{ID: id})
+}
+
+func (r *GormRepository) FindByShortened(shortened string) (*ShortenedURL, error) {
+	return r.find(ShortenedURL{Shortened: shortened})
+}
+
+func (r *GormRepository) List(filter ListFilter) ([]ShortenedURL, error) {
+	var shortenedURLs []ShortenedURL
+
+	query := r.filter(filter)
+
+	direction, comparison := "DESC", "<"
+	if filter.Order == OrderAsc {
+		direction, comparison = "ASC", ">"
+	}
+
+	// See Cursor for why created_at ordering uses the ID alone.
+	if filter.Sort == SortClicks {
+		if filter.After != nil {
+			condition := fmt.Sprintf("clicks %[1]s ? OR (clicks = ? AND id %[1]s ?)", comparison)
+			query = query.Where(condition, filter.After.Clicks, filter.After.Clicks, filter.After.ID)
+		}
+		query = query.Order("clicks " + direction)
+	} else if filter.After != nil {
+		query = query.Where("id "+comparison+" ?", filter.After.ID)
+	}
+
+	query = query.Order("id " + direction)
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	err := query.Find(&shortenedURLs).Error
+
+	return shortenedURLs, err
+}
+
+func (r *GormRepository) Count(filter ListFilter) (int64, error) {
+	var count int64
+	err := r.filter(filter).Count(&count).Error
+	return count, err
+}
+
+// filter builds the query for the conditions of filter other than its
+// ordering, After and Limit.
+func (r *GormRepository) filter(filter ListFilter) *gorm.DB {
+	query := r.database.Model(&ShortenedURL{})
+
+	switch {
+	case filter.AllUsers && filter.UserID != 0:
+		query = query.Where("user_id = ?", filter.UserID)
+	case filter.AllUsers:
+	case filter.WorkspaceID != nil:
+		query = query.Where("workspace_id = ?", *filter.WorkspaceID)
+	default:
+		query = query.Where("user_id = ? AND workspace_id IS NULL", filter.UserID)
+	}
+
+	switch filter.State {
+	case StateTrashed:
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+		if filter.DeletedBefore != nil {
+			query = query.Where("deleted_at < ?", *filter.DeletedBefore)
+		}
+	case StateQuarantined:
+		query = query.Where("quarantined_at IS NOT NULL")
+	case StateActive:
+		query = query.Where("archived_at IS NULL").
+			Where("expires_at IS NULL OR expires_at > ?", filter.Now).
+			Where("max_clicks = 0 OR clicks < max_clicks")
+	case StateExpired:
+		query = query.Where(
+			"archived_at IS NOT NULL OR (expires_at IS NOT NULL AND expires_at <= ?) OR (max_clicks > 0 AND clicks >= max_clicks)",
+			filter.Now,
+		)
+	}
+
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at <= ?", *filter.CreatedTo)
+	}
+	if filter.Query != "" {
+		query = query.Where(`LOWER(original) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(filter.Query))+"%")
+	}
+	if filter.Tag != "" {
+		query = query.Where(`tags LIKE ? ESCAPE '\'`, "%,"+escapeLike(filter.Tag)+",%")
+	}
+
+	return query
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *GormRepository) Create(shortenedURL *ShortenedURL) error {
+	if err := r.checkRetired(shortenedURL.Shortened); err != nil {
+		return err
+	}
+
+	// ON CONFLICT DO NOTHING reports a taken code without raising an error,
+	// which in Postgres would abort the surrounding transaction. It has no
+	// target so that it also covers codes taken in a different case.
+	result := r.database.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(shortenedURL)
+
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) || (result.Error == nil && result.RowsAffected == 0) {
+		return ErrDuplicate
+	}
+
+	return result.Error
+}
+
+func (r *GormRepository) NextSequence() (uint64, error) {
+	var sequence CodeSequence
+	err := r.database.Create(&sequence).Error
+
+	return sequence.ID, err
+}
+
+// checkRetired returns ErrDuplicate if code is retired.
+func (r *GormRepository) checkRetired(code string) error {
+	var retired int64
+	err := r.database.Model(&RetiredCode{}).Where("code = ?", code).Count(&retired).Error
+
+	if err == nil && retired > 0 {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+func (r *GormRepository) Update(shortenedURL *ShortenedURL, columns ...string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+
+	for _, column := range columns {
+		if column != ColumnShortened {
+			continue
+		}
+		if err := r.checkRetired(shortenedURL.Shortened); err != nil {
+			return err
+		}
+	}
+
+	// Unscoped so that links in the trash can be updated too.
+	err := r.database.Unscoped().
+		Model(shortenedURL).
+		Omit(clause.Associations).
+		Select(columns).
+		Updates(shortenedURL).Error
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+func (r *GormRepository) CreateRevision(revision *URLRevision) error {
+	return r.database.Create(revision).Error
+}
+
+func (r *GormRepository) ListRevisions(urlID uint) ([]URLRevision, error) {
+	var revisions []URLRevision
+	err := r.database.Where("shortened_url_id = ?", urlID).Order("id DESC").Find(&revisions).Error
+
+	return revisions, err
+}
+
+func (r *GormRepository) FindRevision(urlID uint, revisionID uint) (*URLRevision, error) {
+	var revision URLRevision
+	err := r.database.First(&revision, URLRevision{ID: revisionID, ShortenedURLID: urlID}).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (r *GormRepository) Trash(id uint, now time.Time) error {
+	result := r.database.Model(&ShortenedURL{}).Where("id = ?", id).Update("deleted_at", now)
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return result.Error
+}
+
+func (r *GormRepository) FindTrashed(id uint) (*ShortenedURL, error) {
+	var shortenedURL ShortenedURL
+	err := r.database.Unscoped().Where("deleted_at IS NOT NULL").First(&shortenedURL, id).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &shortenedURL, nil
+}
+
+func (r *GormRepository) Restore(id uint) error {
+	result := r.database.Unscoped().Model(&ShortenedURL{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return result.Error
+}
+
+func (r *GormRepository) Delete(id uint, reusableAt time.Time) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		var shortenedURL ShortenedURL
+		err := tx.Unscoped().First(&shortenedURL, id).Error
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		retired := RetiredCode{Code: shortenedURL.Shortened, ReusableAt: reusableAt}
+		err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&retired).Error
+
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("shortened_url_id = ?", id).Delete(&URLRevision{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&ShortenedURL{}, id).Error
+	})
+}
+
+func (r *GormRepository) ReleaseCodes(now time.Time) (int64, error) {
+	result := r.database.Where("reusable_at <= ?", now).Delete(&RetiredCode{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *GormRepository) IncrementClicks(id uint) (uint, error) {
+	var clicks uint
+
+	err := r.database.Transaction(func(tx *gorm.DB) error {
+		// The click budget is enforced in the update itself so that concurrent
+		// redirects cannot overshoot max_clicks. The update also locks the
+		// row, so the count read back does not include later clicks.
+		result := tx.Model(&ShortenedURL{}).
+			Where("id = ? AND (max_clicks = 0 OR clicks < max_clicks)", id).
+			UpdateColumn("clicks", gorm.Expr("clicks + 1"))
+
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return tx.Model(&ShortenedURL{}).Where("id = ?", id).Select("clicks").Scan(&clicks).Error
+	})
+
+	return clicks, err
+}
+
+func (r *GormRepository) ArchiveExpired(now time.Time) ([]ShortenedURL, error) {
+	var archived []ShortenedURL
+	// The links archived here are read back by their archived_at, which sets
+	// them apart from those archived by a sweep on another instance. It is
+	// truncated to what postgres keeps so that it compares equal.
+	now = now.Truncate(time.Microsecond)
+
+	err := r.database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&ShortenedURL{}).
+			Where("archived_at IS NULL").
+			Where("(expires_at IS NOT NULL AND expires_at <= ?) OR (max_clicks > 0 AND clicks >= max_clicks)", now).
+			UpdateColumn("archived_at", now).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("archived_at = ?", now).Find(&archived).Error
+	})
+
+	return archived, err
+}
+
+func (r *GormRepository) Quarantine(id uint, reason string, now time.Time) error {
+	return r.database.Model(&ShortenedURL{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"quarantined_at": now, "quarantine_reason": reason}).Error
+}
+
+func (r *GormRepository) Transaction(fn func(Repository) error) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		return fn(&GormRepository{database: tx})
+	})
+}
@@ -0,0 +1,443 @@
+package urlshortener
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryRepository keeps links in process memory. It is meant for tests and
+// local development, not for production use.
+type MemoryRepository struct {
+	mu        sync.RWMutex
+	nextID    uint
+	sequence  uint64
+	urls      map[uint]ShortenedURL
+	revisions []URLRevision
+	// retired maps retired codes to the time they become reusable.
+	retired map[string]time.Time
+}
+
+func NewMemoryRepository() Repository {
+	return &MemoryRepository{
+		nextID:  1,
+		urls:    make(map[uint]ShortenedURL),
+		retired: make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryRepository) FindByID(id uint) (*ShortenedURL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	shortenedURL, ok := r.urls[id]
+
+	if !ok || shortenedURL.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+
+	return &shortenedURL, nil
+}
+
+func (r *MemoryRepository) FindByShortened(shortened string) (*ShortenedURL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, shortenedURL := range r.urls {
+		if shortenedURL.Shortened == shortened && !shortenedURL.DeletedAt.Valid {
+			return &shortenedURL, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) List(filter ListFilter) ([]ShortenedURL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	shortenedURLs := []ShortenedURL{}
+
+	for _, shortenedURL := range r.urls {
+		if matchesFilter(shortenedURL, filter) {
+			shortenedURLs = append(shortenedURLs, shortenedURL)
+		}
+	}
+
+	order := Cursor{Sort: filter.Sort, Order: filter.Order}
+	sort.Slice(shortenedURLs, func(i, j int) bool {
+		order.ID = shortenedURLs[i].ID
+		order.Clicks = shortenedURLs[i].Clicks
+		return order.after(shortenedURLs[j])
+	})
+
+	if filter.Limit > 0 && len(shortenedURLs) > filter.Limit {
+		shortenedURLs = shortenedURLs[:filter.Limit]
+	}
+
+	return shortenedURLs, nil
+}
+
+func (r *MemoryRepository) Count(filter ListFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	filter.After = nil
+
+	for _, shortenedURL := range r.urls {
+		if matchesFilter(shortenedURL, filter) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func matchesFilter(shortenedURL ShortenedURL, filter ListFilter) bool {
+	if shortenedURL.DeletedAt.Valid != (filter.State == StateTrashed) {
+		return false
+	}
+
+	switch {
+	case filter.AllUsers && filter.UserID != 0 && shortenedURL.UserID != filter.UserID:
+		return false
+	case filter.AllUsers:
+	case filter.WorkspaceID != nil && !sameWorkspace(shortenedURL.WorkspaceID, filter.WorkspaceID):
+		return false
+	case filter.WorkspaceID == nil && (shortenedURL.UserID != filter.UserID || shortenedURL.WorkspaceID != nil):
+		return false
+	}
+
+	switch {
+	case filter.DeletedBefore != nil && !shortenedURL.DeletedAt.Time.Before(*filter.DeletedBefore):
+		return false
+	case filter.State == StateQuarantined && shortenedURL.QuarantinedAt == nil:
+		return false
+	case filter.State == StateActive && shortenedURL.IsExpired(filter.Now):
+		return false
+	case filter.State == StateExpired && !shortenedURL.IsExpired(filter.Now):
+		return false
+	case filter.CreatedFrom != nil && shortenedURL.CreatedAt.Before(*filter.CreatedFrom):
+		return false
+	case filter.CreatedTo != nil && shortenedURL.CreatedAt.After(*filter.CreatedTo):
+		return false
+	case filter.Query != "" && !strings.Contains(strings.ToLower(shortenedURL.Original), strings.ToLower(filter.Query)):
+		return false
+	case filter.Tag != "" && !shortenedURL.Tags.Contains(filter.Tag):
+		return false
+	case filter.After != nil && !filter.After.after(shortenedURL):
+		return false
+	}
+	return true
+}
+
+func (r *MemoryRepository) Create(shortenedURL *ShortenedURL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.retired[shortenedURL.Shortened]; ok {
+		return ErrDuplicate
+	}
+
+	for _, existing := range r.urls {
+		if strings.EqualFold(existing.Shortened, shortenedURL.Shortened) {
+			return ErrDuplicate
+		}
+	}
+
+	if shortenedURL.ID == 0 {
+		shortenedURL.ID = r.nextID
+	}
+	if shortenedURL.ID >= r.nextID {
+		r.nextID = shortenedURL.ID + 1
+	}
+	if shortenedURL.CreatedAt.IsZero() {
+		shortenedURL.CreatedAt = time.Now()
+	}
+
+	r.urls[shortenedURL.ID] = *shortenedURL
+
+	return nil
+}
+
+func (r *MemoryRepository) Update(shortenedURL *ShortenedURL, columns ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.urls[shortenedURL.ID]
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	for _, column := range columns {
+		switch column {
+		case ColumnOriginal:
+			stored.Original = shortenedURL.Original
+		case ColumnShortened:
+			if _, ok := r.retired[shortenedURL.Shortened]; ok {
+				return ErrDuplicate
+			}
+			for id, existing := range r.urls {
+				if id != shortenedURL.ID && strings.EqualFold(existing.Shortened, shortenedURL.Shortened) {
+					return ErrDuplicate
+				}
+			}
+			stored.Shortened = shortenedURL.Shortened
+		case ColumnExpiresAt:
+			stored.ExpiresAt = shortenedURL.ExpiresAt
+		case ColumnMaxClicks:
+			stored.MaxClicks = shortenedURL.MaxClicks
+		case ColumnRedirectType:
+			stored.RedirectType = shortenedURL.RedirectType
+		case ColumnTags:
+			stored.Tags = shortenedURL.Tags
+		case ColumnWorkspaceID:
+			stored.WorkspaceID = shortenedURL.WorkspaceID
+		case ColumnUserID:
+			stored.UserID = shortenedURL.UserID
+		case ColumnArchivedAt:
+			stored.ArchivedAt = shortenedURL.ArchivedAt
+		case ColumnQuarantinedAt:
+			stored.QuarantinedAt = shortenedURL.QuarantinedAt
+		case ColumnQuarantineReason:
+			stored.QuarantineReason = shortenedURL.QuarantineReason
+		}
+	}
+
+	r.urls[shortenedURL.ID] = stored
+
+	return nil
+}
+
+func (r *MemoryRepository) NextSequence() (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sequence++
+
+	return r.sequence, nil
+}
+
+func (r *MemoryRepository) CreateRevision(revision *URLRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revision.ID = uint(len(r.revisions) + 1)
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+
+	r.revisions = append(r.revisions, *revision)
+
+	return nil
+}
+
+func (r *MemoryRepository) ListRevisions(urlID uint) ([]URLRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revisions := []URLRevision{}
+
+	for i := len(r.revisions) - 1; i >= 0; i-- {
+		if r.revisions[i].ShortenedURLID == urlID {
+			revisions = append(revisions, r.revisions[i])
+		}
+	}
+
+	return revisions, nil
+}
+
+func (r *MemoryRepository) FindRevision(urlID uint, revisionID uint) (*URLRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, revision := range r.revisions {
+		if revision.ID == revisionID && revision.ShortenedURLID == urlID {
+			return &revision, nil
+		}
+	}
+
+	return nil, ErrRevisionNotFound
+}
+
+func (r *MemoryRepository) Trash(id uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shortenedURL, ok := r.urls[id]
+
+	if !ok || shortenedURL.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	shortenedURL.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	r.urls[id] = shortenedURL
+
+	return nil
+}
+
+func (r *MemoryRepository) FindTrashed(id uint) (*ShortenedURL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	shortenedURL, ok := r.urls[id]
+
+	if !ok || !shortenedURL.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+
+	return &shortenedURL, nil
+}
+
+func (r *MemoryRepository) Restore(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shortenedURL, ok := r.urls[id]
+
+	if !ok || !shortenedURL.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	shortenedURL.DeletedAt = gorm.DeletedAt{}
+	r.urls[id] = shortenedURL
+
+	return nil
+}
+
+func (r *MemoryRepository) Delete(id uint, reusableAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shortenedURL, ok := r.urls[id]
+
+	if !ok {
+		return nil
+	}
+
+	r.retired[shortenedURL.Shortened] = reusableAt
+	delete(r.urls, id)
+
+	revisions := r.revisions[:0]
+	for _, revision := range r.revisions {
+		if revision.ShortenedURLID != id {
+			revisions = append(revisions, revision)
+		}
+	}
+	r.revisions = revisions
+
+	return nil
+}
+
+func (r *MemoryRepository) ReleaseCodes(now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var released int64
+
+	for code, reusableAt := range r.retired {
+		if !reusableAt.After(now) {
+			delete(r.retired, code)
+			released++
+		}
+	}
+
+	return released, nil
+}
+
+func (r *MemoryRepository) IncrementClicks(id uint) (uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shortenedURL, ok := r.urls[id]
+
+	if !ok || shortenedURL.DeletedAt.Valid {
+		return 0, nil
+	}
+	if shortenedURL.MaxClicks > 0 && shortenedURL.Clicks >= shortenedURL.MaxClicks {
+		return 0, nil
+	}
+
+	shortenedURL.Clicks++
+	r.urls[id] = shortenedURL
+
+	return shortenedURL.Clicks, nil
+}
+
+func (r *MemoryRepository) ArchiveExpired(now time.Time) ([]ShortenedURL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var archived []ShortenedURL
+
+	for id, shortenedURL := range r.urls {
+		if shortenedURL.ArchivedAt == nil && !shortenedURL.DeletedAt.Valid && shortenedURL.IsExpired(now) {
+			archivedAt := now
+			shortenedURL.ArchivedAt = &archivedAt
+			r.urls[id] = shortenedURL
+			archived = append(archived, shortenedURL)
+		}
+	}
+
+	return archived, nil
+}
+
+func (r *MemoryRepository) Quarantine(id uint, reason string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shortenedURL, ok := r.urls[id]
+
+	if !ok || shortenedURL.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	quarantinedAt := now
+	shortenedURL.QuarantinedAt = &quarantinedAt
+	shortenedURL.QuarantineReason = reason
+	r.urls[id] = shortenedURL
+
+	return nil
+}
+
+// Transaction runs fn against a copy of the repository and swaps the copy in
+// only if fn succeeds. Other callers are blocked until fn returns.
+func (r *MemoryRepository) Transaction(fn func(Repository) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &MemoryRepository{
+		nextID:    r.nextID,
+		sequence:  r.sequence,
+		urls:      make(map[uint]ShortenedURL, len(r.urls)),
+		revisions: append([]URLRevision{}, r.revisions...),
+		retired:   make(map[string]time.Time, len(r.retired)),
+	}
+	for id, shortenedURL := range r.urls {
+		tx.urls[id] = shortenedURL
+	}
+	for code, reusableAt := range r.retired {
+		tx.retired[code] = reusableAt
+	}
+
+	// Like a database sequence, numbers taken inside a failed transaction
+	// are not handed out again.
+	err := fn(tx)
+	r.sequence = tx.sequence
+
+	if err != nil {
+		return err
+	}
+
+	r.nextID = tx.nextID
+	r.urls = tx.urls
+	r.revisions = tx.revisions
+	r.retired = tx.retired
+
+	return nil
+}
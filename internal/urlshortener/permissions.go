@@ -0,0 +1,62 @@
+package urlshortener
+
+import (
+	"net/http"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+)
+
+const (
+	VerbView   = "view"
+	VerbCreate = "create"
+	VerbUpdate = "update"
+	VerbDelete = "delete"
+)
+
+// Permissions reports what a user may do with the links of a workspace.
+type Permissions interface {
+	CanView(userID uint, workspaceID uint) (bool, error)
+	CanEdit(userID uint, workspaceID uint) (bool, error)
+}
+
+// Authorize checks that userID may act on shortenedURL. Links outside of a
+// workspace are only accessible to the user who created them. Workspace links
+// need view access to be looked at and edit access for anything else. verb
+// names the attempted action in the error.
+func Authorize(permissions Permissions, shortenedURL *ShortenedURL, userID uint, verb string) dcubeerrs.Error {
+	if shortenedURL.WorkspaceID != nil {
+		return authorizeWorkspace(permissions, *shortenedURL.WorkspaceID, userID, verb)
+	}
+
+	if shortenedURL.UserID != userID {
+		return dcubeerrs.New(http.StatusForbidden, "User is trying to "+verb+" other users records")
+	}
+
+	return nil
+}
+
+func authorizeWorkspace(permissions Permissions, workspaceID uint, userID uint, verb string) dcubeerrs.Error {
+	check := permissions.CanEdit
+	if verb == VerbView {
+		check = permissions.CanView
+	}
+
+	allowed, err := check(userID, workspaceID)
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while checking permissions")
+	}
+	if !allowed {
+		return dcubeerrs.New(http.StatusForbidden, "User is not allowed to "+verb+" links in this workspace")
+	}
+
+	return nil
+}
+
+func sameWorkspace(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
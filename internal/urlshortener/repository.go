@@ -0,0 +1,102 @@
+package urlshortener
+
+import (
+	"errors"
+	"time"
+)
+
+// Columns of a link that Update can write.
+const (
+	ColumnOriginal         = "original"
+	ColumnShortened        = "shortened"
+	ColumnExpiresAt        = "expires_at"
+	ColumnMaxClicks        = "max_clicks"
+	ColumnRedirectType     = "redirect_type"
+	ColumnTags             = "tags"
+	ColumnWorkspaceID      = "workspace_id"
+	ColumnUserID           = "user_id"
+	ColumnArchivedAt       = "archived_at"
+	ColumnQuarantinedAt    = "quarantined_at"
+	ColumnQuarantineReason = "quarantine_reason"
+)
+
+var ErrNotFound = errors.New("shortened url not found")
+var ErrDuplicate = errors.New("shortened url already exists")
+var ErrRevisionNotFound = errors.New("url revision not found")
+
+// ListFilter narrows down and orders the links returned by Repository.List.
+// Results start strictly after After when it is set. Without a WorkspaceID,
+// only UserID's links outside of workspaces are listed. AllUsers lifts that
+// restriction, keeping only a non-zero UserID. DeletedBefore only applies to
+// StateTrashed.
+type ListFilter struct {
+	UserID      uint
+	WorkspaceID *uint
+	AllUsers    bool
+	State       string
+	Now         time.Time
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Query       string
+	Tag         string
+	Sort        string
+	Order       string
+	After       *Cursor
+	Limit       int
+	// DeletedBefore keeps the links moved to the trash before this time.
+	DeletedBefore *time.Time
+}
+
+// Repository abstracts link storage so that URLShortenerManagerImpl does not
+// depend on a particular database. Links in the trash are invisible to every
+// method except List and Count with StateTrashed, FindTrashed, Update,
+// Restore and Delete.
+type Repository interface {
+	FindByID(id uint) (*ShortenedURL, error)
+	FindByShortened(shortened string) (*ShortenedURL, error)
+	List(filter ListFilter) ([]ShortenedURL, error)
+	// Count returns how many links match filter, ignoring its ordering,
+	// After and Limit.
+	Count(filter ListFilter) (int64, error)
+	// Create returns ErrDuplicate when the short code is already in use,
+	// in any case, including by a link in the trash, or is a retired code. It does not abort
+	// a surrounding transaction in that case, so the caller may retry with
+	// another code.
+	Create(shortenedURL *ShortenedURL) error
+	// Update writes the given columns of shortenedURL, so that changes made
+	// to other columns in the meantime are kept. Clicks is never written
+	// here; it only changes through IncrementClicks. Update returns
+	// ErrDuplicate when the short code is already used by another link, in
+	// any case, or retired.
+	Update(shortenedURL *ShortenedURL, columns ...string) error
+	// Trash moves a link to the trash.
+	Trash(id uint, now time.Time) error
+	FindTrashed(id uint) (*ShortenedURL, error)
+	// Restore takes a link out of the trash. It returns ErrNotFound if the
+	// link is not in the trash.
+	Restore(id uint) error
+	// Delete removes a link and its revisions for good, whether or not it is
+	// in the trash. Its short code is retired until reusableAt.
+	Delete(id uint, reusableAt time.Time) error
+	// ReleaseCodes makes the codes retired until now or earlier available
+	// again and returns how many there were.
+	ReleaseCodes(now time.Time) (int64, error)
+	// IncrementClicks records a click unless the link's click budget is used
+	// up and returns the click count including it, or zero if it was not
+	// counted.
+	IncrementClicks(id uint) (uint, error)
+	// ArchiveExpired archives links that have expired or exhausted their
+	// click budget and returns them.
+	ArchiveExpired(now time.Time) ([]ShortenedURL, error)
+	// Quarantine marks a link as flagged by link screening.
+	Quarantine(id uint, reason string, now time.Time) error
+	// NextSequence returns a number that has never been returned before.
+	NextSequence() (uint64, error)
+	CreateRevision(revision *URLRevision) error
+	// ListRevisions returns the revisions of a link, newest first.
+	ListRevisions(urlID uint) ([]URLRevision, error)
+	FindRevision(urlID uint, revisionID uint) (*URLRevision, error)
+	// Transaction runs fn against a repository whose writes are discarded if
+	// fn returns an error.
+	Transaction(fn func(Repository) error) error
+}
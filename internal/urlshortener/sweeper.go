@@ -0,0 +1,52 @@
+package urlshortener
+
+import (
+	"log"
+	"time"
+)
+
+// RunExpirySweeper periodically archives links that have expired or used up
+// their click budget. It blocks until stop is closed.
+func RunExpirySweeper(manager URLShortenerManager, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			archived, err := manager.ArchiveExpired()
+			if err != nil {
+				log.Printf("expiry sweeper: %s", err.Message())
+				continue
+			}
+			if archived > 0 {
+				log.Printf("expiry sweeper: archived %d urls", archived)
+			}
+		}
+	}
+}
+
+// RunTrashPurger periodically purges links that have been in the trash for
+// longer than the retention period. It blocks until stop is closed.
+func RunTrashPurger(manager URLShortenerManager, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			resp, err := manager.PurgeTrash()
+			if err != nil {
+				log.Printf("trash purger: %s", err.Message())
+				continue
+			}
+			if resp.Purged > 0 || resp.Released > 0 {
+				log.Printf("trash purger: purged %d urls, released %d codes", resp.Purged, resp.Released)
+			}
+		}
+	}
+}
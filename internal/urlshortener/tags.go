@@ -0,0 +1,86 @@
+package urlshortener
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+)
+
+const maxTags = 10
+const maxTagLength = 32
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Tags is stored as a single column of the form ",a,b," so that a tag can be
+// matched with a LIKE '%,tag,%' query on any database.
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "", nil
+	}
+	return "," + strings.Join(t, ",") + ",", nil
+}
+
+func (t *Tags) Scan(value interface{}) error {
+	var s string
+
+	switch v := value.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Tags", value)
+	}
+
+	*t = Tags{}
+	for _, tag := range strings.Split(s, ",") {
+		if tag != "" {
+			*t = append(*t, tag)
+		}
+	}
+
+	return nil
+}
+
+func (t Tags) Contains(tag string) bool {
+	for _, existing := range t {
+		if existing == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTags lowercases, deduplicates and sorts tags, rejecting any that
+// are too long or contain characters other than letters, digits, '-' and '_'.
+func normalizeTags(tags []string) (Tags, dcubeerrs.Error) {
+	normalized := Tags{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, dcubeerrs.New(http.StatusBadRequest, fmt.Sprintf("Invalid tag %q", tag))
+		}
+
+		if !normalized.Contains(tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+
+	if len(normalized) > maxTags {
+		return nil, dcubeerrs.New(http.StatusBadRequest, fmt.Sprintf("A URL may have at most %d tags", maxTags))
+	}
+
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
@@ -1,50 +1,325 @@
 package urlshortener
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/Imranr2/DCUBE_API/internal/user"
+	"gorm.io/gorm"
 )
 
 type ShortenedURL struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Original  string    `json:"original" gorm:"not null"`
-	Shortened string    `json:"shortened" gorm:"index;unique;not null"`
-	UserID    uint      `json:"-" gorm:"not null"`
-	User      user.User `json:"-" gorm:"foreignKey:UserID;not null"`
-	CreatedAt time.Time `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Original     string     `json:"original" gorm:"not null"`
+	Shortened    string     `json:"shortened" gorm:"unique;uniqueIndex:idx_shortened_lower,expression:lower(shortened);not null"` //nolint:lll
+	UserID       uint       `json:"-" gorm:"not null"`
+	User         user.User  `json:"-" gorm:"foreignKey:UserID;not null"`
+	CreatedAt    time.Time  `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	MaxClicks    uint       `json:"maxClicks,omitempty" gorm:"not null;default:0"`
+	Clicks       uint       `json:"clicks" gorm:"not null;default:0"`
+	ArchivedAt   *time.Time `json:"archivedAt,omitempty" gorm:"index"`
+	RedirectType string     `json:"redirectType" gorm:"not null;default:temporary"`
+	Tags         Tags       `json:"tags" gorm:"type:text;not null;default:''"`
+	// QuarantinedAt is set when link screening flags the destination. A
+	// quarantined link shows a warning page instead of redirecting.
+	QuarantinedAt    *time.Time `json:"quarantinedAt,omitempty" gorm:"index"`
+	QuarantineReason string     `json:"quarantineReason,omitempty"`
+	// WorkspaceID is set for links managed by a workspace, whose members are
+	// authorized by role. Other links belong to UserID alone.
+	WorkspaceID *uint `json:"workspaceId,omitempty" gorm:"index"`
+	// DeletedAt is set while the link is in the trash. A link in the trash
+	// does not redirect but keeps its short code until it is purged.
+	DeletedAt gorm.DeletedAt `json:"deletedAt" gorm:"index"`
 }
 
+// URLRevision records the state of a link before an update so that earlier
+// destinations can be listed and restored.
+type URLRevision struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	ShortenedURLID uint       `json:"-" gorm:"index;not null"`
+	Original       string     `json:"original" gorm:"not null"`
+	Shortened      string     `json:"shortened" gorm:"not null"`
+	RedirectType   string     `json:"redirectType" gorm:"not null"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	UserID         uint       `json:"-" gorm:"not null"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+}
+
+// RetiredCode holds back the short code of a purged link until ReusableAt, so
+// that a code people may still have bookmarked does not start pointing to
+// someone else's destination straight away.
+type RetiredCode struct {
+	Code       string    `gorm:"primaryKey"`
+	ReusableAt time.Time `gorm:"index;not null"`
+}
+
+// TrashPolicy controls what happens to deleted links. They stay in the trash
+// for Retention before they are purged, and the code of a purged link cannot
+// be issued again for CodeReuseDelay.
+type TrashPolicy struct {
+	Retention      time.Duration
+	CodeReuseDelay time.Duration
+}
+
+// CodeSequence hands out the numbers behind sequence and obfuscated short
+// codes. Rows are never deleted so that numbers are not reused.
+type CodeSequence struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+}
+
+// IsExpired reports whether the link has been archived, has passed its expiry
+// time or has used up its click budget.
+func (s ShortenedURL) IsExpired(now time.Time) bool {
+	if s.ArchivedAt != nil {
+		return true
+	}
+	if s.ExpiresAt != nil && !now.Before(*s.ExpiresAt) {
+		return true
+	}
+	return s.MaxClicks > 0 && s.Clicks >= s.MaxClicks
+}
+
+const (
+	RedirectPermanent        = "permanent"
+	RedirectTemporary        = "temporary"
+	RedirectMethodPreserving = "method_preserving"
+)
+
+var redirectStatusCodes = map[string]int{
+	RedirectPermanent:        http.StatusMovedPermanently,
+	RedirectTemporary:        http.StatusFound,
+	RedirectMethodPreserving: http.StatusTemporaryRedirect,
+}
+
+// RedirectStatusCode returns the HTTP status used when redirecting to the
+// original URL, falling back to a temporary redirect.
+func (s ShortenedURL) RedirectStatusCode() int {
+	if code, ok := redirectStatusCodes[s.RedirectType]; ok {
+		return code
+	}
+	return http.StatusFound
+}
+
+const (
+	StateAll         = "all"
+	StateActive      = "active"
+	StateExpired     = "expired"
+	StateQuarantined = "quarantined"
+	// StateTrashed lists the links in the trash, which every other state
+	// leaves out.
+	StateTrashed = "trashed"
+)
+
+const DefaultPageSize = 50
+const MaxPageSize = 200
+
 type GetRequest struct {
-	UserID uint
+	UserID      uint
+	WorkspaceID *uint
+	// AllUsers searches the links of every account, narrowed to UserID when
+	// it is set. It is meant for administrators.
+	AllUsers    bool
+	State       string `validate:"omitempty,oneof=all active expired quarantined"`
+	Limit       int    `validate:"min=0,max=200"`
+	Cursor      string
+	Sort        string `validate:"omitempty,oneof=created_at clicks"`
+	Order       string `validate:"omitempty,oneof=asc desc"`
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Query       string `validate:"max=256"`
+	Tag         string `validate:"max=32"`
 }
 
 type CreateRequest struct {
-	UserID      uint
-	OriginalURL string `json:"original_url" validate:"required"`
+	UserID       uint
+	OriginalURL  string     `json:"original_url" validate:"required"`
+	Alias        string     `json:"alias"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxClicks    uint       `json:"max_clicks"`
+	RedirectType string     `json:"redirect_type" validate:"omitempty,oneof=permanent temporary method_preserving"`
+	Tags         []string   `json:"tags"`
+	WorkspaceID  *uint      `json:"workspace_id"`
 }
 
+const (
+	BulkModeAtomic     = "atomic"
+	BulkModeBestEffort = "best_effort"
+)
+
+const MaxBulkURLs = 1000
+
+type BulkCreateRequest struct {
+	UserID uint
+	Mode   string          `validate:"oneof=atomic best_effort"`
+	URLs   []CreateRequest `validate:"required,min=1,max=1000"`
+}
+
+// UpdateRequest changes only the fields that are set. RemoveExpiry clears the
+// expiry time, since a null expires_at cannot be told apart from an absent one.
+type UpdateRequest struct {
+	UserID       uint
+	ID           uint
+	OriginalURL  *string    `json:"original_url" validate:"omitempty,min=1"`
+	Alias        *string    `json:"alias"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	RemoveExpiry bool       `json:"remove_expiry"`
+	MaxClicks    *uint      `json:"max_clicks"`
+	RedirectType *string    `json:"redirect_type" validate:"omitempty,oneof=permanent temporary method_preserving"`
+	Tags         []string   `json:"tags"`
+	// WorkspaceID moves the link into a workspace. Links cannot be moved back
+	// out of a workspace.
+	WorkspaceID *uint `json:"workspace_id"`
+}
+
+type FindRequest struct {
+	UserID uint
+	ID     uint
+}
+
+type GetRevisionsRequest struct {
+	UserID uint
+	ID     uint
+}
+
+type RollbackRequest struct {
+	UserID     uint
+	ID         uint
+	RevisionID uint
+}
+
+// DeleteRequest moves a link to the trash.
 type DeleteRequest struct {
 	UserID uint
 	ID     uint
 }
 
+// RestoreRequest takes a link back out of the trash.
+type RestoreRequest struct {
+	UserID uint
+	ID     uint
+}
+
+// DeleteAllRequest deletes every link owned by UserID outside of workspaces,
+// and every link in WorkspaceIDs, including those in the trash, for account
+// deletion. The links are purged right away rather than moved to the trash.
+type DeleteAllRequest struct {
+	UserID       uint
+	WorkspaceIDs []uint
+}
+
+// TransferRequest hands the links UserID created in a workspace over to
+// ToUserID, for account deletion.
+type TransferRequest struct {
+	UserID      uint
+	WorkspaceID uint
+	ToUserID    uint
+}
+
+type ExportRequest struct {
+	UserID uint
+}
+
+// ModerateRequest is an administrator's action on a link, whoever it belongs
+// to. Reason is only used when quarantining.
+type ModerateRequest struct {
+	AdminID uint   `json:"-"`
+	ID      uint   `json:"-"`
+	Reason  string `json:"reason" validate:"max=256"`
+}
+
+// AdminTransferRequest moves a link to ToUserID's personal links.
+type AdminTransferRequest struct {
+	AdminID  uint `json:"-"`
+	ID       uint `json:"-"`
+	ToUserID uint `json:"user_id" validate:"required"`
+}
+
 type RedirectRequest struct {
 	URL string
 }
 
 type GetResponse struct {
 	ShortenedURLs []ShortenedURL `json:"shortened_urls"`
+	NextCursor    string         `json:"next_cursor"`
 }
 
 type CreateResponse struct {
 	ShortenedURL ShortenedURL `json:"shortened_url"`
 }
 
+type BulkCreateResult struct {
+	Row          int           `json:"row"`
+	StatusCode   int           `json:"status_code"`
+	ShortenedURL *ShortenedURL `json:"shortened_url,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+type BulkCreateResponse struct {
+	Mode    string             `json:"mode"`
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Results []BulkCreateResult `json:"results"`
+}
+
+type UpdateResponse struct {
+	ShortenedURL ShortenedURL `json:"shortened_url"`
+	// Previous is the link as it was before the change.
+	Previous ShortenedURL `json:"-"`
+}
+
+type FindResponse struct {
+	ShortenedURL ShortenedURL `json:"shortened_url"`
+}
+
+type GetRevisionsResponse struct {
+	Revisions []URLRevision `json:"revisions"`
+}
+
 type DeleteResponse struct {
 	ShortenedURL ShortenedURL `json:"shortened_url"`
 }
 
+type RestoreResponse struct {
+	ShortenedURL ShortenedURL `json:"shortened_url"`
+}
+
+type DeleteAllResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+type TransferResponse struct {
+	Transferred int `json:"transferred"`
+}
+
+type StatsResponse struct {
+	Links       int64 `json:"links"`
+	Active      int64 `json:"active"`
+	Expired     int64 `json:"expired"`
+	Quarantined int64 `json:"quarantined"`
+	Trashed     int64 `json:"trashed"`
+}
+
+// PurgeResponse counts the links purged from the trash and the retired codes
+// that became available again.
+type PurgeResponse struct {
+	Purged   int64
+	Released int64
+}
+
+type ExportedURL struct {
+	ShortenedURL ShortenedURL  `json:"shortened_url"`
+	Revisions    []URLRevision `json:"revisions"`
+}
+
+type ExportResponse struct {
+	URLs []ExportedURL `json:"urls"`
+}
+
 type RedirectResponse struct {
-	OriginalURL string `json:"original"`
+	URLID            uint   `json:"-"`
+	OriginalURL      string `json:"original,omitempty"`
+	StatusCode       int    `json:"status_code"`
+	Quarantined      bool   `json:"quarantined,omitempty"`
+	QuarantineReason string `json:"quarantine_reason,omitempty"`
 }
@@ -2,118 +2,1142 @@ package urlshortener
 
 import (
 	"errors"
-	"math/rand"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"github.com/Imranr2/DCUBE_API/internal/screening"
+	"github.com/go-playground/validator"
 	"gorm.io/gorm"
 )
 
-const characters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-const urlLength = 10
+// maxCodeAttempts bounds how many generated codes are tried before giving up.
+const maxCodeAttempts = 10
 
 type URLShortenerManager interface {
 	GetURL(GetRequest) (*GetResponse, dcubeerrs.Error)
+	// FindURL returns a single link the user may view.
+	FindURL(FindRequest) (*FindResponse, dcubeerrs.Error)
 	CreateURL(CreateRequest) (*CreateResponse, dcubeerrs.Error)
+	BulkCreateURL(BulkCreateRequest) (*BulkCreateResponse, dcubeerrs.Error)
+	UpdateURL(UpdateRequest) (*UpdateResponse, dcubeerrs.Error)
+	GetRevisions(GetRevisionsRequest) (*GetRevisionsResponse, dcubeerrs.Error)
+	RollbackURL(RollbackRequest) (*UpdateResponse, dcubeerrs.Error)
 	DeleteURL(DeleteRequest) (*DeleteResponse, dcubeerrs.Error)
+	RestoreURL(RestoreRequest) (*RestoreResponse, dcubeerrs.Error)
+	// PurgeTrash deletes links that have been in the trash for longer than
+	// the retention period and releases retired codes that are due.
+	PurgeTrash() (*PurgeResponse, dcubeerrs.Error)
+	DeleteAllURLs(DeleteAllRequest) (*DeleteAllResponse, dcubeerrs.Error)
+	TransferURLs(TransferRequest) (*TransferResponse, dcubeerrs.Error)
+	ExpireURL(ModerateRequest) (*UpdateResponse, dcubeerrs.Error)
+	QuarantineURL(ModerateRequest) (*UpdateResponse, dcubeerrs.Error)
+	ReleaseURL(ModerateRequest) (*UpdateResponse, dcubeerrs.Error)
+	ReassignURL(AdminTransferRequest) (*UpdateResponse, dcubeerrs.Error)
+	GetStats() (*StatsResponse, dcubeerrs.Error)
+	ExportURLs(ExportRequest) (*ExportResponse, dcubeerrs.Error)
 	Redirect(RedirectRequest) (*RedirectResponse, dcubeerrs.Error)
+	// Lookup resolves a short code like Redirect without counting a click.
+	Lookup(RedirectRequest) (*RedirectResponse, dcubeerrs.Error)
+	ArchiveExpired() (int64, dcubeerrs.Error)
 }
 
 type URLShortenerManagerImpl struct {
-	database *gorm.DB
+	repository   Repository
+	destinations *DestinationValidator
+	screener     *screening.Screener
+	codes        CodeGenerator
+	permissions  Permissions
+	trash        TrashPolicy
+	events       Events
+	purger       Purger
 }
 
-func NewURLShortenerManager(database *gorm.DB) URLShortenerManager {
+func NewURLShortenerManager(
+	repository Repository,
+	destinations *DestinationValidator,
+	screener *screening.Screener,
+	codes CodeGenerator,
+	permissions Permissions,
+	trash TrashPolicy,
+	events Events,
+	purger Purger,
+) URLShortenerManager {
 	return &URLShortenerManagerImpl{
-		database: database,
+		repository:   repository,
+		destinations: destinations,
+		screener:     screener,
+		codes:        codes,
+		permissions:  permissions,
+		trash:        trash,
+		events:       events,
+		purger:       purger,
 	}
 }
 
 func (m *URLShortenerManagerImpl) GetURL(req GetRequest) (*GetResponse, dcubeerrs.Error) {
-	var shortenedURLs []ShortenedURL
+	if req.WorkspaceID != nil && !req.AllUsers {
+		if e := authorizeWorkspace(m.permissions, *req.WorkspaceID, req.UserID, VerbView); e != nil {
+			return nil, e
+		}
+	}
+
+	filter := ListFilter{
+		UserID:      req.UserID,
+		WorkspaceID: req.WorkspaceID,
+		AllUsers:    req.AllUsers,
+		State:       req.State,
+		Now:         time.Now().UTC(),
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		Query:       req.Query,
+		Tag:         strings.ToLower(req.Tag),
+		Sort:        req.Sort,
+		Order:       req.Order,
+		Limit:       req.Limit,
+	}
 
-	err := m.database.Model(&ShortenedURL{}).Where("user_id = ?", req.UserID).Find(&shortenedURLs).Error
+	if filter.Sort == "" {
+		filter.Sort = SortCreatedAt
+	}
+	if filter.Order == "" {
+		filter.Order = OrderDesc
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultPageSize
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor, filter.Sort, filter.Order)
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusBadRequest, "Invalid cursor")
+		}
+
+		filter.After = cursor
+	}
+
+	pageSize := filter.Limit
+	// Fetch one extra row to find out whether there is another page.
+	filter.Limit++
+
+	shortenedURLs, err := m.repository.List(filter)
 
 	if err != nil {
 		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching urls")
 	}
 
-	return &GetResponse{ShortenedURLs: shortenedURLs}, nil
-}
+	resp := &GetResponse{ShortenedURLs: shortenedURLs}
 
-func generateShortenedURL() string {
-	b := make([]byte, urlLength)
-	for i := range b {
-		b[i] = characters[rand.Intn(len(characters))]
+	if len(shortenedURLs) > pageSize {
+		resp.ShortenedURLs = shortenedURLs[:pageSize]
+		resp.NextCursor = newCursor(filter.Sort, filter.Order, resp.ShortenedURLs[pageSize-1]).Encode()
 	}
-	return string(b)
+
+	return resp, nil
 }
 
 func (m *URLShortenerManagerImpl) CreateURL(req CreateRequest) (*CreateResponse, dcubeerrs.Error) {
-	var shortened string
-	var shortenedURL ShortenedURL
+	shortenedURL, created, err := m.createURL(m.repository, req)
 
-	for {
-		shortened = generateShortenedURL()
-		err := m.database.First(&shortenedURL, ShortenedURL{Shortened: shortened}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		m.events.LinkCreated(*shortenedURL)
+	}
+
+	return &CreateResponse{ShortenedURL: *shortenedURL}, nil
+}
+
+// checkDestination normalizes a destination URL and rejects it if link
+// screening flags it.
+func (m *URLShortenerManagerImpl) checkDestination(raw string) (string, dcubeerrs.Error) {
+	destination, err := m.destinations.Normalize(raw)
+
+	if err != nil {
+		return "", err
+	}
+
+	if verdict := m.screener.Screen(destination); verdict.Blocked {
+		return "", invalidDestination("URL was rejected by link screening: " + verdict.Reason)
+	}
+
+	return destination, nil
+}
+
+// createURL inserts a link and reports whether it is new, since a code generator
+// that deduplicates may hand back an existing link instead.
+func (m *URLShortenerManagerImpl) createURL(
+	repository Repository,
+	req CreateRequest,
+) (*ShortenedURL, bool, dcubeerrs.Error) {
+	original, e := m.checkDestination(req.OriginalURL)
+
+	if e != nil {
+		return nil, false, e
+	}
+
+	if req.WorkspaceID != nil {
+		if e := authorizeWorkspace(m.permissions, *req.WorkspaceID, req.UserID, VerbCreate); e != nil {
+			return nil, false, e
+		}
+	}
+
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		if !expiresAt.After(time.Now().UTC()) {
+			return nil, false, dcubeerrs.New(http.StatusBadRequest, "Expiry time must be in the future")
+		}
+		req.ExpiresAt = &expiresAt
+	}
+
+	if req.Alias != "" {
+		if err := validateAlias(req.Alias); err != nil {
+			return nil, false, err
+		}
+	}
+
+	tags, e := normalizeTags(req.Tags)
+
+	if e != nil {
+		return nil, false, e
+	}
+
+	redirectType := req.RedirectType
+	if redirectType == "" {
+		redirectType = RedirectTemporary
+	}
+
+	newShortenedURL := ShortenedURL{
+		Original:     original,
+		Shortened:    req.Alias,
+		UserID:       req.UserID,
+		ExpiresAt:    req.ExpiresAt,
+		MaxClicks:    req.MaxClicks,
+		RedirectType: redirectType,
+		Tags:         tags,
+		WorkspaceID:  req.WorkspaceID,
+	}
+
+	if req.Alias == "" {
+		shortenedURL, e := m.createWithGeneratedCode(repository, &newShortenedURL)
+		return shortenedURL, shortenedURL == &newShortenedURL, e
+	}
+
+	err := repository.Create(&newShortenedURL)
+
+	if err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			return nil, false, dcubeerrs.New(http.StatusConflict, "Alias is already taken")
+		}
+		return nil, false, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating shortened url")
+	}
+
+	return &newShortenedURL, true, nil
+}
+
+// createWithGeneratedCode inserts shortenedURL under codes from the code
+// generator, moving on to the next candidate whenever one is already taken.
+func (m *URLShortenerManagerImpl) createWithGeneratedCode(
+	repository Repository,
+	shortenedURL *ShortenedURL,
+) (*ShortenedURL, dcubeerrs.Error) {
+	d, ok := m.codes.(deduplicator)
+	dedupes := ok && d.Deduplicates()
+
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code, err := m.codes.Generate(CodeRequest{
+			UserID:       shortenedURL.UserID,
+			Original:     shortenedURL.Original,
+			Attempt:      attempt,
+			NextSequence: repository.NextSequence,
+		})
 
 		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				break
-			}
 			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating shortened url")
 		}
+		if isReserved(code) {
+			continue
+		}
+
+		shortenedURL.Shortened = code
+		err = repository.Create(shortenedURL)
+
+		if err == nil {
+			return shortenedURL, nil
+		}
+		if !errors.Is(err, ErrDuplicate) {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating shortened url")
+		}
+
+		if dedupes {
+			if existing := findDuplicate(repository, code, shortenedURL); existing != nil {
+				return existing, nil
+			}
+		}
 	}
 
-	newShortenedURL := ShortenedURL{
-		Original:  req.OriginalURL,
-		Shortened: shortened,
-		UserID:    req.UserID,
+	return nil, dcubeerrs.New(http.StatusServiceUnavailable, "Could not find a free short code, please try again")
+}
+
+// findDuplicate returns the link stored under code if it is a live link by the
+// same user to the same destination, in the same workspace.
+func findDuplicate(repository Repository, code string, shortenedURL *ShortenedURL) *ShortenedURL {
+	existing, err := repository.FindByShortened(code)
+
+	if err != nil || existing.UserID != shortenedURL.UserID || existing.Original != shortenedURL.Original {
+		return nil
+	}
+	if !sameWorkspace(existing.WorkspaceID, shortenedURL.WorkspaceID) {
+		return nil
+	}
+	if existing.IsExpired(time.Now().UTC()) || existing.QuarantinedAt != nil {
+		return nil
 	}
 
-	err := m.database.Create(&newShortenedURL).Error
+	return existing
+}
+
+// errBulkRolledBack aborts the transaction of an atomic bulk create after at
+// least one row failed.
+var errBulkRolledBack = errors.New("bulk create rolled back")
+
+func (m *URLShortenerManagerImpl) BulkCreateURL(req BulkCreateRequest) (*BulkCreateResponse, dcubeerrs.Error) {
+	resp := &BulkCreateResponse{Mode: req.Mode, Results: make([]BulkCreateResult, len(req.URLs))}
+	validate := validator.New()
+	// created holds the new links, which are only announced once they are
+	// committed.
+	var created []ShortenedURL
+
+	// failedRow is the row that made an atomic upload fail.
+	var failedRow int
+
+	// createAll stops at the first failure when atomic is set: on Postgres a
+	// failed statement aborts the transaction, so later rows would only fail
+	// for that reason.
+	createAll := func(repository Repository, atomic bool) {
+		for i, item := range req.URLs {
+			result := &resp.Results[i]
+			result.Row = i + 1
+			item.UserID = req.UserID
+
+			if err := validate.Struct(item); err != nil {
+				result.StatusCode = http.StatusBadRequest
+				result.Error = err.Error()
+			} else if shortenedURL, isNew, err := m.createURL(repository, item); err != nil {
+				result.StatusCode = err.StatusCode()
+				result.Error = err.Message()
+			} else {
+				result.StatusCode = http.StatusCreated
+				result.ShortenedURL = shortenedURL
+				resp.Created++
+
+				if isNew {
+					created = append(created, *shortenedURL)
+				}
+				continue
+			}
+
+			resp.Failed++
+
+			if atomic {
+				failedRow = result.Row
+				return
+			}
+		}
+	}
+
+	if req.Mode == BulkModeBestEffort {
+		createAll(m.repository, false)
+		m.linksCreated(created)
+		return resp, nil
+	}
+
+	err := m.repository.Transaction(func(tx Repository) error {
+		createAll(tx, true)
+
+		if resp.Failed > 0 {
+			return errBulkRolledBack
+		}
+		return nil
+	})
+
+	if errors.Is(err, errBulkRolledBack) {
+		for i := range resp.Results {
+			if i+1 != failedRow {
+				resp.Results[i] = BulkCreateResult{
+					Row:        i + 1,
+					StatusCode: http.StatusFailedDependency,
+					Error:      fmt.Sprintf("Not created because row %d failed", failedRow),
+				}
+			}
+		}
+		resp.Failed = len(resp.Results)
+		resp.Created = 0
+		return resp, nil
+	}
 
 	if err != nil {
-		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating shortened url")
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating shortened urls")
 	}
 
-	return &CreateResponse{ShortenedURL: newShortenedURL}, nil
+	m.linksCreated(created)
+
+	return resp, nil
 }
 
-func (m *URLShortenerManagerImpl) DeleteURL(req DeleteRequest) (*DeleteResponse, dcubeerrs.Error) {
-	var shortenedURL ShortenedURL
+func (m *URLShortenerManagerImpl) linksCreated(shortenedURLs []ShortenedURL) {
+	for _, shortenedURL := range shortenedURLs {
+		m.events.LinkCreated(shortenedURL)
+	}
+}
+
+// findAuthorizedURL loads a link and checks that userID may act on it. verb
+// names the attempted action in the error returned to other users.
+func (m *URLShortenerManagerImpl) findAuthorizedURL(
+	repository Repository,
+	id uint,
+	userID uint,
+	verb string,
+) (*ShortenedURL, dcubeerrs.Error) {
+	shortenedURL, e := findURL(repository, id)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if e := Authorize(m.permissions, shortenedURL, userID, verb); e != nil {
+		return nil, e
+	}
+
+	return shortenedURL, nil
+}
+
+func findURL(repository Repository, id uint) (*ShortenedURL, dcubeerrs.Error) {
+	shortenedURL, err := repository.FindByID(id)
 
-	err := m.database.First(&shortenedURL, ShortenedURL{ID: req.ID}).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, ErrNotFound) {
 			return nil, dcubeerrs.New(http.StatusNotFound, "URL does not exist")
 		}
-		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting url")
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching url")
+	}
+
+	return shortenedURL, nil
+}
+
+func (m *URLShortenerManagerImpl) UpdateURL(req UpdateRequest) (*UpdateResponse, dcubeerrs.Error) {
+	return m.revise(req.ID, req.UserID, func(_ Repository, shortenedURL *ShortenedURL) dcubeerrs.Error {
+		return m.applyUpdate(shortenedURL, req)
+	})
+}
+
+func (m *URLShortenerManagerImpl) RollbackURL(req RollbackRequest) (*UpdateResponse, dcubeerrs.Error) {
+	return m.revise(req.ID, req.UserID, func(repository Repository, shortenedURL *ShortenedURL) dcubeerrs.Error {
+		revision, err := repository.FindRevision(req.ID, req.RevisionID)
+
+		if err != nil {
+			if errors.Is(err, ErrRevisionNotFound) {
+				return dcubeerrs.New(http.StatusNotFound, "Revision does not exist")
+			}
+			return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating url")
+		}
+
+		if verdict := m.screener.Screen(revision.Original); verdict.Blocked {
+			return invalidDestination("URL was rejected by link screening: " + verdict.Reason)
+		}
+
+		now := time.Now().UTC()
+
+		if revision.ExpiresAt != nil && !revision.ExpiresAt.After(now) {
+			return dcubeerrs.New(http.StatusBadRequest, "Revision's expiry time has passed")
+		}
+
+		// A code taken or retired since is reported by saveURL.
+		shortenedURL.Original = revision.Original
+		shortenedURL.Shortened = revision.Shortened
+		shortenedURL.RedirectType = revision.RedirectType
+		shortenedURL.ExpiresAt = revision.ExpiresAt
+
+		unarchiveIfLive(shortenedURL, now)
+
+		return nil
+	})
+}
+
+// revise applies change to a link userID may update inside a transaction,
+// recording the link's previous state as a revision first.
+func (m *URLShortenerManagerImpl) revise(
+	id uint,
+	userID uint,
+	change func(Repository, *ShortenedURL) dcubeerrs.Error,
+) (*UpdateResponse, dcubeerrs.Error) {
+	find := func(tx Repository) (*ShortenedURL, dcubeerrs.Error) {
+		return m.findAuthorizedURL(tx, id, userID, VerbUpdate)
+	}
+
+	return m.reviseURL(find, userID, change)
+}
+
+// moderate is revise for administrators, who may change any link.
+func (m *URLShortenerManagerImpl) moderate(
+	id uint,
+	adminID uint,
+	change func(*ShortenedURL),
+) (*UpdateResponse, dcubeerrs.Error) {
+	find := func(tx Repository) (*ShortenedURL, dcubeerrs.Error) {
+		return findURL(tx, id)
+	}
+
+	return m.reviseURL(find, adminID, func(_ Repository, shortenedURL *ShortenedURL) dcubeerrs.Error {
+		change(shortenedURL)
+		return nil
+	})
+}
+
+func (m *URLShortenerManagerImpl) reviseURL(
+	find func(Repository) (*ShortenedURL, dcubeerrs.Error),
+	userID uint,
+	change func(Repository, *ShortenedURL) dcubeerrs.Error,
+) (*UpdateResponse, dcubeerrs.Error) {
+	var resp *UpdateResponse
+	var dcubeErr dcubeerrs.Error
+
+	err := m.repository.Transaction(func(tx Repository) error {
+		shortenedURL, e := find(tx)
+		var previous ShortenedURL
+
+		if e == nil {
+			previous = *shortenedURL
+			e = recordRevision(tx, *shortenedURL, userID)
+		}
+		if e == nil {
+			e = change(tx, shortenedURL)
+		}
+		if e == nil {
+			e = saveURL(tx, shortenedURL, changedColumns(previous, *shortenedURL)...)
+		}
+		if e != nil {
+			dcubeErr = e
+			return errors.New(e.Message())
+		}
+
+		resp = &UpdateResponse{ShortenedURL: *shortenedURL, Previous: previous}
+		return nil
+	})
+
+	if dcubeErr != nil {
+		return nil, dcubeErr
+	}
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating url")
+	}
+
+	return resp, nil
+}
+
+func recordRevision(repository Repository, shortenedURL ShortenedURL, userID uint) dcubeerrs.Error {
+	err := repository.CreateRevision(&URLRevision{
+		ShortenedURLID: shortenedURL.ID,
+		Original:       shortenedURL.Original,
+		Shortened:      shortenedURL.Shortened,
+		RedirectType:   shortenedURL.RedirectType,
+		ExpiresAt:      shortenedURL.ExpiresAt,
+		UserID:         userID,
+	})
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating url")
+	}
+
+	return nil
+}
+
+func (m *URLShortenerManagerImpl) applyUpdate(shortenedURL *ShortenedURL, req UpdateRequest) dcubeerrs.Error {
+	if req.OriginalURL != nil {
+		original, err := m.checkDestination(*req.OriginalURL)
+		if err != nil {
+			return err
+		}
+		shortenedURL.Original = original
+	}
+
+	if req.Alias != nil && *req.Alias != shortenedURL.Shortened {
+		if err := validateAlias(*req.Alias); err != nil {
+			return err
+		}
+
+		// A taken alias is reported by saveURL from the unique constraint.
+		shortenedURL.Shortened = *req.Alias
+	}
+
+	now := time.Now().UTC()
+
+	if req.RemoveExpiry {
+		shortenedURL.ExpiresAt = nil
+	} else if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		if !expiresAt.After(now) {
+			return dcubeerrs.New(http.StatusBadRequest, "Expiry time must be in the future")
+		}
+		shortenedURL.ExpiresAt = &expiresAt
+	}
+
+	if req.MaxClicks != nil {
+		shortenedURL.MaxClicks = *req.MaxClicks
+	}
+
+	if req.RedirectType != nil {
+		shortenedURL.RedirectType = *req.RedirectType
+	}
+
+	if req.WorkspaceID != nil && !sameWorkspace(req.WorkspaceID, shortenedURL.WorkspaceID) {
+		if err := authorizeWorkspace(m.permissions, *req.WorkspaceID, req.UserID, VerbCreate); err != nil {
+			return err
+		}
+		workspaceID := *req.WorkspaceID
+		shortenedURL.WorkspaceID = &workspaceID
 	}
 
-	if shortenedURL.UserID != req.UserID {
-		return nil, dcubeerrs.New(http.StatusForbidden, "User is trying to delete other users records")
+	if req.Tags != nil {
+		tags, err := normalizeTags(req.Tags)
+		if err != nil {
+			return err
+		}
+		shortenedURL.Tags = tags
 	}
 
-	err = m.database.Delete(&ShortenedURL{}, req.ID).Error
+	unarchiveIfLive(shortenedURL, now)
+
+	return nil
+}
+
+// unarchiveIfLive brings back an archived link whose expiry or click budget
+// has been lifted.
+func unarchiveIfLive(shortenedURL *ShortenedURL, now time.Time) {
+	if shortenedURL.ArchivedAt == nil {
+		return
+	}
+
+	unarchived := *shortenedURL
+	unarchived.ArchivedAt = nil
+
+	if !unarchived.IsExpired(now) {
+		shortenedURL.ArchivedAt = nil
+	}
+}
+
+// changedColumns lists the columns Update must write to turn previous into
+// current.
+func changedColumns(previous ShortenedURL, current ShortenedURL) []string {
+	var columns []string
+
+	for _, change := range []struct {
+		column  string
+		changed bool
+	}{
+		{ColumnOriginal, previous.Original != current.Original},
+		{ColumnShortened, previous.Shortened != current.Shortened},
+		{ColumnExpiresAt, !sameTime(previous.ExpiresAt, current.ExpiresAt)},
+		{ColumnMaxClicks, previous.MaxClicks != current.MaxClicks},
+		{ColumnRedirectType, previous.RedirectType != current.RedirectType},
+		{ColumnTags, strings.Join(previous.Tags, " ") != strings.Join(current.Tags, " ")},
+		{ColumnWorkspaceID, !sameWorkspace(previous.WorkspaceID, current.WorkspaceID)},
+		{ColumnUserID, previous.UserID != current.UserID},
+		{ColumnArchivedAt, !sameTime(previous.ArchivedAt, current.ArchivedAt)},
+		{ColumnQuarantinedAt, !sameTime(previous.QuarantinedAt, current.QuarantinedAt)},
+		{ColumnQuarantineReason, previous.QuarantineReason != current.QuarantineReason},
+	} {
+		if change.changed {
+			columns = append(columns, change.column)
+		}
+	}
+
+	return columns
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+func saveURL(repository Repository, shortenedURL *ShortenedURL, columns ...string) dcubeerrs.Error {
+	err := repository.Update(shortenedURL, columns...)
+
+	if err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			return dcubeerrs.New(http.StatusConflict, "Alias is already taken")
+		}
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating url")
+	}
+
+	return nil
+}
+
+func (m *URLShortenerManagerImpl) FindURL(req FindRequest) (*FindResponse, dcubeerrs.Error) {
+	shortenedURL, e := m.findAuthorizedURL(m.repository, req.ID, req.UserID, VerbView)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return &FindResponse{ShortenedURL: *shortenedURL}, nil
+}
+
+func (m *URLShortenerManagerImpl) GetRevisions(req GetRevisionsRequest) (*GetRevisionsResponse, dcubeerrs.Error) {
+	_, e := m.findAuthorizedURL(m.repository, req.ID, req.UserID, VerbView)
+
+	if e != nil {
+		return nil, e
+	}
+
+	revisions, err := m.repository.ListRevisions(req.ID)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching revisions")
+	}
+
+	return &GetRevisionsResponse{Revisions: revisions}, nil
+}
+
+// DeleteURL moves a link to the trash, from where it can be restored until it
+// is purged.
+func (m *URLShortenerManagerImpl) DeleteURL(req DeleteRequest) (*DeleteResponse, dcubeerrs.Error) {
+	shortenedURL, e := m.findAuthorizedURL(m.repository, req.ID, req.UserID, VerbDelete)
+
+	if e != nil {
+		return nil, e
+	}
+
+	now := time.Now().UTC()
+	err := m.repository.Trash(req.ID, now)
 
 	if err != nil {
 		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting shortened url")
 	}
 
-	return &DeleteResponse{ShortenedURL: shortenedURL}, nil
+	shortenedURL.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	m.events.LinkDeleted(*shortenedURL)
+
+	return &DeleteResponse{ShortenedURL: *shortenedURL}, nil
+}
+
+func (m *URLShortenerManagerImpl) RestoreURL(req RestoreRequest) (*RestoreResponse, dcubeerrs.Error) {
+	shortenedURL, err := m.repository.FindTrashed(req.ID)
+
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, dcubeerrs.New(http.StatusNotFound, "URL is not in the trash")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching url")
+	}
+
+	if e := Authorize(m.permissions, shortenedURL, req.UserID, VerbDelete); e != nil {
+		return nil, e
+	}
+
+	err = m.repository.Restore(req.ID)
+
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, dcubeerrs.New(http.StatusNotFound, "URL is not in the trash")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while restoring shortened url")
+	}
+
+	shortenedURL.DeletedAt = gorm.DeletedAt{}
+
+	return &RestoreResponse{ShortenedURL: *shortenedURL}, nil
+}
+
+// purgeBatchSize bounds how many links PurgeTrash loads at once.
+const purgeBatchSize = 500
+
+func (m *URLShortenerManagerImpl) PurgeTrash() (*PurgeResponse, dcubeerrs.Error) {
+	resp := &PurgeResponse{}
+	now := time.Now().UTC()
+	deletedBefore := now.Add(-m.trash.Retention)
+
+	for {
+		shortenedURLs, err := m.repository.List(ListFilter{
+			AllUsers:      true,
+			State:         StateTrashed,
+			Now:           now,
+			DeletedBefore: &deletedBefore,
+			Limit:         purgeBatchSize,
+		})
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while purging shortened urls")
+		}
+
+		if err := m.purger.PurgeLinks(linkIDs(shortenedURLs)); err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while purging shortened urls")
+		}
+
+		for _, shortenedURL := range shortenedURLs {
+			if err := m.repository.Delete(shortenedURL.ID, now.Add(m.trash.CodeReuseDelay)); err != nil {
+				return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while purging shortened urls")
+			}
+			resp.Purged++
+		}
+
+		if len(shortenedURLs) < purgeBatchSize {
+			break
+		}
+	}
+
+	released, err := m.repository.ReleaseCodes(now)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while releasing short codes")
+	}
+
+	resp.Released = released
+
+	return resp, nil
+}
+
+// listWithTrash lists the links matching filter whether or not they are in
+// the trash. filter.State is ignored.
+func listWithTrash(repository Repository, filter ListFilter) ([]ShortenedURL, error) {
+	filter.State = StateAll
+	shortenedURLs, err := repository.List(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter.State = StateTrashed
+	trashed, err := repository.List(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(shortenedURLs, trashed...), nil
+}
+
+// linkIDs returns the IDs of shortenedURLs.
+func linkIDs(shortenedURLs []ShortenedURL) []uint {
+	ids := make([]uint, len(shortenedURLs))
+
+	for i, shortenedURL := range shortenedURLs {
+		ids[i] = shortenedURL.ID
+	}
+
+	return ids
+}
+
+func (m *URLShortenerManagerImpl) DeleteAllURLs(req DeleteAllRequest) (*DeleteAllResponse, dcubeerrs.Error) {
+	deleted := 0
+	now := time.Now().UTC()
+
+	err := m.repository.Transaction(func(repository Repository) error {
+		shortenedURLs, err := listWithTrash(repository, ListFilter{UserID: req.UserID, Now: now})
+
+		if err != nil {
+			return err
+		}
+
+		for i := range req.WorkspaceIDs {
+			inWorkspace, err := listWithTrash(repository, ListFilter{WorkspaceID: &req.WorkspaceIDs[i], Now: now})
+
+			if err != nil {
+				return err
+			}
+
+			shortenedURLs = append(shortenedURLs, inWorkspace...)
+		}
+
+		if err := m.purger.PurgeLinks(linkIDs(shortenedURLs)); err != nil {
+			return err
+		}
+
+		for _, shortenedURL := range shortenedURLs {
+			if err := repository.Delete(shortenedURL.ID, now.Add(m.trash.CodeReuseDelay)); err != nil {
+				return err
+			}
+		}
+
+		deleted = len(shortenedURLs)
+		return nil
+	})
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting shortened urls")
+	}
+
+	return &DeleteAllResponse{Deleted: deleted}, nil
+}
+
+// TransferURLs reassigns the links a user created in a workspace, so that the
+// workspace keeps them when the user's account is deleted.
+func (m *URLShortenerManagerImpl) TransferURLs(req TransferRequest) (*TransferResponse, dcubeerrs.Error) {
+	transferred := 0
+
+	err := m.repository.Transaction(func(repository Repository) error {
+		workspaceID := req.WorkspaceID
+		shortenedURLs, err := listWithTrash(repository, ListFilter{WorkspaceID: &workspaceID, Now: time.Now().UTC()})
+
+		if err != nil {
+			return err
+		}
+
+		for i := range shortenedURLs {
+			if shortenedURLs[i].UserID != req.UserID {
+				continue
+			}
+
+			shortenedURLs[i].UserID = req.ToUserID
+
+			if err := repository.Update(&shortenedURLs[i], ColumnUserID); err != nil {
+				return err
+			}
+			transferred++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while transferring shortened urls")
+	}
+
+	return &TransferResponse{Transferred: transferred}, nil
+}
+
+// ExpireURL makes a link expire immediately.
+func (m *URLShortenerManagerImpl) ExpireURL(req ModerateRequest) (*UpdateResponse, dcubeerrs.Error) {
+	return m.moderate(req.ID, req.AdminID, func(shortenedURL *ShortenedURL) {
+		now := time.Now().UTC()
+		if !shortenedURL.IsExpired(now) {
+			shortenedURL.ExpiresAt = &now
+		}
+	})
+}
+
+// QuarantineURL puts a link behind the warning page shown for links flagged
+// by link screening.
+func (m *URLShortenerManagerImpl) QuarantineURL(req ModerateRequest) (*UpdateResponse, dcubeerrs.Error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = "Quarantined by an administrator"
+	}
+
+	return m.moderate(req.ID, req.AdminID, func(shortenedURL *ShortenedURL) {
+		if shortenedURL.QuarantinedAt == nil {
+			now := time.Now().UTC()
+			shortenedURL.QuarantinedAt = &now
+		}
+		shortenedURL.QuarantineReason = reason
+	})
+}
+
+// ReleaseURL lifts the quarantine of a link. A link whose destination is
+// still flagged by link screening is quarantined again on its next redirect.
+func (m *URLShortenerManagerImpl) ReleaseURL(req ModerateRequest) (*UpdateResponse, dcubeerrs.Error) {
+	return m.moderate(req.ID, req.AdminID, func(shortenedURL *ShortenedURL) {
+		shortenedURL.QuarantinedAt = nil
+		shortenedURL.QuarantineReason = ""
+	})
+}
+
+// ReassignURL makes a link a personal link of another user. The caller
+// checks that the user exists.
+func (m *URLShortenerManagerImpl) ReassignURL(req AdminTransferRequest) (*UpdateResponse, dcubeerrs.Error) {
+	return m.moderate(req.ID, req.AdminID, func(shortenedURL *ShortenedURL) {
+		shortenedURL.UserID = req.ToUserID
+		shortenedURL.WorkspaceID = nil
+	})
+}
+
+func (m *URLShortenerManagerImpl) GetStats() (*StatsResponse, dcubeerrs.Error) {
+	var resp StatsResponse
+	now := time.Now().UTC()
+
+	counts := map[string]*int64{
+		StateAll:         &resp.Links,
+		StateActive:      &resp.Active,
+		StateExpired:     &resp.Expired,
+		StateQuarantined: &resp.Quarantined,
+		StateTrashed:     &resp.Trashed,
+	}
+
+	for state, count := range counts {
+		n, err := m.repository.Count(ListFilter{AllUsers: true, State: state, Now: now})
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while counting urls")
+		}
+
+		*count = n
+	}
+
+	return &resp, nil
+}
+
+// ExportURLs returns all of the links the user created, including those in
+// workspaces and in the trash, oldest first, along with their revision history.
+func (m *URLShortenerManagerImpl) ExportURLs(req ExportRequest) (*ExportResponse, dcubeerrs.Error) {
+	shortenedURLs, err := listWithTrash(m.repository, ListFilter{
+		UserID:   req.UserID,
+		AllUsers: true,
+		Now:      time.Now().UTC(),
+		Sort:     SortCreatedAt,
+		Order:    OrderAsc,
+	})
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while exporting shortened urls")
+	}
+
+	sort.Slice(shortenedURLs, func(i, j int) bool {
+		return shortenedURLs[i].ID < shortenedURLs[j].ID
+	})
+
+	resp := &ExportResponse{URLs: make([]ExportedURL, 0, len(shortenedURLs))}
+
+	for _, shortenedURL := range shortenedURLs {
+		revisions, err := m.repository.ListRevisions(shortenedURL.ID)
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while exporting shortened urls")
+		}
+
+		resp.URLs = append(resp.URLs, ExportedURL{ShortenedURL: shortenedURL, Revisions: revisions})
+	}
+
+	return resp, nil
 }
 
 func (m *URLShortenerManagerImpl) Redirect(req RedirectRequest) (*RedirectResponse, dcubeerrs.Error) {
-	var shortenedURL ShortenedURL
+	shortenedURL, e := m.resolve(req.URL)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if shortenedURL.QuarantinedAt != nil {
+		return quarantinedResponse(shortenedURL), nil
+	}
+
+	clicks, err := m.repository.IncrementClicks(shortenedURL.ID)
 
-	err := m.database.First(&shortenedURL, ShortenedURL{Shortened: req.URL}).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while redirecting")
+	}
+
+	if clicks == 0 {
+		return nil, dcubeerrs.New(http.StatusGone, "URL has reached its click limit")
+	}
+
+	// The link may have come from a cache, so its count is stale.
+	shortenedURL.Clicks = clicks
+	m.events.LinkClicked(*shortenedURL, clicks)
+
+	return &RedirectResponse{
+		URLID:       shortenedURL.ID,
+		OriginalURL: shortenedURL.Original,
+		StatusCode:  shortenedURL.RedirectStatusCode(),
+	}, nil
+}
+
+func (m *URLShortenerManagerImpl) Lookup(req RedirectRequest) (*RedirectResponse, dcubeerrs.Error) {
+	shortenedURL, e := m.resolve(req.URL)
+
+	if e != nil {
+		return nil, e
+	}
+
+	// The destination of a quarantined link is only shown on the interstitial.
+	if shortenedURL.QuarantinedAt != nil {
+		response := quarantinedResponse(shortenedURL)
+		response.OriginalURL = ""
+		return response, nil
+	}
+
+	return &RedirectResponse{
+		URLID:       shortenedURL.ID,
+		OriginalURL: shortenedURL.Original,
+		StatusCode:  shortenedURL.RedirectStatusCode(),
+	}, nil
+}
+
+// resolve finds the live link behind a short code, screening it on the way.
+func (m *URLShortenerManagerImpl) resolve(code string) (*ShortenedURL, dcubeerrs.Error) {
+	shortenedURL, err := m.repository.FindByShortened(code)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
 			return nil, dcubeerrs.New(http.StatusNotFound, "URL does not exist")
 		}
-		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting url")
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while redirecting")
+	}
+
+	now := time.Now().UTC()
+
+	if shortenedURL.IsExpired(now) {
+		return nil, dcubeerrs.New(http.StatusGone, "URL has expired")
+	}
+
+	if e := m.screenOnRedirect(shortenedURL, now); e != nil {
+		return nil, e
+	}
+
+	return shortenedURL, nil
+}
+
+func quarantinedResponse(shortenedURL *ShortenedURL) *RedirectResponse {
+	return &RedirectResponse{
+		URLID:            shortenedURL.ID,
+		OriginalURL:      shortenedURL.Original,
+		Quarantined:      true,
+		QuarantineReason: shortenedURL.QuarantineReason,
+	}
+}
+
+// screenOnRedirect screens the destination again so that links created before
+// a blocklist update are still caught, quarantining the link if it is flagged.
+func (m *URLShortenerManagerImpl) screenOnRedirect(shortenedURL *ShortenedURL, now time.Time) dcubeerrs.Error {
+	if shortenedURL.QuarantinedAt != nil {
+		return nil
+	}
+
+	verdict := m.screener.Screen(shortenedURL.Original)
+
+	if !verdict.Blocked {
+		return nil
+	}
+
+	if err := m.repository.Quarantine(shortenedURL.ID, verdict.Reason, now); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while redirecting")
+	}
+
+	shortenedURL.QuarantinedAt = &now
+	shortenedURL.QuarantineReason = verdict.Reason
+
+	return nil
+}
+
+func (m *URLShortenerManagerImpl) ArchiveExpired() (int64, dcubeerrs.Error) {
+	archived, err := m.repository.ArchiveExpired(time.Now().UTC())
+
+	if err != nil {
+		return 0, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while archiving expired urls")
+	}
+
+	for _, shortenedURL := range archived {
+		m.events.LinkExpired(shortenedURL)
 	}
 
-	return &RedirectResponse{OriginalURL: shortenedURL.Original}, nil
+	return int64(len(archived)), nil
 }
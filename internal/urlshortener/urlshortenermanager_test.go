@@ -0,0 +1,581 @@
+package urlshortener
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/screening"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestManager(providers ...screening.Provider) (URLShortenerManager, Repository) {
+	codes, _ := NewCodeGenerator(CodeStrategyRandom, DefaultCodeLength, "")
+	return newTestManagerWithCodes(codes, providers...)
+}
+
+func newTestManagerWithCodes(codes CodeGenerator, providers ...screening.Provider) (URLShortenerManager, Repository) {
+	repository := NewMemoryRepository()
+	manager := NewURLShortenerManager(
+		repository,
+		NewDestinationValidator([]string{"dcu.be"}),
+		screening.NewScreener(providers...),
+		codes,
+		testPermissions{},
+		testTrashPolicy,
+		NopEvents{},
+		NopPurger{},
+	)
+	return manager, repository
+}
+
+// testTrashPolicy purges links as soon as they are in the trash.
+var testTrashPolicy = TrashPolicy{Retention: 0, CodeReuseDelay: time.Hour}
+
+// testPermissions maps a workspace and user ID pair to the user's role.
+type testPermissions map[[2]uint]string
+
+func (p testPermissions) CanView(userID uint, workspaceID uint) (bool, error) {
+	return p[[2]uint{workspaceID, userID}] != "", nil
+}
+
+func (p testPermissions) CanEdit(userID uint, workspaceID uint) (bool, error) {
+	role := p[[2]uint{workspaceID, userID}]
+	return role == "owner" || role == "editor", nil
+}
+
+func TestCreateAndRedirect(t *testing.T) {
+	manager, _ := newTestManager()
+
+	created, err := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com"})
+	assert.Nil(t, err)
+	assert.Len(t, created.ShortenedURL.Shortened, DefaultCodeLength)
+	assert.Equal(t, RedirectTemporary, created.ShortenedURL.RedirectType)
+
+	resp, err := manager.Redirect(RedirectRequest{URL: created.ShortenedURL.Shortened})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", resp.OriginalURL)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	_, err = manager.Redirect(RedirectRequest{URL: "missing"})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+}
+
+func TestCreateWithAlias(t *testing.T) {
+	manager, _ := newTestManager()
+
+	_, err := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com", Alias: "my-link"})
+	assert.Nil(t, err)
+
+	_, err = manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.org", Alias: "my-link"})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	_, err = manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.org", Alias: "My-Link"})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	ReserveAliases("signup")
+	_, err = manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com", Alias: "SignUp"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+}
+
+func TestGetURLFiltersByState(t *testing.T) {
+	manager, repository := newTestManager()
+	past := time.Now().UTC().Add(-time.Minute)
+
+	repository.Create(&ShortenedURL{Original: "https://a.com", Shortened: "active", UserID: 1})
+	repository.Create(&ShortenedURL{Original: "https://b.com", Shortened: "expired", UserID: 1, ExpiresAt: &past})
+	repository.Create(&ShortenedURL{Original: "https://c.com", Shortened: "other", UserID: 2})
+
+	resp, err := manager.GetURL(GetRequest{UserID: 1})
+	assert.Nil(t, err)
+	assert.Len(t, resp.ShortenedURLs, 2)
+
+	resp, _ = manager.GetURL(GetRequest{UserID: 1, State: StateActive})
+	assert.Len(t, resp.ShortenedURLs, 1)
+	assert.Equal(t, "active", resp.ShortenedURLs[0].Shortened)
+
+	resp, _ = manager.GetURL(GetRequest{UserID: 1, State: StateExpired})
+	assert.Len(t, resp.ShortenedURLs, 1)
+	assert.Equal(t, "expired", resp.ShortenedURLs[0].Shortened)
+
+	archived, err := manager.ArchiveExpired()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), archived)
+}
+
+func TestRedirectClickBudget(t *testing.T) {
+	manager, _ := newTestManager()
+
+	created, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com", MaxClicks: 2})
+	code := created.ShortenedURL.Shortened
+
+	for i := 0; i < 2; i++ {
+		// Lookups do not use up the budget.
+		_, err := manager.Lookup(RedirectRequest{URL: code})
+		assert.Nil(t, err)
+
+		_, err = manager.Redirect(RedirectRequest{URL: code})
+		assert.Nil(t, err)
+	}
+
+	_, err := manager.Redirect(RedirectRequest{URL: code})
+	assert.Equal(t, http.StatusGone, err.StatusCode())
+
+	_, err = manager.Lookup(RedirectRequest{URL: code})
+	assert.Equal(t, http.StatusGone, err.StatusCode())
+}
+
+// testEvents records the IDs of the links each event was reported for.
+type testEvents struct {
+	created []uint
+	deleted []uint
+	expired []uint
+	clicks  []uint
+}
+
+func (e *testEvents) LinkCreated(shortenedURL ShortenedURL) {
+	e.created = append(e.created, shortenedURL.ID)
+}
+
+func (e *testEvents) LinkDeleted(shortenedURL ShortenedURL) {
+	e.deleted = append(e.deleted, shortenedURL.ID)
+}
+
+func (e *testEvents) LinkExpired(shortenedURL ShortenedURL) {
+	e.expired = append(e.expired, shortenedURL.ID)
+}
+
+func (e *testEvents) LinkClicked(shortenedURL ShortenedURL, clicks uint) {
+	e.clicks = append(e.clicks, clicks)
+}
+
+func TestEvents(t *testing.T) {
+	events := &testEvents{}
+	codes, _ := NewCodeGenerator(CodeStrategyHash, DefaultCodeLength, "")
+	manager := NewURLShortenerManager(
+		NewMemoryRepository(),
+		NewDestinationValidator([]string{"dcu.be"}),
+		screening.NewScreener(),
+		codes,
+		testPermissions{},
+		testTrashPolicy,
+		events,
+		NopPurger{},
+	)
+
+	created, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com", MaxClicks: 2})
+	id := created.ShortenedURL.ID
+
+	// The hash strategy hands back the existing link, which is not new.
+	manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com", MaxClicks: 2})
+	bulk, _ := manager.BulkCreateURL(BulkCreateRequest{
+		UserID: 1,
+		Mode:   BulkModeAtomic,
+		URLs:   []CreateRequest{{OriginalURL: "https://example.com/a"}, {OriginalURL: "https://example.com/b"}},
+	})
+	assert.Equal(t, []uint{id, bulk.Results[0].ShortenedURL.ID, bulk.Results[1].ShortenedURL.ID}, events.created)
+
+	for i := 0; i < 3; i++ {
+		manager.Redirect(RedirectRequest{URL: created.ShortenedURL.Shortened})
+	}
+	assert.Equal(t, []uint{1, 2}, events.clicks)
+
+	manager.ArchiveExpired()
+	assert.Equal(t, []uint{id}, events.expired)
+
+	manager.DeleteURL(DeleteRequest{UserID: 1, ID: id})
+	assert.Equal(t, []uint{id}, events.deleted)
+}
+
+func TestDeleteURL(t *testing.T) {
+	manager, repository := newTestManager()
+	created, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com"})
+
+	_, err := manager.DeleteURL(DeleteRequest{UserID: 2, ID: created.ShortenedURL.ID})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	_, err = manager.DeleteURL(DeleteRequest{UserID: 1, ID: created.ShortenedURL.ID})
+	assert.Nil(t, err)
+
+	_, e := repository.FindByID(created.ShortenedURL.ID)
+	assert.ErrorIs(t, e, ErrNotFound)
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	manager, repository := newTestManager()
+	created, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com", Alias: "trashed"})
+	id := created.ShortenedURL.ID
+
+	deleted, err := manager.DeleteURL(DeleteRequest{UserID: 1, ID: id})
+	assert.Nil(t, err)
+	assert.True(t, deleted.ShortenedURL.DeletedAt.Valid)
+
+	_, err = manager.Redirect(RedirectRequest{URL: "trashed"})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+
+	// The code stays taken while the link is in the trash.
+	_, err = manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.com", Alias: "trashed"})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	trash, _ := manager.GetURL(GetRequest{UserID: 1, State: StateTrashed})
+	assert.Len(t, trash.ShortenedURLs, 1)
+	listed, _ := manager.GetURL(GetRequest{UserID: 1})
+	assert.Len(t, listed.ShortenedURLs, 0)
+
+	_, err = manager.RestoreURL(RestoreRequest{UserID: 2, ID: id})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	restored, err := manager.RestoreURL(RestoreRequest{UserID: 1, ID: id})
+	assert.Nil(t, err)
+	assert.False(t, restored.ShortenedURL.DeletedAt.Valid)
+
+	_, err = manager.RestoreURL(RestoreRequest{UserID: 1, ID: id})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+
+	_, err = manager.Redirect(RedirectRequest{URL: "trashed"})
+	assert.Nil(t, err)
+
+	manager.DeleteURL(DeleteRequest{UserID: 1, ID: id})
+	purged, err := manager.PurgeTrash()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged.Purged)
+
+	_, e := repository.FindTrashed(id)
+	assert.ErrorIs(t, e, ErrNotFound)
+
+	// A purged code is held back until the reuse delay has passed.
+	_, err = manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.com", Alias: "trashed"})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	released, _ := repository.ReleaseCodes(time.Now().Add(testTrashPolicy.CodeReuseDelay))
+	assert.Equal(t, int64(1), released)
+
+	_, err = manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.com", Alias: "trashed"})
+	assert.Nil(t, err)
+}
+
+// testPurger records the links it is asked to purge and fails when err is set.
+type testPurger struct {
+	purged []uint
+	err    error
+}
+
+func (p *testPurger) PurgeLinks(shortenedURLIDs []uint) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.purged = append(p.purged, shortenedURLIDs...)
+	return nil
+}
+
+func TestPurgeTrashPurgesLinkData(t *testing.T) {
+	purger := &testPurger{err: errors.New("unavailable")}
+	repository := NewMemoryRepository()
+	codes, _ := NewCodeGenerator(CodeStrategyRandom, DefaultCodeLength, "")
+	manager := NewURLShortenerManager(
+		repository,
+		NewDestinationValidator([]string{"dcu.be"}),
+		screening.NewScreener(),
+		codes,
+		testPermissions{},
+		testTrashPolicy,
+		NopEvents{},
+		purger,
+	)
+
+	created, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com"})
+	id := created.ShortenedURL.ID
+	manager.DeleteURL(DeleteRequest{UserID: 1, ID: id})
+
+	// The link is kept while its data cannot be purged.
+	_, err := manager.PurgeTrash()
+	assert.Equal(t, http.StatusInternalServerError, err.StatusCode())
+	_, e := repository.FindTrashed(id)
+	assert.Nil(t, e)
+
+	purger.err = nil
+	purged, err := manager.PurgeTrash()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged.Purged)
+	assert.Equal(t, []uint{id}, purger.purged)
+}
+
+func TestExportAndDeleteAllURLs(t *testing.T) {
+	manager, repository := newTestManager()
+	first, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com/1"})
+	second, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com/2"})
+	other, _ := manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.com/3"})
+	manager.DeleteURL(DeleteRequest{UserID: 1, ID: second.ShortenedURL.ID})
+
+	updated := "https://example.com/updated"
+	manager.UpdateURL(UpdateRequest{UserID: 1, ID: first.ShortenedURL.ID, OriginalURL: &updated})
+
+	workspaceID := uint(7)
+	inWorkspace := ShortenedURL{UserID: 1, WorkspaceID: &workspaceID, Original: "https://example.com/4", Shortened: "team"}
+	assert.Nil(t, repository.Create(&inWorkspace))
+
+	export, err := manager.ExportURLs(ExportRequest{UserID: 1})
+	assert.Nil(t, err)
+	assert.Len(t, export.URLs, 3)
+	assert.Equal(t, first.ShortenedURL.ID, export.URLs[0].ShortenedURL.ID)
+	assert.Len(t, export.URLs[0].Revisions, 1)
+	assert.Equal(t, inWorkspace.ID, export.URLs[2].ShortenedURL.ID)
+
+	deleted, err := manager.DeleteAllURLs(DeleteAllRequest{UserID: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, deleted.Deleted)
+
+	_, e := repository.FindByID(first.ShortenedURL.ID)
+	assert.ErrorIs(t, e, ErrNotFound)
+	_, e = repository.FindTrashed(second.ShortenedURL.ID)
+	assert.ErrorIs(t, e, ErrNotFound)
+	_, e = repository.FindByID(other.ShortenedURL.ID)
+	assert.Nil(t, e)
+}
+
+func TestBulkCreateURLAtomicRollback(t *testing.T) {
+	manager, repository := newTestManager()
+
+	resp, err := manager.BulkCreateURL(BulkCreateRequest{
+		UserID: 1,
+		Mode:   BulkModeAtomic,
+		URLs: []CreateRequest{
+			{OriginalURL: "https://example.com", Alias: "first"},
+			{OriginalURL: "https://example.org", Alias: "first"},
+			{OriginalURL: "https://example.net", Alias: "third"},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, resp.Created)
+	assert.Equal(t, 3, resp.Failed)
+	assert.Equal(t, http.StatusConflict, resp.Results[1].StatusCode)
+
+	// Rows after the failure are not attempted, and point at it as the cause.
+	for _, row := range []int{0, 2} {
+		assert.Equal(t, row+1, resp.Results[row].Row)
+		assert.Equal(t, http.StatusFailedDependency, resp.Results[row].StatusCode)
+		assert.Equal(t, "Not created because row 2 failed", resp.Results[row].Error)
+	}
+
+	_, e := repository.FindByShortened("first")
+	assert.ErrorIs(t, e, ErrNotFound)
+	_, e = repository.FindByShortened("third")
+	assert.ErrorIs(t, e, ErrNotFound)
+}
+
+func TestGetURLPaginationByClicks(t *testing.T) {
+	manager, repository := newTestManager()
+
+	for i, clicks := range []uint{3, 7, 3, 0} {
+		repository.Create(&ShortenedURL{Original: "https://example.com", Shortened: string(rune('a' + i)), UserID: 1, Clicks: clicks})
+	}
+
+	var codes []string
+	req := GetRequest{UserID: 1, Sort: SortClicks, Limit: 3}
+
+	for {
+		resp, err := manager.GetURL(req)
+		assert.Nil(t, err)
+		for _, u := range resp.ShortenedURLs {
+			codes = append(codes, u.Shortened)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		req.Cursor = resp.NextCursor
+	}
+
+	assert.Equal(t, []string{"b", "c", "a", "d"}, codes)
+
+	_, err := manager.GetURL(GetRequest{UserID: 1, Sort: SortCreatedAt, Cursor: req.Cursor})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+}
+
+func TestUpdateURLRecordsRevisions(t *testing.T) {
+	manager, _ := newTestManager()
+
+	created, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com/v1"})
+	id := created.ShortenedURL.ID
+	v2 := "https://example.com/v2"
+
+	_, err := manager.UpdateURL(UpdateRequest{UserID: 2, ID: id, OriginalURL: &v2})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	updated, err := manager.UpdateURL(UpdateRequest{UserID: 1, ID: id, OriginalURL: &v2})
+	assert.Nil(t, err)
+	assert.Equal(t, v2, updated.ShortenedURL.Original)
+
+	revisions, err := manager.GetRevisions(GetRevisionsRequest{UserID: 1, ID: id})
+	assert.Nil(t, err)
+	assert.Len(t, revisions.Revisions, 1)
+
+	rolledBack, err := manager.RollbackURL(RollbackRequest{UserID: 1, ID: id, RevisionID: revisions.Revisions[0].ID})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/v1", rolledBack.ShortenedURL.Original)
+
+	// Rolling back restores the code and expiry as well.
+	alias := "renamed"
+	expiresAt := time.Now().Add(time.Hour)
+	_, err = manager.UpdateURL(UpdateRequest{UserID: 1, ID: id, Alias: &alias, ExpiresAt: &expiresAt})
+	assert.Nil(t, err)
+
+	revisions, _ = manager.GetRevisions(GetRevisionsRequest{UserID: 1, ID: id})
+	rolledBack, err = manager.RollbackURL(RollbackRequest{UserID: 1, ID: id, RevisionID: revisions.Revisions[0].ID})
+	assert.Nil(t, err)
+	assert.Equal(t, created.ShortenedURL.Shortened, rolledBack.ShortenedURL.Shortened)
+	assert.Nil(t, rolledBack.ShortenedURL.ExpiresAt)
+
+	_, err = manager.RollbackURL(RollbackRequest{UserID: 1, ID: id, RevisionID: 999})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+}
+
+func TestUpdateKeepsConcurrentChanges(t *testing.T) {
+	_, repository := newTestManager()
+	repository.Create(&ShortenedURL{Original: "https://example.com", Shortened: "busy", UserID: 1})
+
+	stale, _ := repository.FindByShortened("busy")
+	repository.IncrementClicks(stale.ID)
+
+	stale.Original = "https://example.org"
+	stale.MaxClicks = 5
+	assert.Nil(t, repository.Update(stale, ColumnOriginal))
+
+	current, _ := repository.FindByID(stale.ID)
+	assert.Equal(t, "https://example.org", current.Original)
+	assert.Equal(t, uint(1), current.Clicks)
+	assert.Equal(t, uint(0), current.MaxClicks)
+}
+
+func TestScreeningQuarantinesLinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(path, []byte("evil.example\n"), 0o600)
+	blocklist, _ := screening.NewBlocklist(path)
+	manager, _ := newTestManager(blocklist)
+
+	_, err := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://login.evil.example"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	created, err := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://later.example"})
+	assert.Nil(t, err)
+
+	os.WriteFile(path, []byte("evil.example\nlater.example\n"), 0o600)
+	blocklist.Reload()
+
+	resp, err := manager.Redirect(RedirectRequest{URL: created.ShortenedURL.Shortened})
+	assert.Nil(t, err)
+	assert.True(t, resp.Quarantined)
+
+	// The quarantine sticks even if the blocklist entry is removed again.
+	os.WriteFile(path, []byte("evil.example\n"), 0o600)
+	blocklist.Reload()
+
+	resp, _ = manager.Redirect(RedirectRequest{URL: created.ShortenedURL.Shortened})
+	assert.True(t, resp.Quarantined)
+}
+
+func TestWorkspaceLinks(t *testing.T) {
+	codes, _ := NewCodeGenerator(CodeStrategyRandom, DefaultCodeLength, "")
+	permissions := testPermissions{{1, 1}: "owner", {1, 2}: "editor", {1, 3}: "viewer"}
+	manager := NewURLShortenerManager(
+		NewMemoryRepository(),
+		NewDestinationValidator([]string{"dcu.be"}),
+		screening.NewScreener(),
+		codes,
+		permissions,
+		testTrashPolicy,
+		NopEvents{},
+		NopPurger{},
+	)
+	workspaceID := uint(1)
+
+	_, err := manager.CreateURL(CreateRequest{UserID: 3, OriginalURL: "https://example.com", WorkspaceID: &workspaceID})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	created, err := manager.CreateURL(CreateRequest{
+		UserID:      2,
+		OriginalURL: "https://example.com",
+		WorkspaceID: &workspaceID,
+	})
+	assert.Nil(t, err)
+	id := created.ShortenedURL.ID
+
+	// Workspace links are listed by workspace, not with personal links.
+	personal, err := manager.GetURL(GetRequest{UserID: 2})
+	assert.Nil(t, err)
+	assert.Empty(t, personal.ShortenedURLs)
+
+	listed, err := manager.GetURL(GetRequest{UserID: 3, WorkspaceID: &workspaceID})
+	assert.Nil(t, err)
+	assert.Len(t, listed.ShortenedURLs, 1)
+
+	_, err = manager.GetURL(GetRequest{UserID: 4, WorkspaceID: &workspaceID})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	_, err = manager.DeleteURL(DeleteRequest{UserID: 3, ID: id})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	_, err = manager.GetRevisions(GetRevisionsRequest{UserID: 3, ID: id})
+	assert.Nil(t, err)
+
+	original := "https://example.org"
+	_, err = manager.UpdateURL(UpdateRequest{UserID: 1, ID: id, OriginalURL: &original})
+	assert.Nil(t, err)
+
+	transferred, err := manager.TransferURLs(TransferRequest{UserID: 2, WorkspaceID: workspaceID, ToUserID: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, transferred.Transferred)
+
+	_, err = manager.DeleteURL(DeleteRequest{UserID: 1, ID: id})
+	assert.Nil(t, err)
+}
+
+func TestModerateURLs(t *testing.T) {
+	manager, _ := newTestManager()
+	created, _ := manager.CreateURL(CreateRequest{UserID: 1, OriginalURL: "https://example.com/spam"})
+	manager.CreateURL(CreateRequest{UserID: 2, OriginalURL: "https://example.org"})
+	id := created.ShortenedURL.ID
+
+	all, err := manager.GetURL(GetRequest{AllUsers: true, Query: "example"})
+	assert.Nil(t, err)
+	assert.Len(t, all.ShortenedURLs, 2)
+
+	owned, err := manager.GetURL(GetRequest{AllUsers: true, UserID: 2})
+	assert.Nil(t, err)
+	assert.Len(t, owned.ShortenedURLs, 1)
+
+	quarantined, err := manager.QuarantineURL(ModerateRequest{AdminID: 9, ID: id, Reason: "Spam"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Spam", quarantined.ShortenedURL.QuarantineReason)
+
+	resp, _ := manager.Redirect(RedirectRequest{URL: created.ShortenedURL.Shortened})
+	assert.True(t, resp.Quarantined)
+
+	stats, err := manager.GetStats()
+	assert.Nil(t, err)
+	assert.Equal(t, StatsResponse{Links: 2, Active: 2, Quarantined: 1}, *stats)
+
+	_, err = manager.ReleaseURL(ModerateRequest{AdminID: 9, ID: id})
+	assert.Nil(t, err)
+
+	resp, _ = manager.Redirect(RedirectRequest{URL: created.ShortenedURL.Shortened})
+	assert.False(t, resp.Quarantined)
+
+	_, err = manager.ExpireURL(ModerateRequest{AdminID: 9, ID: id})
+	assert.Nil(t, err)
+
+	_, err = manager.Redirect(RedirectRequest{URL: created.ShortenedURL.Shortened})
+	assert.Equal(t, http.StatusGone, err.StatusCode())
+
+	reassigned, err := manager.ReassignURL(AdminTransferRequest{AdminID: 9, ID: id, ToUserID: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), reassigned.ShortenedURL.UserID)
+
+	revisions, _ := manager.GetRevisions(GetRevisionsRequest{UserID: 2, ID: id})
+	assert.Len(t, revisions.Revisions, 4)
+
+	_, err = manager.ExpireURL(ModerateRequest{AdminID: 9, ID: 999})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+}
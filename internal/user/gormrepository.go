@@ -0,0 +1,228 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormRepository struct {
+	database *gorm.DB
+}
+
+func NewGormRepository(database *gorm.DB) Repository {
+	return &GormRepository{
+		database: database,
+	}
+}
+
+func (r *GormRepository) find(query User) (*User, error) {
+	var user User
+	err := r.database.First(&user, query).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *GormRepository) FindByID(id uint) (*User, error) {
+	return r.find(User{ID: id})
+}
+
+func (r *GormRepository) FindByUsername(username string) (*User, error) {
+	return r.find(User{Username: username})
+}
+
+func (r *GormRepository) Create(user *User) error {
+	err := r.database.Create(user).Error
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+func (r *GormRepository) Update(user *User, columns ...string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+
+	return r.database.Model(user).Select(columns).Updates(user).Error
+}
+
+func (r *GormRepository) Delete(id uint) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		dependents := []interface{}{&LoginAttempt{}, &RecoveryCode{}, &PasswordResetToken{}}
+
+		for _, model := range dependents {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&User{}, id).Error
+	})
+}
+
+func (r *GormRepository) CreatePasswordResetToken(token *PasswordResetToken) error {
+	return r.database.Create(token).Error
+}
+
+func (r *GormRepository) UsePasswordResetToken(hash string, now time.Time) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+
+	err := r.database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, now).First(&token).Error
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// Guard against a concurrent use of the same token.
+		result := tx.Model(&PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		token.UsedAt = &now
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *GormRepository) RevokePasswordResetTokens(userID uint, now time.Time) error {
+	return r.database.Model(&PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error
+}
+
+func (r *GormRepository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		for _, hash := range hashes {
+			if err := tx.Create(&RecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *GormRepository) UseRecoveryCode(userID uint, hash string, now time.Time) (bool, error) {
+	result := r.database.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", now)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *GormRepository) CreateLoginAttempt(attempt *LoginAttempt) error {
+	return r.database.Create(attempt).Error
+}
+
+func (r *GormRepository) LatestLoginAttempts(username string, limit int) ([]LoginAttempt, error) {
+	var attempts []LoginAttempt
+	err := r.database.Where("username = ?", username).Order("id DESC").Limit(limit).Find(&attempts).Error
+
+	return attempts, err
+}
+
+func (r *GormRepository) CountFailedLoginsByIP(ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.database.Model(&LoginAttempt{}).
+		Where("ip = ? AND success = ? AND created_at >= ?", ip, false, since).
+		Count(&count).Error
+
+	return count, err
+}
+
+func (r *GormRepository) HasSignedInFrom(userID uint, ip string, userAgent string) (bool, error) {
+	var count int64
+	err := r.database.Model(&LoginAttempt{}).
+		Where("user_id = ? AND success = ? AND ip = ? AND user_agent = ?", userID, true, ip, userAgent).
+		Limit(1).Count(&count).Error
+
+	return count > 0, err
+}
+
+func (r *GormRepository) HasSignedIn(userID uint) (bool, error) {
+	var count int64
+	err := r.database.Model(&LoginAttempt{}).
+		Where("user_id = ? AND success = ?", userID, true).
+		Limit(1).Count(&count).Error
+
+	return count > 0, err
+}
+
+func (r *GormRepository) ListLoginAttempts(userID uint, limit int) ([]LoginAttempt, error) {
+	var attempts []LoginAttempt
+	err := r.database.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&attempts).Error
+
+	return attempts, err
+}
+
+func (r *GormRepository) Search(query string, limit int) ([]User, error) {
+	var users []User
+	pattern := "%" + escapeLike(strings.ToLower(query)) + "%"
+	err := r.database.
+		Where(`LOWER(username) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\'`, pattern, pattern).
+		Order("id").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+func (r *GormRepository) ListDeleting(startedBefore time.Time, limit int) ([]User, error) {
+	var users []User
+	err := r.database.Where("deleting_at < ?", startedBefore).Order("id").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *GormRepository) Stats() (*Stats, error) {
+	var stats Stats
+
+	counts := map[*int64]*gorm.DB{
+		&stats.Users:    r.database.Model(&User{}),
+		&stats.Admins:   r.database.Model(&User{}).Where("role = ?", RoleAdmin),
+		&stats.Disabled: r.database.Model(&User{}).Where("disabled_at IS NOT NULL"),
+	}
+
+	for count, query := range counts {
+		if err := query.Count(count).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,61 @@
+package user
+
+import (
+	"time"
+)
+
+// freeFailedLogins is how many consecutive failures an account may have
+// before further attempts are delayed.
+const freeFailedLogins = 3
+
+// maxLockout caps the delay between attempts once an account keeps failing.
+const maxLockout = 15 * time.Minute
+
+// lockoutLookback is how many recent attempts are inspected to count
+// consecutive failures; enough to reach maxLockout.
+const lockoutLookback = 20
+
+// ipFailureWindow and maxIPFailures limit failed attempts from one address
+// across all accounts, to slow down password spraying.
+const ipFailureWindow = 15 * time.Minute
+const maxIPFailures = 20
+
+// lockoutDuration returns how long an account must wait after its latest
+// failure. The delay doubles with every failure past freeFailedLogins.
+func lockoutDuration(failures int) time.Duration {
+	if failures < freeFailedLogins {
+		return 0
+	}
+
+	shift := failures - freeFailedLogins
+	if shift > 30 {
+		return maxLockout
+	}
+
+	delay := time.Second << shift
+	if delay > maxLockout {
+		return maxLockout
+	}
+
+	return delay
+}
+
+// lockedUntil returns when username may next attempt to sign in, based on
+// its consecutive failures since the last success. The zero time means it is
+// not locked.
+func lockedUntil(attempts []LoginAttempt) time.Time {
+	failures := 0
+
+	for _, attempt := range attempts {
+		if attempt.Success {
+			break
+		}
+		failures++
+	}
+
+	if failures == 0 {
+		return time.Time{}
+	}
+
+	return attempts[0].CreatedAt.Add(lockoutDuration(failures))
+}
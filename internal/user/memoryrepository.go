@@ -0,0 +1,358 @@
+package user
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps users in process memory. It is meant for tests and
+// local development, not for production use.
+type MemoryRepository struct {
+	mu       sync.RWMutex
+	nextID   uint
+	users    map[uint]User
+	attempts []LoginAttempt
+	codes    []RecoveryCode
+	resets   []PasswordResetToken
+}
+
+func NewMemoryRepository() Repository {
+	return &MemoryRepository{
+		nextID: 1,
+		users:  make(map[uint]User),
+	}
+}
+
+func (r *MemoryRepository) FindByID(id uint) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+func (r *MemoryRepository) FindByUsername(username string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) Create(user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+
+	if user.ID == 0 {
+		user.ID = r.nextID
+	}
+	if user.ID >= r.nextID {
+		r.nextID = user.ID + 1
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	r.users[user.ID] = *user
+
+	return nil
+}
+
+func (r *MemoryRepository) Update(user *User, columns ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	for _, column := range columns {
+		switch column {
+		case ColumnPassword:
+			stored.Password = user.Password
+		case ColumnTOTPSecret:
+			stored.TOTPSecret = user.TOTPSecret
+		case ColumnTwoFactorEnabled:
+			stored.TwoFactorEnabled = user.TwoFactorEnabled
+		case ColumnTOTPLastStep:
+			stored.TOTPLastStep = user.TOTPLastStep
+		case ColumnDisplayName:
+			stored.DisplayName = user.DisplayName
+		case ColumnEmail:
+			stored.Email = user.Email
+		case ColumnDefaultRedirectType:
+			stored.DefaultRedirectType = user.DefaultRedirectType
+		case ColumnDefaultExpiryDays:
+			stored.DefaultExpiryDays = user.DefaultExpiryDays
+		case ColumnRole:
+			stored.Role = user.Role
+		case ColumnDisabledAt:
+			stored.DisabledAt = user.DisabledAt
+		case ColumnDeletingAt:
+			stored.DeletingAt = user.DeletingAt
+		}
+	}
+
+	r.users[user.ID] = stored
+
+	return nil
+}
+
+func (r *MemoryRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users, id)
+
+	attempts := []LoginAttempt{}
+	for _, attempt := range r.attempts {
+		if !isUser(attempt, id) {
+			attempts = append(attempts, attempt)
+		}
+	}
+	r.attempts = attempts
+
+	codes := []RecoveryCode{}
+	for _, code := range r.codes {
+		if code.UserID != id {
+			codes = append(codes, code)
+		}
+	}
+	r.codes = codes
+
+	resets := []PasswordResetToken{}
+	for _, reset := range r.resets {
+		if reset.UserID != id {
+			resets = append(resets, reset)
+		}
+	}
+	r.resets = resets
+
+	return nil
+}
+
+func (r *MemoryRepository) CreatePasswordResetToken(token *PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = uint(len(r.resets) + 1)
+	token.CreatedAt = time.Now()
+	r.resets = append(r.resets, *token)
+
+	return nil
+}
+
+func (r *MemoryRepository) UsePasswordResetToken(hash string, now time.Time) (*PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, token := range r.resets {
+		if token.TokenHash == hash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			usedAt := now
+			r.resets[i].UsedAt = &usedAt
+			token.UsedAt = &usedAt
+			return &token, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) RevokePasswordResetTokens(userID uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, token := range r.resets {
+		if token.UserID == userID && token.UsedAt == nil {
+			usedAt := now
+			r.resets[i].UsedAt = &usedAt
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := []RecoveryCode{}
+	for _, code := range r.codes {
+		if code.UserID != userID {
+			codes = append(codes, code)
+		}
+	}
+
+	for _, hash := range hashes {
+		codes = append(codes, RecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: time.Now()})
+	}
+
+	r.codes = codes
+
+	return nil
+}
+
+func (r *MemoryRepository) UseRecoveryCode(userID uint, hash string, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, code := range r.codes {
+		if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+			usedAt := now
+			r.codes[i].UsedAt = &usedAt
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *MemoryRepository) CreateLoginAttempt(attempt *LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt.ID = uint(len(r.attempts) + 1)
+	if attempt.CreatedAt.IsZero() {
+		attempt.CreatedAt = time.Now()
+	}
+
+	r.attempts = append(r.attempts, *attempt)
+
+	return nil
+}
+
+// latestAttempts returns up to limit attempts matching keep, newest first.
+func (r *MemoryRepository) latestAttempts(limit int, keep func(LoginAttempt) bool) []LoginAttempt {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attempts := []LoginAttempt{}
+
+	for i := len(r.attempts) - 1; i >= 0 && (limit <= 0 || len(attempts) < limit); i-- {
+		if keep(r.attempts[i]) {
+			attempts = append(attempts, r.attempts[i])
+		}
+	}
+
+	return attempts
+}
+
+func (r *MemoryRepository) LatestLoginAttempts(username string, limit int) ([]LoginAttempt, error) {
+	return r.latestAttempts(limit, func(attempt LoginAttempt) bool {
+		return attempt.Username == username
+	}), nil
+}
+
+func (r *MemoryRepository) CountFailedLoginsByIP(ip string, since time.Time) (int64, error) {
+	attempts := r.latestAttempts(0, func(attempt LoginAttempt) bool {
+		return attempt.IP == ip && !attempt.Success && !attempt.CreatedAt.Before(since)
+	})
+
+	return int64(len(attempts)), nil
+}
+
+func (r *MemoryRepository) HasSignedInFrom(userID uint, ip string, userAgent string) (bool, error) {
+	attempts := r.latestAttempts(1, func(attempt LoginAttempt) bool {
+		return isUser(attempt, userID) && attempt.Success && attempt.IP == ip && attempt.UserAgent == userAgent
+	})
+
+	return len(attempts) > 0, nil
+}
+
+func (r *MemoryRepository) HasSignedIn(userID uint) (bool, error) {
+	attempts := r.latestAttempts(1, func(attempt LoginAttempt) bool {
+		return isUser(attempt, userID) && attempt.Success
+	})
+
+	return len(attempts) > 0, nil
+}
+
+func (r *MemoryRepository) ListLoginAttempts(userID uint, limit int) ([]LoginAttempt, error) {
+	return r.latestAttempts(limit, func(attempt LoginAttempt) bool {
+		return isUser(attempt, userID)
+	}), nil
+}
+
+func isUser(attempt LoginAttempt, userID uint) bool {
+	return attempt.UserID != nil && *attempt.UserID == userID
+}
+
+func (r *MemoryRepository) Search(query string, limit int) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(query)
+
+	var users []User
+	for _, user := range r.users {
+		if strings.Contains(strings.ToLower(user.Username), query) || strings.Contains(user.Email, query) {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (r *MemoryRepository) ListDeleting(startedBefore time.Time, limit int) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []User
+	for _, user := range r.users {
+		if user.DeletingAt != nil && user.DeletingAt.Before(startedBefore) {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (r *MemoryRepository) Stats() (*Stats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := Stats{Users: int64(len(r.users))}
+
+	for _, user := range r.users {
+		if user.Role == RoleAdmin {
+			stats.Admins++
+		}
+		if user.DisabledAt != nil {
+			stats.Disabled++
+		}
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notifier delivers password reset tokens to users. Accounts only have a
+// username, so how the token reaches its owner is up to the deployment.
+type Notifier interface {
+	SendPasswordReset(user User, token string, expiresAt time.Time) error
+}
+
+// LogNotifier writes reset tokens to the application log. It is only meant
+// for local development.
+type LogNotifier struct{}
+
+func (n LogNotifier) SendPasswordReset(user User, token string, expiresAt time.Time) error {
+	log.Printf("password reset token for %s (valid until %s): %s", user.Username, expiresAt.Format(time.RFC3339), token)
+	return nil
+}
+
+// FileNotifier appends each reset token as a line of JSON to a file, which
+// a mailer or a developer can pick up from there.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+type passwordResetMessage struct {
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (n *FileNotifier) SendPasswordReset(user User, token string, expiresAt time.Time) error {
+	line, err := json.Marshal(passwordResetMessage{Username: user.Username, Token: token, ExpiresAt: expiresAt})
+
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
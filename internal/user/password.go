@@ -0,0 +1,167 @@
+package user
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const DefaultMinPasswordLength = 8
+
+// maxPasswordBytes is the most bcrypt will hash.
+const maxPasswordBytes = 72
+
+const resetTokenBytes = 32
+const passwordResetValidDuration = time.Hour
+
+// maxUsernameDistance is how many single character edits a password must be
+// away from the username.
+const maxUsernameDistance = 2
+
+// PasswordPolicy decides which new passwords are acceptable.
+type PasswordPolicy struct {
+	minLength int
+	breached  map[string]bool
+}
+
+// NewPasswordPolicy builds a policy requiring minLength characters. If
+// breachedPath is set, the file is read as a list of known breached
+// passwords, one per line.
+func NewPasswordPolicy(minLength int, breachedPath string) (*PasswordPolicy, error) {
+	if minLength <= 0 {
+		minLength = DefaultMinPasswordLength
+	}
+	if minLength > maxPasswordBytes {
+		return nil, fmt.Errorf("minimum password length may be at most %d", maxPasswordBytes)
+	}
+
+	p := &PasswordPolicy{minLength: minLength, breached: make(map[string]bool)}
+
+	if breachedPath == "" {
+		return p, nil
+	}
+
+	file, err := os.Open(breachedPath)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			p.breached[line] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Check returns why password may not be used by username, or an empty
+// string if it may.
+func (p *PasswordPolicy) Check(username string, password string) string {
+	switch {
+	case len([]rune(password)) < p.minLength:
+		return fmt.Sprintf("Password must be at least %d characters long", p.minLength)
+	case len(password) > maxPasswordBytes:
+		return fmt.Sprintf("Password must be at most %d bytes long", maxPasswordBytes)
+	case p.breached[password]:
+		return "Password appears in a list of breached passwords"
+	case similarToUsername(username, password):
+		return "Password is too similar to the username"
+	}
+
+	return ""
+}
+
+// similarToUsername compares the letters and digits of both, ignoring case,
+// and rejects passwords that contain the username, are contained in it or
+// are only a few edits away from it.
+func similarToUsername(username string, password string) bool {
+	u, p := alphanumeric(username), alphanumeric(password)
+
+	if u == "" || p == "" {
+		return false
+	}
+
+	return strings.Contains(p, u) || strings.Contains(u, p) || editDistance(u, p) <= maxUsernameDistance
+}
+
+func alphanumeric(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
+
+// generateResetToken returns a password reset token and the hash to store.
+func generateResetToken() (string, string, error) {
+	raw := make([]byte, resetTokenBytes)
+
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	return token, hashResetToken(token), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
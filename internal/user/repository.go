@@ -0,0 +1,73 @@
+package user
+
+import (
+	"errors"
+	"time"
+)
+
+// Columns of a user that Update can write.
+const (
+	ColumnPassword            = "password"
+	ColumnTOTPSecret          = "totp_secret"
+	ColumnTwoFactorEnabled    = "two_factor_enabled"
+	ColumnTOTPLastStep        = "totp_last_step"
+	ColumnDisplayName         = "display_name"
+	ColumnEmail               = "email"
+	ColumnDefaultRedirectType = "default_redirect_type"
+	ColumnDefaultExpiryDays   = "default_expiry_days"
+	ColumnRole                = "role"
+	ColumnDisabledAt          = "disabled_at"
+	ColumnDeletingAt          = "deleting_at"
+)
+
+var ErrNotFound = errors.New("user not found")
+var ErrDuplicate = errors.New("username already exists")
+
+// Repository abstracts user storage so that UserManagerImpl does not depend on
+// a particular database.
+type Repository interface {
+	FindByID(id uint) (*User, error)
+	FindByUsername(username string) (*User, error)
+	// Create returns ErrDuplicate when the username is already taken.
+	Create(user *User) error
+	// Update writes the given columns of user, so that a stale copy cannot
+	// undo a concurrent change to the others.
+	Update(user *User, columns ...string) error
+	// Delete removes the user along with their login history, recovery codes
+	// and password reset tokens.
+	Delete(id uint) error
+	CreatePasswordResetToken(token *PasswordResetToken) error
+	// UsePasswordResetToken marks the unused, unexpired token with the given
+	// hash as used and returns it, or ErrNotFound.
+	UsePasswordResetToken(hash string, now time.Time) (*PasswordResetToken, error)
+	// RevokePasswordResetTokens marks all of the user's unused tokens as used.
+	RevokePasswordResetTokens(userID uint, now time.Time) error
+	// ReplaceRecoveryCodes deletes the user's recovery codes and stores the
+	// given hashes instead.
+	ReplaceRecoveryCodes(userID uint, hashes []string) error
+	// UseRecoveryCode marks an unused code as used and reports whether one
+	// matched.
+	UseRecoveryCode(userID uint, hash string, now time.Time) (bool, error)
+	CreateLoginAttempt(attempt *LoginAttempt) error
+	// LatestLoginAttempts returns up to limit attempts for username, newest
+	// first.
+	LatestLoginAttempts(username string, limit int) ([]LoginAttempt, error)
+	// CountFailedLoginsByIP counts failed attempts from ip since the given
+	// time, across all usernames.
+	CountFailedLoginsByIP(ip string, since time.Time) (int64, error)
+	// HasSignedInFrom reports whether userID has ever signed in successfully
+	// from the given IP and user agent.
+	HasSignedInFrom(userID uint, ip string, userAgent string) (bool, error)
+	// HasSignedIn reports whether userID has ever signed in successfully.
+	HasSignedIn(userID uint) (bool, error)
+	// Search returns up to limit users whose username or email contains
+	// query, ignoring case, oldest first.
+	Search(query string, limit int) ([]User, error)
+	Stats() (*Stats, error)
+	// ListDeleting returns up to limit users whose deletion started before
+	// the given time, oldest first.
+	ListDeleting(startedBefore time.Time, limit int) ([]User, error)
+	// ListLoginAttempts returns up to limit attempts on userID's account,
+	// newest first. A negative limit returns every attempt.
+	ListLoginAttempts(userID uint, limit int) ([]LoginAttempt, error)
+}
@@ -0,0 +1,44 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits.
+	secret := []byte("12345678901234567890")
+	assert.Equal(t, "287082", totpCode(secret, 59/30))
+	assert.Equal(t, "081804", totpCode(secret, 1111111109/30))
+	assert.Equal(t, "050471", totpCode(secret, 1111111111/30))
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	assert.Nil(t, err)
+
+	key, _ := totpEncoding.DecodeString(secret)
+	now := time.Unix(1700000000, 0)
+	step := now.Unix() / 30
+
+	matched, ok := verifyTOTP(secret, totpCode(key, step-1), now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, matched)
+
+	_, ok = verifyTOTP(secret, totpCode(key, step-2), now, 0)
+	assert.False(t, ok)
+
+	// A code at or before the last accepted step is a replay.
+	_, ok = verifyTOTP(secret, totpCode(key, step), now, step)
+	assert.False(t, ok)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	assert.Nil(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}$`, codes[0])
+	assert.Equal(t, hashes[0], hashRecoveryCode(" "+codes[0][:4]+codes[0][5:]+" "))
+}
@@ -2,18 +2,232 @@ package user
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID        uint      `json:"-" gorm:"primaryKey"`
 	Username  string    `json:"username" gorm:"index;unique;not null"`
 	Password  string    `json:"-" gorm:"not null"`
 	CreatedAt time.Time `json:"-" gorm:"type:timestamp;default:current_timestamp"`
+	// TOTPSecret is set once enrollment starts; two-factor authentication
+	// is only enforced after it has been confirmed with a valid code.
+	TOTPSecret       string `json:"-"`
+	TwoFactorEnabled bool   `json:"twoFactorEnabled" gorm:"not null;default:false"`
+	// TOTPLastStep is the time step of the last accepted code, so that a
+	// code cannot be used twice.
+	TOTPLastStep int64 `json:"-" gorm:"not null;default:0"`
+
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+	// DefaultRedirectType and DefaultExpiryDays apply to new links that do
+	// not set a redirect type or expiry themselves.
+	DefaultRedirectType string `json:"defaultRedirectType"`
+	DefaultExpiryDays   uint   `json:"defaultExpiryDays" gorm:"not null;default:0"`
+
+	Role string `json:"role" gorm:"not null;default:user"`
+	// DisabledAt is set while an administrator has disabled the account.
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	// DeletingAt is set when the account's deletion starts. Deletion takes
+	// several steps, and accounts left with it set are finished off later.
+	DeletingAt *time.Time `json:"-" gorm:"index"`
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin && u.DisabledAt == nil
+}
+
+// RecoveryCode is a single-use code that can stand in for a TOTP code. Only
+// a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// PasswordResetToken lets its holder set a new password once before it
+// expires. Only a hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// LoginAttempt records a sign-in attempt for the login history and for
+// lockout decisions. UserID is nil when the username does not exist.
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    *uint     `json:"-" gorm:"index"`
+	Username  string    `json:"-" gorm:"index;not null"`
+	IP        string    `json:"ip" gorm:"index;not null"`
+	UserAgent string    `json:"userAgent" gorm:"not null"`
+	Success   bool      `json:"success" gorm:"not null"`
+	NewClient bool      `json:"newClient" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
 }
 
 type Request struct {
-	Username string `json:"username" validate:"required,max=32"`
-	Password string `json:"password" validate:"required,min=8"`
+	Username  string `json:"username" validate:"required,max=32"`
+	Password  string `json:"password" validate:"required"`
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 type Response struct {
 	User User `json:"user"`
+	// NewClient is set on sign-in from an IP and user agent pair the account
+	// has never signed in from before.
+	NewClient bool `json:"new_client,omitempty"`
+	// MFARequired is set when the password was correct but the account
+	// still has to pass its second factor.
+	MFARequired bool `json:"mfa_required,omitempty"`
+}
+
+type EnrollTwoFactorRequest struct {
+	UserID uint
+}
+
+type EnrollTwoFactorResponse struct {
+	Secret string `json:"secret"`
+	// OTPAuthURI is the otpauth:// key URI, also used as the QR code payload.
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorRequest struct {
+	UserID uint   `json:"-"`
+	Code   string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// SecondFactorRequest completes a sign-in with a TOTP or recovery code.
+type SecondFactorRequest struct {
+	MFAToken  string `json:"mfa_token" validate:"required"`
+	Code      string `json:"code" validate:"required"`
+	UserID    uint   `json:"-"`
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+type LoginHistoryRequest struct {
+	UserID uint
+	Limit  int
+}
+
+type LoginHistoryResponse struct {
+	Logins []LoginAttempt `json:"logins"`
+}
+
+type ChangePasswordRequest struct {
+	UserID          uint   `json:"-"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+	IP              string `json:"-"`
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"username" validate:"required,max=32"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type ProfileRequest struct {
+	UserID uint
+}
+
+// UpdateProfileRequest changes only the fields that are set. Empty strings
+// clear the corresponding field.
+type UpdateProfileRequest struct {
+	UserID              uint    `json:"-"`
+	DisplayName         *string `json:"display_name" validate:"omitempty,max=64"`
+	Email               *string `json:"email" validate:"omitempty,eq=|email,max=254"`
+	DefaultRedirectType *string `json:"default_redirect_type" validate:"omitempty,eq=|oneof=permanent temporary method_preserving"` //nolint:lll
+	DefaultExpiryDays   *uint   `json:"default_expiry_days" validate:"omitempty,max=3650"`
+}
+
+type ConfirmPasswordRequest struct {
+	UserID   uint   `json:"-"`
+	Password string `json:"password" validate:"required"`
+	IP       string `json:"-"`
+}
+
+type DeleteAccountRequest struct {
+	UserID uint
+}
+
+// PendingDeletionsRequest asks for up to Limit accounts whose deletion started
+// before StartedBefore and has not finished.
+type PendingDeletionsRequest struct {
+	StartedBefore time.Time
+	Limit         int
+}
+
+type PendingDeletionsResponse struct {
+	UserIDs []uint
+}
+
+type ExportRequest struct {
+	UserID uint
+}
+
+// ExportResponse holds the account data kept about a user, except for
+// secrets such as password hashes.
+type ExportResponse struct {
+	User   User           `json:"user"`
+	Logins []LoginAttempt `json:"logins"`
+}
+
+// AdminUser is the view of an account shown to administrators.
+type AdminUser struct {
+	ID               uint       `json:"id"`
+	Username         string     `json:"username"`
+	DisplayName      string     `json:"displayName"`
+	Email            string     `json:"email"`
+	Role             string     `json:"role"`
+	TwoFactorEnabled bool       `json:"twoFactorEnabled"`
+	DisabledAt       *time.Time `json:"disabledAt,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+// SearchRequest finds accounts whose username or email contains Query.
+type SearchRequest struct {
+	Query string
+	Limit int
+}
+
+type SearchResponse struct {
+	Users []AdminUser `json:"users"`
+}
+
+// AdminUpdateRequest changes the role or disabled state of the account with
+// the given ID, on behalf of the administrator AdminID.
+type AdminUpdateRequest struct {
+	AdminID  uint    `json:"-"`
+	ID       uint    `json:"-"`
+	Role     *string `json:"role" validate:"omitempty,oneof=user admin"`
+	Disabled *bool   `json:"disabled"`
+}
+
+type AdminUserResponse struct {
+	User AdminUser `json:"user"`
+	// Previous is the account as it was before the change.
+	Previous AdminUser `json:"-"`
+}
+
+type Stats struct {
+	Users    int64 `json:"users"`
+	Admins   int64 `json:"admins"`
+	Disabled int64 `json:"disabled"`
 }
@@ -2,56 +2,90 @@ package user
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 type UserManager interface {
 	SignUp(Request) (*Response, dcubeerrs.Error)
 	SignIn(Request) (*Response, dcubeerrs.Error)
+	GetLoginHistory(LoginHistoryRequest) (*LoginHistoryResponse, dcubeerrs.Error)
+	VerifySecondFactor(SecondFactorRequest) (*Response, dcubeerrs.Error)
+	EnrollTwoFactor(EnrollTwoFactorRequest) (*EnrollTwoFactorResponse, dcubeerrs.Error)
+	ConfirmTwoFactor(TwoFactorRequest) (*RecoveryCodesResponse, dcubeerrs.Error)
+	DisableTwoFactor(TwoFactorRequest) dcubeerrs.Error
+	ChangePassword(ChangePasswordRequest) dcubeerrs.Error
+	RequestPasswordReset(PasswordResetRequest) dcubeerrs.Error
+	ResetPassword(ResetPasswordRequest) (*Response, dcubeerrs.Error)
+	GetProfile(ProfileRequest) (*Response, dcubeerrs.Error)
+	UpdateProfile(UpdateProfileRequest) (*Response, dcubeerrs.Error)
+	ConfirmPassword(ConfirmPasswordRequest) dcubeerrs.Error
+	StartDeletion(DeleteAccountRequest) dcubeerrs.Error
+	PendingDeletions(PendingDeletionsRequest) (*PendingDeletionsResponse, dcubeerrs.Error)
+	DeleteAccount(DeleteAccountRequest) dcubeerrs.Error
+	ExportAccount(ExportRequest) (*ExportResponse, dcubeerrs.Error)
+	RequireAdmin(userID uint) dcubeerrs.Error
+	BootstrapAdmin(username string) dcubeerrs.Error
+	SearchUsers(SearchRequest) (*SearchResponse, dcubeerrs.Error)
+	UpdateAccount(AdminUpdateRequest) (*AdminUserResponse, dcubeerrs.Error)
+	GetStats() (*Stats, dcubeerrs.Error)
 }
 
 type UserManagerImpl struct {
-	database *gorm.DB
+	repository Repository
+	policy     *PasswordPolicy
+	notifier   Notifier
+	// issuer names the service in authenticator apps.
+	issuer string
 }
 
-func NewUserManager(database *gorm.DB) UserManager {
+func NewUserManager(repository Repository, policy *PasswordPolicy, notifier Notifier, issuer string) UserManager {
 	return &UserManagerImpl{
-		database: database,
+		repository: repository,
+		policy:     policy,
+		notifier:   notifier,
+		issuer:     issuer,
 	}
 }
 
 func (m *UserManagerImpl) SignUp(req Request) (*Response, dcubeerrs.Error) {
-	var user User
-	err := m.database.First(&user, User{Username: req.Username}).Error
+	_, err := m.repository.FindByUsername(req.Username)
 
-	if err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating new user")
-		}
+	if err == nil {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Username already exists")
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating new user")
 	}
 
-	if user.Username == req.Username {
-		return nil, dcubeerrs.New(http.StatusBadRequest, "Username already exists")
+	if reason := m.policy.Check(req.Username, req.Password); reason != "" {
+		return nil, dcubeerrs.NewValidation(dcubeerrs.FieldError{Field: "password", Message: reason})
 	}
 
-	pwHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	pwHash, e := hashPassword(req.Password)
 
-	if err != nil {
-		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while hashing password")
+	if e != nil {
+		return nil, e
 	}
 
 	newUser := User{
 		Username: req.Username,
-		Password: string(pwHash),
+		Password: pwHash,
+		Role:     RoleUser,
 	}
 
-	err = m.database.Create(&newUser).Error
+	err = m.repository.Create(&newUser)
 
 	if err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			return nil, dcubeerrs.New(http.StatusBadRequest, "Username already exists")
+		}
 		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating new user")
 	}
 
@@ -59,21 +93,725 @@ func (m *UserManagerImpl) SignUp(req Request) (*Response, dcubeerrs.Error) {
 }
 
 func (m *UserManagerImpl) SignIn(req Request) (*Response, dcubeerrs.Error) {
-	var user User
-	err := m.database.First(&user, User{Username: req.Username}).Error
+	now := time.Now().UTC()
+
+	if e := m.checkLockout(req.Username, req.IP, now); e != nil {
+		return nil, e
+	}
+
+	user, err := m.repository.FindByUsername(req.Username)
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while authenticating user")
+	}
+
+	success := user != nil && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) == nil
+
+	if success && user.DisabledAt != nil {
+		return nil, dcubeerrs.New(http.StatusForbidden, "Account is disabled")
+	}
+	if success && user.DeletingAt != nil {
+		return nil, dcubeerrs.New(http.StatusForbidden, "Account is being deleted")
+	}
+
+	// The attempt is only recorded once the second factor has been checked,
+	// so that a correct password does not reset the failure count for it.
+	if success && user.TwoFactorEnabled {
+		return &Response{User: *user, MFARequired: true}, nil
+	}
+
+	attempt, e := m.recordAttempt(user, req.Username, req.IP, req.UserAgent, success, now)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if !attempt.Success {
+		return nil, dcubeerrs.New(http.StatusUnauthorized, "Invalid username or password")
+	}
+
+	return &Response{User: *user, NewClient: attempt.NewClient}, nil
+}
+
+// VerifySecondFactor completes a sign-in for a user whose password has
+// already been checked, accepting either a TOTP code or an unused recovery
+// code.
+func (m *UserManagerImpl) VerifySecondFactor(req SecondFactorRequest) (*Response, dcubeerrs.Error) {
+	now := time.Now().UTC()
+	user, err := m.repository.FindByID(req.UserID)
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, dcubeerrs.New(http.StatusUnauthorized, "Invalid username or password")
+		if errors.Is(err, ErrNotFound) {
+			return nil, dcubeerrs.New(http.StatusUnauthorized, "Invalid or expired sign-in token")
 		}
 		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while authenticating user")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	if !user.TwoFactorEnabled {
+		return nil, dcubeerrs.New(http.StatusUnauthorized, "Invalid or expired sign-in token")
+	}
+
+	// The account may have been disabled or its deletion started since the
+	// password was checked.
+	if user.DisabledAt != nil {
+		return nil, dcubeerrs.New(http.StatusForbidden, "Account is disabled")
+	}
+	if user.DeletingAt != nil {
+		return nil, dcubeerrs.New(http.StatusForbidden, "Account is being deleted")
+	}
+
+	if e := m.checkLockout(user.Username, req.IP, now); e != nil {
+		return nil, e
+	}
+
+	success, e := m.checkSecondFactor(user, req.Code, now)
+
+	if e != nil {
+		return nil, e
+	}
+
+	attempt, e := m.recordAttempt(user, user.Username, req.IP, req.UserAgent, success, now)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if !attempt.Success {
+		return nil, dcubeerrs.New(http.StatusUnauthorized, "Invalid code")
+	}
+
+	return &Response{User: *user, NewClient: attempt.NewClient}, nil
+}
+
+// recordAttempt stores the outcome of a sign-in and flags successful ones
+// from a client the account has not used before.
+func (m *UserManagerImpl) recordAttempt(
+	user *User, username string, ip string, userAgent string, success bool, now time.Time,
+) (*LoginAttempt, dcubeerrs.Error) {
+	var err error
+	attempt := LoginAttempt{Username: username, IP: ip, UserAgent: userAgent, Success: success, CreatedAt: now}
+
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+
+	if attempt.Success {
+		attempt.NewClient, err = m.isNewClient(user.ID, ip, userAgent)
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while authenticating user")
+		}
+		if attempt.NewClient {
+			log.Printf("sign-in for user %d from new client %s (%s)", user.ID, ip, userAgent)
+		}
+	}
+
+	if err := m.repository.CreateLoginAttempt(&attempt); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while authenticating user")
+	}
+
+	return &attempt, nil
+}
+
+// checkSecondFactor accepts a TOTP code newer than the last one used, or
+// consumes a recovery code.
+func (m *UserManagerImpl) checkSecondFactor(user *User, code string, now time.Time) (bool, dcubeerrs.Error) {
+	if step, ok := verifyTOTP(user.TOTPSecret, strings.TrimSpace(code), now, user.TOTPLastStep); ok {
+		user.TOTPLastStep = step
+
+		if err := m.repository.Update(user, ColumnTOTPLastStep); err != nil {
+			return false, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while verifying code")
+		}
+
+		return true, nil
+	}
+
+	used, err := m.repository.UseRecoveryCode(user.ID, hashRecoveryCode(code), now)
 
 	if err != nil {
-		return nil, dcubeerrs.New(http.StatusUnauthorized, "Invalid username or password")
+		return false, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while verifying code")
+	}
+
+	return used, nil
+}
+
+// checkLockout rejects the attempt if its IP address has failed too often or
+// the username is still waiting out the delay after repeated failures. It
+// applies to unknown usernames too so that it does not reveal which exist.
+func (m *UserManagerImpl) checkLockout(username string, ip string, now time.Time) dcubeerrs.Error {
+	ipFailures, err := m.repository.CountFailedLoginsByIP(ip, now.Add(-ipFailureWindow))
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while authenticating user")
+	}
+
+	if ipFailures >= maxIPFailures {
+		return dcubeerrs.New(http.StatusTooManyRequests, "Too many failed sign-in attempts, please try again later")
+	}
+
+	attempts, err := m.repository.LatestLoginAttempts(username, lockoutLookback)
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while authenticating user")
+	}
+
+	if until := lockedUntil(attempts); now.Before(until) {
+		wait := int(until.Sub(now).Round(time.Second).Seconds())
+		if wait < 1 {
+			wait = 1
+		}
+		return dcubeerrs.New(
+			http.StatusTooManyRequests,
+			fmt.Sprintf("Account is temporarily locked, please try again in %d seconds", wait),
+		)
+	}
+
+	return nil
+}
+
+// isNewClient reports whether the account has signed in before, but never from
+// this IP address and user agent.
+func (m *UserManagerImpl) isNewClient(userID uint, ip string, userAgent string) (bool, error) {
+	signedIn, err := m.repository.HasSignedIn(userID)
+
+	if err != nil || !signedIn {
+		return false, err
+	}
+
+	seen, err := m.repository.HasSignedInFrom(userID, ip, userAgent)
+
+	return !seen, err
+}
+
+func (m *UserManagerImpl) GetLoginHistory(req LoginHistoryRequest) (*LoginHistoryResponse, dcubeerrs.Error) {
+	attempts, err := m.repository.ListLoginAttempts(req.UserID, req.Limit)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching login history")
+	}
+
+	return &LoginHistoryResponse{Logins: attempts}, nil
+}
+
+// EnrollTwoFactor generates a new secret for the user. It only takes effect
+// once ConfirmTwoFactor has seen a valid code for it.
+func (m *UserManagerImpl) EnrollTwoFactor(req EnrollTwoFactorRequest) (*EnrollTwoFactorResponse, dcubeerrs.Error) {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, dcubeerrs.New(http.StatusConflict, "Two-factor authentication is already enabled")
+	}
+
+	secret, err := generateTOTPSecret()
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while generating secret")
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+
+	if err := m.repository.Update(user, ColumnTOTPSecret, ColumnTOTPLastStep); err != nil {
+		return nil, dcubeerrs.New(
+			http.StatusInternalServerError,
+			"An error occurred while enrolling two-factor authentication",
+		)
+	}
+
+	return &EnrollTwoFactorResponse{
+		Secret:     secret,
+		OTPAuthURI: otpauthURI(m.issuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the
+// recovery codes. They are not stored in plain text and cannot be shown
+// again.
+func (m *UserManagerImpl) ConfirmTwoFactor(req TwoFactorRequest) (*RecoveryCodesResponse, dcubeerrs.Error) {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, dcubeerrs.New(http.StatusConflict, "Two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Two-factor enrollment has not been started")
+	}
+
+	step, ok := verifyTOTP(user.TOTPSecret, strings.TrimSpace(req.Code), time.Now().UTC(), user.TOTPLastStep)
+
+	if !ok {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Invalid code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while generating recovery codes")
+	}
+
+	if err := m.repository.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while generating recovery codes")
+	}
+
+	user.TwoFactorEnabled = true
+	user.TOTPLastStep = step
+
+	if err := m.repository.Update(user, ColumnTwoFactorEnabled, ColumnTOTPLastStep); err != nil {
+		return nil, dcubeerrs.New(
+			http.StatusInternalServerError,
+			"An error occurred while enabling two-factor authentication",
+		)
+	}
+
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking a
+// current TOTP or recovery code, and discards the secret and recovery codes.
+func (m *UserManagerImpl) DisableTwoFactor(req TwoFactorRequest) dcubeerrs.Error {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return e
+	}
+
+	if !user.TwoFactorEnabled {
+		return dcubeerrs.New(http.StatusBadRequest, "Two-factor authentication is not enabled")
+	}
+
+	ok, e := m.checkSecondFactor(user, req.Code, time.Now().UTC())
+
+	if e != nil {
+		return e
+	}
+	if !ok {
+		return dcubeerrs.New(http.StatusBadRequest, "Invalid code")
+	}
+
+	if err := m.repository.ReplaceRecoveryCodes(user.ID, nil); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while disabling two-factor authentication")
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.TwoFactorEnabled = false
+
+	if err := m.repository.Update(user, ColumnTOTPSecret, ColumnTOTPLastStep, ColumnTwoFactorEnabled); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while disabling two-factor authentication")
+	}
+
+	return nil
+}
+
+func (m *UserManagerImpl) findUser(id uint) (*User, dcubeerrs.Error) {
+	user, err := m.repository.FindByID(id)
+
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, dcubeerrs.New(http.StatusNotFound, "User not found")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching user")
+	}
+
+	return user, nil
+}
+
+// ChangePassword sets a new password after checking the current one.
+func (m *UserManagerImpl) ChangePassword(req ChangePasswordRequest) dcubeerrs.Error {
+	now := time.Now().UTC()
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return e
+	}
+
+	if e := m.checkPassword(user, req.CurrentPassword, req.IP, "current_password", now); e != nil {
+		return e
+	}
+
+	return m.setPassword(user, req.NewPassword, now)
+}
+
+// checkPassword re-authenticates a signed in user before a sensitive change.
+// Failures are reported on field and count towards the account lockout.
+func (m *UserManagerImpl) checkPassword(
+	user *User, password string, ip string, field string, now time.Time,
+) dcubeerrs.Error {
+	if e := m.checkLockout(user.Username, ip, now); e != nil {
+		return e
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+		return nil
 	}
 
-	return &Response{User: user}, nil
+	if _, e := m.recordAttempt(user, user.Username, ip, "", false, now); e != nil {
+		return e
+	}
+
+	return dcubeerrs.NewValidation(dcubeerrs.FieldError{Field: field, Message: "Password is incorrect"})
+}
+
+// RequestPasswordReset sends a reset token to the user through the notifier.
+// It succeeds whether or not the username exists so that it cannot be used to
+// discover accounts.
+func (m *UserManagerImpl) RequestPasswordReset(req PasswordResetRequest) dcubeerrs.Error {
+	user, err := m.repository.FindByUsername(req.Username)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while requesting password reset")
+	}
+
+	token, hash, err := generateResetToken()
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while requesting password reset")
+	}
+
+	expiresAt := time.Now().UTC().Add(passwordResetValidDuration)
+	reset := PasswordResetToken{UserID: user.ID, TokenHash: hash, ExpiresAt: expiresAt}
+
+	if err := m.repository.CreatePasswordResetToken(&reset); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while requesting password reset")
+	}
+
+	if err := m.notifier.SendPasswordReset(*user, token, expiresAt); err != nil {
+		log.Printf("Error sending password reset to user %d: %s", user.ID, err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password for the owner of a reset token. The
+// caller is expected to sign the user out everywhere afterwards.
+func (m *UserManagerImpl) ResetPassword(req ResetPasswordRequest) (*Response, dcubeerrs.Error) {
+	now := time.Now().UTC()
+	token, err := m.repository.UsePasswordResetToken(hashResetToken(req.Token), now)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Invalid or expired password reset token")
+	}
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while resetting password")
+	}
+
+	user, e := m.findUser(token.UserID)
+
+	if e != nil {
+		return nil, e
+	}
+	if user.DeletingAt != nil {
+		return nil, dcubeerrs.New(http.StatusForbidden, "Account is being deleted")
+	}
+
+	if e := m.setPassword(user, req.NewPassword, now); e != nil {
+		return nil, e
+	}
+
+	return &Response{User: *user}, nil
+}
+
+// setPassword applies the password policy, stores the new hash and voids any
+// outstanding reset tokens.
+func (m *UserManagerImpl) setPassword(user *User, password string, now time.Time) dcubeerrs.Error {
+	if reason := m.policy.Check(user.Username, password); reason != "" {
+		return dcubeerrs.NewValidation(dcubeerrs.FieldError{Field: "new_password", Message: reason})
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+		return dcubeerrs.NewValidation(dcubeerrs.FieldError{
+			Field:   "new_password",
+			Message: "New password must be different from the current one",
+		})
+	}
+
+	pwHash, e := hashPassword(password)
+
+	if e != nil {
+		return e
+	}
+
+	user.Password = pwHash
+
+	if err := m.repository.Update(user, ColumnPassword); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating password")
+	}
+
+	if err := m.repository.RevokePasswordResetTokens(user.ID, now); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating password")
+	}
+
+	return nil
+}
+
+func hashPassword(password string) (string, dcubeerrs.Error) {
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", dcubeerrs.New(http.StatusInternalServerError, "An error occurred while hashing password")
+	}
+
+	return string(pwHash), nil
+}
+
+func (m *UserManagerImpl) GetProfile(req ProfileRequest) (*Response, dcubeerrs.Error) {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return &Response{User: *user}, nil
+}
+
+func (m *UserManagerImpl) UpdateProfile(req UpdateProfileRequest) (*Response, dcubeerrs.Error) {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return nil, e
+	}
+
+	var columns []string
+
+	if req.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*req.DisplayName)
+		columns = append(columns, ColumnDisplayName)
+	}
+	if req.Email != nil {
+		user.Email = strings.ToLower(strings.TrimSpace(*req.Email))
+		columns = append(columns, ColumnEmail)
+	}
+	if req.DefaultRedirectType != nil {
+		user.DefaultRedirectType = *req.DefaultRedirectType
+		columns = append(columns, ColumnDefaultRedirectType)
+	}
+	if req.DefaultExpiryDays != nil {
+		user.DefaultExpiryDays = *req.DefaultExpiryDays
+		columns = append(columns, ColumnDefaultExpiryDays)
+	}
+
+	if err := m.repository.Update(user, columns...); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating profile")
+	}
+
+	return &Response{User: *user}, nil
+}
+
+// ConfirmPassword checks the password of a signed in user, for actions that
+// should not be possible with a stolen access token alone.
+func (m *UserManagerImpl) ConfirmPassword(req ConfirmPasswordRequest) dcubeerrs.Error {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return e
+	}
+
+	return m.checkPassword(user, req.Password, req.IP, "password", time.Now().UTC())
+}
+
+// StartDeletion marks the account as being deleted, which stops it from
+// signing in again while the caller deletes what belongs to it. Starting a
+// deletion that has already started keeps its original time, so that it is
+// still picked up by PendingDeletions.
+func (m *UserManagerImpl) StartDeletion(req DeleteAccountRequest) dcubeerrs.Error {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return e
+	}
+	if user.DeletingAt != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	user.DeletingAt = &now
+
+	if err := m.repository.Update(user, ColumnDeletingAt); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting account")
+	}
+
+	return nil
+}
+
+// PendingDeletions lists the accounts whose deletion was interrupted.
+func (m *UserManagerImpl) PendingDeletions(req PendingDeletionsRequest) (*PendingDeletionsResponse, dcubeerrs.Error) {
+	users, err := m.repository.ListDeleting(req.StartedBefore, req.Limit)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while listing account deletions")
+	}
+
+	resp := &PendingDeletionsResponse{UserIDs: make([]uint, len(users))}
+	for i := range users {
+		resp.UserIDs[i] = users[i].ID
+	}
+
+	return resp, nil
+}
+
+// DeleteAccount removes the user and everything stored about them in this
+// package. The caller deletes their links and sessions.
+func (m *UserManagerImpl) DeleteAccount(req DeleteAccountRequest) dcubeerrs.Error {
+	if _, e := m.findUser(req.UserID); e != nil {
+		return e
+	}
+
+	if err := m.repository.Delete(req.UserID); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting account")
+	}
+
+	return nil
+}
+
+func (m *UserManagerImpl) ExportAccount(req ExportRequest) (*ExportResponse, dcubeerrs.Error) {
+	user, e := m.findUser(req.UserID)
+
+	if e != nil {
+		return nil, e
+	}
+
+	logins, err := m.repository.ListLoginAttempts(req.UserID, -1)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while exporting account")
+	}
+
+	return &ExportResponse{User: *user, Logins: logins}, nil
+}
+
+// RequireAdmin checks that userID belongs to an enabled administrator.
+func (m *UserManagerImpl) RequireAdmin(userID uint) dcubeerrs.Error {
+	user, e := m.findUser(userID)
+
+	if e != nil {
+		return e
+	}
+
+	if !user.IsAdmin() {
+		return dcubeerrs.New(http.StatusForbidden, "This action requires an administrator")
+	}
+
+	return nil
+}
+
+// BootstrapAdmin makes an existing account the first administrator. It
+// refuses once any account holds the admin role, so it cannot hand the role
+// out again later; from then on administrators manage roles themselves.
+func (m *UserManagerImpl) BootstrapAdmin(username string) dcubeerrs.Error {
+	stats, err := m.repository.Stats()
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while counting users")
+	}
+	if stats.Admins > 0 {
+		return dcubeerrs.New(http.StatusConflict, "An administrator already exists")
+	}
+
+	user, err := m.repository.FindByUsername(strings.TrimSpace(username))
+
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return dcubeerrs.New(http.StatusNotFound, "User not found")
+		}
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching user")
+	}
+
+	user.Role = RoleAdmin
+
+	if err := m.repository.Update(user, ColumnRole); err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating user")
+	}
+
+	return nil
+}
+
+func (m *UserManagerImpl) SearchUsers(req SearchRequest) (*SearchResponse, dcubeerrs.Error) {
+	users, err := m.repository.Search(strings.TrimSpace(req.Query), req.Limit)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while searching users")
+	}
+
+	resp := &SearchResponse{Users: make([]AdminUser, len(users))}
+	for i := range users {
+		resp.Users[i] = toAdminUser(&users[i])
+	}
+
+	return resp, nil
+}
+
+// UpdateAccount changes an account's role or disables it. Administrators
+// cannot demote or disable themselves, so that there is always one left.
+// The caller revokes the sessions of disabled accounts.
+func (m *UserManagerImpl) UpdateAccount(req AdminUpdateRequest) (*AdminUserResponse, dcubeerrs.Error) {
+	user, e := m.findUser(req.ID)
+
+	if e != nil {
+		return nil, e
+	}
+
+	demoted := req.Role != nil && *req.Role != RoleAdmin
+	disabled := req.Disabled != nil && *req.Disabled
+
+	if req.ID == req.AdminID && (demoted || disabled) {
+		return nil, dcubeerrs.New(http.StatusConflict, "Administrators cannot demote or disable themselves")
+	}
+
+	previous := toAdminUser(user)
+	var columns []string
+
+	if req.Role != nil {
+		user.Role = *req.Role
+		columns = append(columns, ColumnRole)
+	}
+
+	if req.Disabled != nil {
+		if !*req.Disabled {
+			user.DisabledAt = nil
+		} else if user.DisabledAt == nil {
+			now := time.Now().UTC()
+			user.DisabledAt = &now
+		}
+		columns = append(columns, ColumnDisabledAt)
+	}
+
+	if err := m.repository.Update(user, columns...); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating user")
+	}
+
+	return &AdminUserResponse{User: toAdminUser(user), Previous: previous}, nil
+}
+
+func (m *UserManagerImpl) GetStats() (*Stats, dcubeerrs.Error) {
+	stats, err := m.repository.Stats()
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while counting users")
+	}
+
+	return stats, nil
+}
+
+func toAdminUser(user *User) AdminUser {
+	return AdminUser{
+		ID:               user.ID,
+		Username:         user.Username,
+		DisplayName:      user.DisplayName,
+		Email:            user.Email,
+		Role:             user.Role,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		DisabledAt:       user.DisabledAt,
+		CreatedAt:        user.CreatedAt,
+	}
 }
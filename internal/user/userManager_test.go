@@ -0,0 +1,357 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignUpAndSignIn(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+
+	resp, err := manager.SignUp(Request{Username: "alice", Password: "password1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.User.Username)
+	assert.NotEqual(t, "password1", resp.User.Password)
+
+	_, err = manager.SignUp(Request{Username: "alice", Password: "password2"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	resp, err = manager.SignIn(Request{Username: "alice", Password: "password1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", resp.User.Username)
+
+	_, err = manager.SignIn(Request{Username: "alice", Password: "wrong-password"})
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+
+	_, err = manager.SignIn(Request{Username: "bob", Password: "password1"})
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+}
+
+func TestSignInLockout(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	manager.SignUp(Request{Username: "carol", Password: "password1"})
+
+	for i := 0; i < freeFailedLogins; i++ {
+		_, err := manager.SignIn(Request{Username: "carol", Password: "wrong-password", IP: "10.0.0.1"})
+		assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+	}
+
+	// Even the right password is refused while the account is locked.
+	_, err := manager.SignIn(Request{Username: "carol", Password: "password1", IP: "10.0.0.1"})
+	assert.Equal(t, http.StatusTooManyRequests, err.StatusCode())
+
+	// Unknown usernames are locked the same way.
+	for i := 0; i < freeFailedLogins; i++ {
+		manager.SignIn(Request{Username: "nobody", Password: "password1", IP: "10.0.0.2"})
+	}
+	_, err = manager.SignIn(Request{Username: "nobody", Password: "password1", IP: "10.0.0.2"})
+	assert.Equal(t, http.StatusTooManyRequests, err.StatusCode())
+}
+
+func TestSignInIPLimit(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	manager.SignUp(Request{Username: "dave", Password: "password1"})
+
+	for i := 0; i < maxIPFailures; i++ {
+		manager.SignIn(Request{Username: fmt.Sprintf("spray%d", i), Password: "password1", IP: "10.0.0.3"})
+	}
+
+	_, err := manager.SignIn(Request{Username: "dave", Password: "password1", IP: "10.0.0.3"})
+	assert.Equal(t, http.StatusTooManyRequests, err.StatusCode())
+
+	_, err = manager.SignIn(Request{Username: "dave", Password: "password1", IP: "10.0.0.4"})
+	assert.Nil(t, err)
+}
+
+func TestLockoutDuration(t *testing.T) {
+	assert.Equal(t, time.Duration(0), lockoutDuration(freeFailedLogins-1))
+	assert.Equal(t, time.Second, lockoutDuration(freeFailedLogins))
+	assert.Equal(t, 4*time.Second, lockoutDuration(freeFailedLogins+2))
+	assert.Equal(t, maxLockout, lockoutDuration(100))
+}
+
+func TestLoginHistoryAndNewClients(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	signUp, _ := manager.SignUp(Request{Username: "erin", Password: "password1"})
+
+	resp, err := manager.SignIn(Request{Username: "erin", Password: "password1", IP: "10.0.0.5", UserAgent: "laptop"})
+	assert.Nil(t, err)
+	assert.False(t, resp.NewClient)
+
+	resp, _ = manager.SignIn(Request{Username: "erin", Password: "password1", IP: "10.0.0.5", UserAgent: "laptop"})
+	assert.False(t, resp.NewClient)
+
+	resp, _ = manager.SignIn(Request{Username: "erin", Password: "password1", IP: "10.9.9.9", UserAgent: "phone"})
+	assert.True(t, resp.NewClient)
+
+	manager.SignIn(Request{Username: "erin", Password: "wrong-password", IP: "10.9.9.9", UserAgent: "phone"})
+
+	history, err := manager.GetLoginHistory(LoginHistoryRequest{UserID: signUp.User.ID, Limit: 10})
+	assert.Nil(t, err)
+	assert.Len(t, history.Logins, 4)
+	assert.False(t, history.Logins[0].Success)
+	assert.True(t, history.Logins[1].NewClient)
+	assert.Equal(t, "phone", history.Logins[1].UserAgent)
+}
+
+func TestTwoFactorSignIn(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	signUp, _ := manager.SignUp(Request{Username: "frank", Password: "password1"})
+	userID := signUp.User.ID
+
+	_, err := manager.ConfirmTwoFactor(TwoFactorRequest{UserID: userID, Code: "123456"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	enroll, err := manager.EnrollTwoFactor(EnrollTwoFactorRequest{UserID: userID})
+	assert.Nil(t, err)
+	assert.Contains(t, enroll.OTPAuthURI, "otpauth://totp/DCUBE:frank?")
+	assert.Contains(t, enroll.OTPAuthURI, "secret="+enroll.Secret)
+
+	// Enrollment alone does not change how the user signs in.
+	resp, err := manager.SignIn(Request{Username: "frank", Password: "password1"})
+	assert.Nil(t, err)
+	assert.False(t, resp.MFARequired)
+
+	key, _ := totpEncoding.DecodeString(enroll.Secret)
+	code := totpCode(key, time.Now().Unix()/30)
+	codes, err := manager.ConfirmTwoFactor(TwoFactorRequest{UserID: userID, Code: code})
+	assert.Nil(t, err)
+	assert.Len(t, codes.RecoveryCodes, recoveryCodeCount)
+
+	resp, err = manager.SignIn(Request{Username: "frank", Password: "password1"})
+	assert.Nil(t, err)
+	assert.True(t, resp.MFARequired)
+
+	// The code used to confirm enrollment cannot be replayed.
+	_, err = manager.VerifySecondFactor(SecondFactorRequest{UserID: userID, Code: code})
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+
+	// An account disabled after its password was checked cannot finish.
+	disabled := true
+	_, err = manager.UpdateAccount(AdminUpdateRequest{ID: userID, Disabled: &disabled})
+	assert.Nil(t, err)
+	_, err = manager.VerifySecondFactor(SecondFactorRequest{UserID: userID, Code: codes.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	disabled = false
+	manager.UpdateAccount(AdminUpdateRequest{ID: userID, Disabled: &disabled})
+
+	resp, err = manager.VerifySecondFactor(SecondFactorRequest{UserID: userID, Code: codes.RecoveryCodes[0]})
+	assert.Nil(t, err)
+	assert.Equal(t, "frank", resp.User.Username)
+
+	_, err = manager.VerifySecondFactor(SecondFactorRequest{UserID: userID, Code: codes.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+
+	err = manager.DisableTwoFactor(TwoFactorRequest{UserID: userID, Code: codes.RecoveryCodes[1]})
+	assert.Nil(t, err)
+
+	resp, err = manager.SignIn(Request{Username: "frank", Password: "password1"})
+	assert.Nil(t, err)
+	assert.False(t, resp.MFARequired)
+}
+
+type recordingNotifier struct {
+	tokens map[string]string
+}
+
+func (n *recordingNotifier) SendPasswordReset(user User, token string, expiresAt time.Time) error {
+	n.tokens[user.Username] = token
+	return nil
+}
+
+func newTestManager(notifier Notifier) UserManager {
+	policy, _ := NewPasswordPolicy(DefaultMinPasswordLength, "")
+	return NewUserManager(NewMemoryRepository(), policy, notifier, "DCUBE")
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(path, []byte("123456789\nletmein123\n"), 0o600)
+
+	policy, err := NewPasswordPolicy(10, path)
+	assert.Nil(t, err)
+
+	assert.Contains(t, policy.Check("grace", "short"), "at least 10")
+	assert.Contains(t, policy.Check("grace", "letmein123"), "breached")
+	assert.Contains(t, policy.Check("grace", "Grace-2024!"), "similar")
+	assert.Contains(t, policy.Check("gracehopper", "gracehoppr1"), "similar")
+	assert.Equal(t, "", policy.Check("grace", "correct horse battery"))
+
+	_, err = NewPasswordPolicy(10, filepath.Join(t.TempDir(), "missing.txt"))
+	assert.NotNil(t, err)
+}
+
+func TestChangePassword(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	signUp, _ := manager.SignUp(Request{Username: "heidi", Password: "password1"})
+	userID := signUp.User.ID
+
+	err := manager.ChangePassword(ChangePasswordRequest{
+		UserID: userID, CurrentPassword: "wrong-password", NewPassword: "new password 1",
+	})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	err = manager.ChangePassword(ChangePasswordRequest{
+		UserID: userID, CurrentPassword: "password1", NewPassword: "heidi123",
+	})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	err = manager.ChangePassword(ChangePasswordRequest{
+		UserID: userID, CurrentPassword: "password1", NewPassword: "new password 1",
+	})
+	assert.Nil(t, err)
+
+	_, err = manager.SignIn(Request{Username: "heidi", Password: "password1"})
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode())
+
+	_, err = manager.SignIn(Request{Username: "heidi", Password: "new password 1"})
+	assert.Nil(t, err)
+}
+
+func TestResetPassword(t *testing.T) {
+	notifier := &recordingNotifier{tokens: make(map[string]string)}
+	manager := newTestManager(notifier)
+	manager.SignUp(Request{Username: "ivan", Password: "password1"})
+
+	// Unknown usernames look the same to the caller.
+	assert.Nil(t, manager.RequestPasswordReset(PasswordResetRequest{Username: "nobody"}))
+	assert.Empty(t, notifier.tokens)
+
+	assert.Nil(t, manager.RequestPasswordReset(PasswordResetRequest{Username: "ivan"}))
+	first := notifier.tokens["ivan"]
+	assert.Nil(t, manager.RequestPasswordReset(PasswordResetRequest{Username: "ivan"}))
+	second := notifier.tokens["ivan"]
+
+	_, err := manager.ResetPassword(ResetPasswordRequest{Token: "not-a-token", NewPassword: "new password 1"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	resp, err := manager.ResetPassword(ResetPasswordRequest{Token: second, NewPassword: "new password 1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ivan", resp.User.Username)
+
+	// Used tokens and other outstanding tokens no longer work.
+	_, err = manager.ResetPassword(ResetPasswordRequest{Token: second, NewPassword: "new password 2"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+	_, err = manager.ResetPassword(ResetPasswordRequest{Token: first, NewPassword: "new password 2"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	_, err = manager.SignIn(Request{Username: "ivan", Password: "new password 1"})
+	assert.Nil(t, err)
+}
+
+func TestProfileAndDeleteAccount(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	signUp, _ := manager.SignUp(Request{Username: "judy", Password: "password1"})
+	userID := signUp.User.ID
+
+	displayName, email, days := "Judy", " Judy@Example.com ", uint(30)
+	resp, err := manager.UpdateProfile(UpdateProfileRequest{
+		UserID: userID, DisplayName: &displayName, Email: &email, DefaultExpiryDays: &days,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "judy@example.com", resp.User.Email)
+
+	resp, err = manager.GetProfile(ProfileRequest{UserID: userID})
+	assert.Nil(t, err)
+	assert.Equal(t, "Judy", resp.User.DisplayName)
+	assert.Equal(t, uint(30), resp.User.DefaultExpiryDays)
+
+	manager.SignIn(Request{Username: "judy", Password: "password1"})
+	export, err := manager.ExportAccount(ExportRequest{UserID: userID})
+	assert.Nil(t, err)
+	assert.Len(t, export.Logins, 1)
+
+	err = manager.ConfirmPassword(ConfirmPasswordRequest{UserID: userID, Password: "wrong-password"})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+	assert.Nil(t, manager.ConfirmPassword(ConfirmPasswordRequest{UserID: userID, Password: "password1"}))
+
+	assert.Nil(t, manager.DeleteAccount(DeleteAccountRequest{UserID: userID}))
+
+	_, err = manager.GetProfile(ProfileRequest{UserID: userID})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+
+	// The username is free again.
+	_, err = manager.SignUp(Request{Username: "judy", Password: "password1"})
+	assert.Nil(t, err)
+}
+
+func TestStartDeletion(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	signUp, _ := manager.SignUp(Request{Username: "kate", Password: "password1"})
+	userID := signUp.User.ID
+
+	assert.Nil(t, manager.StartDeletion(DeleteAccountRequest{UserID: userID}))
+	assert.Nil(t, manager.StartDeletion(DeleteAccountRequest{UserID: userID}))
+
+	_, err := manager.SignIn(Request{Username: "kate", Password: "password1"})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	earlier := PendingDeletionsRequest{StartedBefore: time.Now().Add(-time.Minute), Limit: 10}
+	later := PendingDeletionsRequest{StartedBefore: time.Now().Add(time.Minute), Limit: 10}
+
+	pending, err := manager.PendingDeletions(earlier)
+	assert.Nil(t, err)
+	assert.Empty(t, pending.UserIDs)
+
+	pending, err = manager.PendingDeletions(later)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{userID}, pending.UserIDs)
+
+	assert.Nil(t, manager.DeleteAccount(DeleteAccountRequest{UserID: userID}))
+
+	pending, _ = manager.PendingDeletions(later)
+	assert.Empty(t, pending.UserIDs)
+}
+
+func TestAdminAccounts(t *testing.T) {
+	manager := newTestManager(LogNotifier{})
+	admin, _ := manager.SignUp(Request{Username: "root", Password: "password1"})
+	member, _ := manager.SignUp(Request{Username: "mallory", Password: "password1"})
+	adminID, memberID := admin.User.ID, member.User.ID
+
+	assert.Equal(t, http.StatusForbidden, manager.RequireAdmin(adminID).StatusCode())
+
+	err := manager.BootstrapAdmin("missing")
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+	assert.Nil(t, manager.BootstrapAdmin(" root"))
+	assert.Nil(t, manager.RequireAdmin(adminID))
+
+	// The bootstrap only works once.
+	err = manager.BootstrapAdmin("mallory")
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	found, err := manager.SearchUsers(SearchRequest{Query: "MALL", Limit: 10})
+	assert.Nil(t, err)
+	assert.Len(t, found.Users, 1)
+	assert.Equal(t, memberID, found.Users[0].ID)
+
+	disabled := true
+	demoted := RoleUser
+	_, err = manager.UpdateAccount(AdminUpdateRequest{AdminID: adminID, ID: adminID, Role: &demoted})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	updated, err := manager.UpdateAccount(AdminUpdateRequest{AdminID: adminID, ID: memberID, Disabled: &disabled})
+	assert.Nil(t, err)
+	assert.NotNil(t, updated.User.DisabledAt)
+
+	_, err = manager.SignIn(Request{Username: "mallory", Password: "password1"})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+
+	stats, err := manager.GetStats()
+	assert.Nil(t, err)
+	assert.Equal(t, Stats{Users: 2, Admins: 1, Disabled: 1}, *stats)
+
+	disabled = false
+	_, err = manager.UpdateAccount(AdminUpdateRequest{AdminID: adminID, ID: memberID, Disabled: &disabled})
+	assert.Nil(t, err)
+
+	_, err = manager.SignIn(Request{Username: "mallory", Password: "password1"})
+	assert.Nil(t, err)
+}
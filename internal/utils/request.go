@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetClientIP returns the address of the client that made the request.
+//
+// X-Forwarded-For is only honoured when TRUSTED_PROXY_HOPS is set to the
+// number of proxies in front of the API (TRUST_PROXY_HEADERS=true counts as
+// one). Each proxy appends the address it received the request from, so the
+// client is the entry that many places from the right. Entries further left
+// were sent by the client and are ignored, since it can put anything there.
+func GetClientIP(r *http.Request) string {
+	remote := remoteIP(r)
+	hops := trustedProxyHops()
+
+	if hops == 0 {
+		return remote
+	}
+
+	var forwarded []string
+
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(entry))
+		}
+	}
+
+	// A request with fewer entries than there are proxies did not come through
+	// all of them, so none of its entries can be trusted.
+	if len(forwarded) < hops {
+		return remote
+	}
+
+	client := forwarded[len(forwarded)-hops]
+
+	if net.ParseIP(client) == nil {
+		return remote
+	}
+
+	return client
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func trustedProxyHops() int {
+	if hops, err := strconv.Atoi(os.Getenv("TRUSTED_PROXY_HOPS")); err == nil && hops > 0 {
+		return hops
+	}
+
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		hops      string
+		forwarded []string
+		want      string
+	}{
+		{"headers ignored without trusted proxies", "", []string{"198.51.100.1"}, "10.0.0.9"},
+		{"single proxy", "1", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"forged left-most entry", "1", []string{"192.0.2.66, 198.51.100.1"}, "198.51.100.1"},
+		{"two proxies", "2", []string{"192.0.2.66, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"repeated headers", "2", []string{"192.0.2.66, 198.51.100.1", "10.0.0.2"}, "198.51.100.1"},
+		{"fewer entries than proxies", "2", []string{"192.0.2.66"}, "10.0.0.9"},
+		{"not an address", "1", []string{"unknown"}, "10.0.0.9"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXY_HOPS", test.hops)
+			t.Setenv("TRUST_PROXY_HEADERS", "")
+
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.9:4321"
+			for _, value := range test.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			assert.Equal(t, test.want, GetClientIP(req))
+		})
+	}
+}
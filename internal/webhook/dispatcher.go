@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"log"
+	"time"
+)
+
+// RunDispatcher sends due deliveries every interval, and right away when new
+// ones are queued by this process. It blocks until stop is closed.
+func RunDispatcher(manager WebhookManager, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-manager.Queued():
+		}
+
+		resp, err := manager.Dispatch()
+		if err != nil {
+			log.Printf("webhook dispatcher: %s", err.Message())
+			continue
+		}
+		if resp.Dead > 0 {
+			log.Printf("webhook dispatcher: %d deliveries moved to the dead-letter list", resp.Dead)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
+)
+
+// LinkEvents publishes the URL shortener's link events to the link owner's
+// webhooks. It only queues deliveries; they are sent by the dispatcher.
+type LinkEvents struct {
+	manager WebhookManager
+}
+
+func NewLinkEvents(manager WebhookManager) *LinkEvents {
+	return &LinkEvents{manager: manager}
+}
+
+// LinkData is the data of link events.
+type LinkData struct {
+	ShortenedURL urlshortener.ShortenedURL `json:"shortened_url"`
+	Clicks       uint                      `json:"clicks,omitempty"`
+}
+
+func (e *LinkEvents) LinkCreated(shortenedURL urlshortener.ShortenedURL) {
+	e.publish(EventLinkCreated, shortenedURL, 0)
+}
+
+func (e *LinkEvents) LinkDeleted(shortenedURL urlshortener.ShortenedURL) {
+	e.publish(EventLinkDeleted, shortenedURL, 0)
+}
+
+func (e *LinkEvents) LinkExpired(shortenedURL urlshortener.ShortenedURL) {
+	e.publish(EventLinkExpired, shortenedURL, 0)
+}
+
+func (e *LinkEvents) LinkClicked(shortenedURL urlshortener.ShortenedURL, clicks uint) {
+	e.publish(EventLinkClicked, shortenedURL, clicks)
+}
+
+// publish ignores errors, which the manager has logged: the change to the
+// link has been made either way.
+func (e *LinkEvents) publish(event string, shortenedURL urlshortener.ShortenedURL, clicks uint) {
+	e.manager.Publish(PublishRequest{
+		UserID: shortenedURL.UserID,
+		Event:  event,
+		Clicks: clicks,
+		Data:   LinkData{ShortenedURL: shortenedURL, Clicks: clicks},
+	})
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormRepository struct {
+	database *gorm.DB
+}
+
+func NewGormRepository(database *gorm.DB) Repository {
+	return &GormRepository{
+		database: database,
+	}
+}
+
+func (r *GormRepository) CreateSubscription(subscription *Subscription) error {
+	return r.database.Create(subscription).Error
+}
+
+func (r *GormRepository) FindSubscription(id uint) (*Subscription, error) {
+	var subscription Subscription
+	err := r.database.First(&subscription, id).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+func (r *GormRepository) ListSubscriptions(userID uint) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := r.database.Where("user_id = ?", userID).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *GormRepository) DeleteSubscription(id uint) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", id).Delete(&Delivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Subscription{}, id).Error
+	})
+}
+
+func (r *GormRepository) DeleteSubscriptions(userID uint) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&Delivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&Subscription{}).Error
+	})
+}
+
+func (r *GormRepository) CreateDeliveries(deliveries []Delivery) error {
+	return r.database.Create(&deliveries).Error
+}
+
+func (r *GormRepository) FindDelivery(id uint) (*Delivery, error) {
+	var delivery Delivery
+	err := r.database.First(&delivery, id).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (r *GormRepository) ListDeliveries(filter DeliveryFilter) ([]Delivery, error) {
+	var deliveries []Delivery
+	query := r.database.Where("user_id = ?", filter.UserID)
+
+	if filter.SubscriptionID != 0 {
+		query = query.Where("subscription_id = ?", filter.SubscriptionID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	err := query.Order("id DESC").Limit(filter.Limit).Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+func (r *GormRepository) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := r.database.
+		Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *GormRepository) ClaimDelivery(id uint, now time.Time, until time.Time) (bool, error) {
+	result := r.database.Model(&Delivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, StatusPending, now).
+		UpdateColumn("next_attempt_at", until)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateDelivery does not recreate deliveries deleted in the meantime, which
+// Save would.
+func (r *GormRepository) UpdateDelivery(delivery *Delivery) error {
+	return r.database.Model(delivery).Select("*").Updates(delivery).Error
+}
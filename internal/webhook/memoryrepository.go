@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps webhooks in process memory. It is meant for tests
+// and local development, not for production use.
+type MemoryRepository struct {
+	mu             sync.RWMutex
+	subscriptions  map[uint]Subscription
+	deliveries     map[uint]Delivery
+	subscriptionID uint
+	deliveryID     uint
+}
+
+func NewMemoryRepository() Repository {
+	return &MemoryRepository{
+		subscriptions: map[uint]Subscription{},
+		deliveries:    map[uint]Delivery{},
+	}
+}
+
+func (r *MemoryRepository) CreateSubscription(subscription *Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscriptionID++
+	subscription.ID = r.subscriptionID
+	subscription.CreatedAt = time.Now()
+	r.subscriptions[subscription.ID] = *subscription
+
+	return nil
+}
+
+func (r *MemoryRepository) FindSubscription(id uint) (*Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subscription, ok := r.subscriptions[id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &subscription, nil
+}
+
+func (r *MemoryRepository) ListSubscriptions(userID uint) ([]Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var subscriptions []Subscription
+	for _, subscription := range r.subscriptions {
+		if subscription.UserID == userID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].ID < subscriptions[j].ID })
+
+	return subscriptions, nil
+}
+
+func (r *MemoryRepository) DeleteSubscription(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.subscriptions, id)
+	for deliveryID, delivery := range r.deliveries {
+		if delivery.SubscriptionID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteSubscriptions(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, subscription := range r.subscriptions {
+		if subscription.UserID == userID {
+			delete(r.subscriptions, id)
+		}
+	}
+	for id, delivery := range r.deliveries {
+		if delivery.UserID == userID {
+			delete(r.deliveries, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) CreateDeliveries(deliveries []Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range deliveries {
+		r.deliveryID++
+		deliveries[i].ID = r.deliveryID
+		r.deliveries[deliveries[i].ID] = deliveries[i]
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) FindDelivery(id uint) (*Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	delivery, ok := r.deliveries[id]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &delivery, nil
+}
+
+func (r *MemoryRepository) ListDeliveries(filter DeliveryFilter) ([]Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []Delivery
+	for _, delivery := range r.deliveries {
+		if delivery.UserID != filter.UserID ||
+			(filter.SubscriptionID != 0 && delivery.SubscriptionID != filter.SubscriptionID) ||
+			(filter.Status != "" && delivery.Status != filter.Status) ||
+			(filter.BeforeID != 0 && delivery.ID >= filter.BeforeID) {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+
+	if len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) DueDeliveries(now time.Time, limit int) ([]Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []Delivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status == StatusPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptAt.Equal(deliveries[j].NextAttemptAt) {
+			return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) ClaimDelivery(id uint, now time.Time, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery, ok := r.deliveries[id]
+
+	if !ok || delivery.Status != StatusPending || delivery.NextAttemptAt.After(now) {
+		return false, nil
+	}
+
+	delivery.NextAttemptAt = until
+	r.deliveries[id] = delivery
+
+	return true, nil
+}
+
+func (r *MemoryRepository) UpdateDelivery(delivery *Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.deliveries[delivery.ID]; ok {
+		r.deliveries[delivery.ID] = *delivery
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("webhook not found")
+
+// DeliveryFilter selects a page of a user's deliveries, newest first.
+type DeliveryFilter struct {
+	UserID         uint
+	SubscriptionID uint
+	Status         string
+	BeforeID       uint
+	Limit          int
+}
+
+// Repository abstracts webhook storage so that WebhookManagerImpl does not
+// depend on a particular database.
+type Repository interface {
+	CreateSubscription(subscription *Subscription) error
+	FindSubscription(id uint) (*Subscription, error)
+	// ListSubscriptions returns the user's subscriptions, oldest first.
+	ListSubscriptions(userID uint) ([]Subscription, error)
+	// DeleteSubscription removes a subscription together with its
+	// deliveries.
+	DeleteSubscription(id uint) error
+	DeleteSubscriptions(userID uint) error
+	CreateDeliveries(deliveries []Delivery) error
+	FindDelivery(id uint) (*Delivery, error)
+	ListDeliveries(filter DeliveryFilter) ([]Delivery, error)
+	// DueDeliveries returns up to limit pending deliveries whose next attempt
+	// is due at now, oldest first.
+	DueDeliveries(now time.Time, limit int) ([]Delivery, error)
+	// ClaimDelivery pushes the next attempt of a due delivery back to until,
+	// so that no other dispatcher sends it in the meantime. It returns false
+	// if the delivery is no longer pending or was claimed by someone else.
+	ClaimDelivery(id uint, now time.Time, until time.Time) (bool, error)
+	UpdateDelivery(delivery *Delivery) error
+}
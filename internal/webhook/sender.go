@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-DCUBE-Event"
+	HeaderDelivery  = "X-DCUBE-Delivery"
+	HeaderSignature = "X-DCUBE-Signature"
+)
+
+// maxResponseBytes is how much of a receiver's response is read before the
+// connection is given up on.
+const maxResponseBytes = 4 << 10
+
+var errPrivateAddress = errors.New("receiver resolves to a private address")
+
+// nonPublicNetworks are the ranges net.IP has no predicate for: carrier-grade
+// NAT, and the NAT64 prefix, which maps onto every IPv4 address including
+// private ones.
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return network
+}
+
+// Sender posts deliveries to receivers.
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender returns a sender that waits up to timeout for each receiver.
+// Unless allowPrivate is set it refuses to connect to loopback, private,
+// link-local, carrier-grade NAT and NAT64 addresses, so that webhooks cannot
+// be aimed at internal services. Redirects are not followed.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return errPrivateAddress
+			}
+
+			return nil
+		}
+	}
+
+	return &Sender{
+		client: &http.Client{
+			Timeout: timeout,
+			// No proxy, so that the dialer sees the receiver's address.
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Sign returns the signature of a body sent at timestamp, the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription's secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts body to the subscription's URL. The signature header has the
+// form "t=<unix timestamp>,v1=<signature>" so that receivers can reject old
+// deliveries as well as forged ones. It returns the response status, and an
+// error unless the receiver answered with a 2xx status.
+func (s *Sender) Send(subscription *Subscription, delivery *Delivery, body []byte, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DCUBE-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderSignature, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(subscription.Secret, timestamp, body)))
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events a subscription can ask for.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkDeleted = "link.deleted"
+	EventLinkExpired = "link.expired"
+	// EventLinkClicked is only sent when a link's click count reaches one of
+	// the subscription's click thresholds.
+	EventLinkClicked = "link.clicked"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	// StatusDead marks deliveries that failed on every attempt. They make up
+	// the dead-letter list until they are redelivered.
+	StatusDead = "dead"
+)
+
+// Subscription asks for the events of its owner's links to be posted to URL.
+// Each delivery is signed with the secret, which is shown once, when the
+// subscription is created.
+type Subscription struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"-" gorm:"index;not null"`
+	URL    string `json:"url" gorm:"not null"`
+	Secret string `json:"-" gorm:"not null"`
+	Events Events `json:"events" gorm:"type:text;not null;default:''"`
+	// ClickThresholds are the click counts at which link.clicked is sent.
+	ClickThresholds Thresholds `json:"clickThresholds" gorm:"type:text;not null;default:''"`
+	CreatedAt       time.Time  `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+}
+
+// Delivery is one event on its way to a subscription. Pending deliveries form
+// the queue, ordered by NextAttemptAt; together with the finished ones they
+// make up the delivery log.
+type Delivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	SubscriptionID uint       `json:"subscriptionId" gorm:"index;not null"`
+	UserID         uint       `json:"-" gorm:"index;not null"`
+	Event          string     `json:"event" gorm:"not null"`
+	Payload        Payload    `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"index:idx_delivery_queue;not null"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt" gorm:"index:idx_delivery_queue;not null"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt,omitempty"`
+	// ResponseStatus is the HTTP status of the last attempt, or zero if the
+	// receiver could not be reached.
+	ResponseStatus int       `json:"responseStatus,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"not null"`
+}
+
+// Events is stored as a single space separated column.
+type Events []string
+
+func (e Events) Value() (driver.Value, error) {
+	return strings.Join(e, " "), nil
+}
+
+func (e *Events) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*e = Events{}
+	case string:
+		*e = strings.Fields(v)
+	case []byte:
+		*e = strings.Fields(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Events", value)
+	}
+
+	return nil
+}
+
+func (e Events) Contains(event string) bool {
+	for _, existing := range e {
+		if existing == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Thresholds is stored as a single space separated column.
+type Thresholds []uint
+
+func (t Thresholds) Value() (driver.Value, error) {
+	fields := make([]string, len(t))
+	for i, threshold := range t {
+		fields[i] = strconv.FormatUint(uint64(threshold), 10)
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+func (t *Thresholds) Scan(value interface{}) error {
+	var fields []string
+
+	switch v := value.(type) {
+	case nil:
+	case string:
+		fields = strings.Fields(v)
+	case []byte:
+		fields = strings.Fields(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Thresholds", value)
+	}
+
+	*t = make(Thresholds, len(fields))
+	for i, field := range fields {
+		threshold, err := strconv.ParseUint(field, 10, 0)
+		if err != nil {
+			return fmt.Errorf("cannot scan %q into Thresholds", field)
+		}
+		(*t)[i] = uint(threshold)
+	}
+
+	return nil
+}
+
+func (t Thresholds) Contains(clicks uint) bool {
+	for _, threshold := range t {
+		if threshold == clicks {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON encoding of an event's data.
+type Payload string
+
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if p == "" {
+		return []byte("null"), nil
+	}
+
+	return []byte(p), nil
+}
+
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*p = ""
+	} else {
+		*p = Payload(data)
+	}
+
+	return nil
+}
+
+// Envelope is the body posted to receivers. ID is the delivery's ID and stays
+// the same across retries, so receivers can drop duplicates.
+type Envelope struct {
+	ID        uint      `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      Payload   `json:"data"`
+}
+
+type CreateRequest struct {
+	UserID          uint     `json:"-"`
+	URL             string   `json:"url" validate:"required,url,max=2048"`
+	Events          []string `json:"events" validate:"required,min=1,dive,oneof=link.created link.deleted link.expired link.clicked"` //nolint:lll
+	ClickThresholds []uint   `json:"click_thresholds" validate:"max=20,dive,min=1"`
+}
+
+type CreateResponse struct {
+	Subscription Subscription `json:"subscription"`
+	// Secret signs the deliveries. It is not shown again.
+	Secret string `json:"secret"`
+}
+
+type ListRequest struct {
+	UserID uint
+}
+
+type ListResponse struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+type DeleteRequest struct {
+	UserID uint
+	ID     uint
+}
+
+type DeleteResponse struct {
+	Subscription Subscription `json:"subscription"`
+}
+
+type DeleteAllRequest struct {
+	UserID uint
+}
+
+// DeliveriesRequest pages through a user's deliveries newest first. With
+// SubscriptionID set, only that subscription's deliveries are returned.
+type DeliveriesRequest struct {
+	UserID         uint
+	SubscriptionID uint
+	Status         string `validate:"omitempty,oneof=pending delivered dead"`
+	BeforeID       uint
+	Limit          int
+}
+
+type DeliveriesResponse struct {
+	Deliveries []Delivery `json:"deliveries"`
+	// NextBefore is passed as BeforeID to fetch the next page. It is zero on
+	// the last page.
+	NextBefore uint `json:"next_before,omitempty"`
+}
+
+type RedeliverRequest struct {
+	UserID uint
+	ID     uint
+}
+
+type RedeliverResponse struct {
+	Delivery Delivery `json:"delivery"`
+}
+
+// PublishRequest queues an event for the user's subscriptions. Data is
+// encoded as JSON. Clicks is the click count link.clicked is sent for.
+type PublishRequest struct {
+	UserID uint
+	Event  string
+	Clicks uint
+	Data   interface{}
+}
+
+type DispatchResponse struct {
+	Delivered int
+	Retried   int
+	Dead      int
+}
@@ -0,0 +1,547 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+)
+
+// SecretPrefix starts every signing secret so that they can be spotted by
+// secret scanners.
+const SecretPrefix = "whsec_"
+
+const secretBytes = 32
+
+const (
+	// maxSubscriptions bounds how many receivers a single event fans out to.
+	maxSubscriptions = 10
+	defaultListLimit = 50
+	maxListLimit     = 200
+	// dispatchBatchSize bounds how many deliveries Dispatch sends per call.
+	dispatchBatchSize = 100
+	// dispatchWorkers is how many receivers are contacted at the same time.
+	dispatchWorkers = 8
+	maxErrorLength  = 255
+)
+
+// RetryPolicy says how often, and how far apart, a delivery is attempted.
+type RetryPolicy struct {
+	MaxAttempts int
+	// BaseDelay is the wait after the first failed attempt. It doubles with
+	// every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ClaimTimeout is how long a dispatcher holds a delivery while sending
+	// it. It must be longer than the sender's timeout.
+	ClaimTimeout time.Duration
+}
+
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	delay := p.BaseDelay
+
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return delay
+}
+
+type WebhookManager interface {
+	CreateSubscription(CreateRequest) (*CreateResponse, dcubeerrs.Error)
+	GetSubscriptions(ListRequest) (*ListResponse, dcubeerrs.Error)
+	DeleteSubscription(DeleteRequest) (*DeleteResponse, dcubeerrs.Error)
+	DeleteAllSubscriptions(DeleteAllRequest) dcubeerrs.Error
+	GetDeliveries(DeliveriesRequest) (*DeliveriesResponse, dcubeerrs.Error)
+	// Redeliver queues a finished delivery again, usually one from the
+	// dead-letter list, with a fresh set of attempts.
+	Redeliver(RedeliverRequest) (*RedeliverResponse, dcubeerrs.Error)
+	// Publish queues an event for every subscription of the user that asked
+	// for it.
+	Publish(PublishRequest) dcubeerrs.Error
+	// Dispatch sends the deliveries that are due.
+	Dispatch() (*DispatchResponse, dcubeerrs.Error)
+	// Queued is signalled when Publish has queued deliveries.
+	Queued() <-chan struct{}
+}
+
+type WebhookManagerImpl struct {
+	repository Repository
+	sender     *Sender
+	retry      RetryPolicy
+	// subscribers caches the subscriptions of each user so that clicks on
+	// links of users without webhooks stay cheap.
+	subscribers cache.Cache
+	cacheTTL    time.Duration
+	queued      chan struct{}
+	now         func() time.Time
+}
+
+func NewWebhookManager(
+	repository Repository,
+	sender *Sender,
+	retry RetryPolicy,
+	subscribers cache.Cache,
+	cacheTTL time.Duration,
+) WebhookManager {
+	return &WebhookManagerImpl{
+		repository:  repository,
+		sender:      sender,
+		retry:       retry,
+		subscribers: subscribers,
+		cacheTTL:    cacheTTL,
+		queued:      make(chan struct{}, 1),
+		now: func() time.Time {
+			// Postgres keeps microseconds, so times compare equal after a
+			// round trip.
+			return time.Now().UTC().Truncate(time.Microsecond)
+		},
+	}
+}
+
+func (m *WebhookManagerImpl) CreateSubscription(req CreateRequest) (*CreateResponse, dcubeerrs.Error) {
+	target, err := url.Parse(req.URL)
+
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Webhook URL must be an http or https URL")
+	}
+
+	subscription := Subscription{
+		UserID:          req.UserID,
+		URL:             req.URL,
+		Events:          normalizeEvents(req.Events),
+		ClickThresholds: normalizeThresholds(req.ClickThresholds),
+	}
+
+	clicked := subscription.Events.Contains(EventLinkClicked)
+	if clicked && len(subscription.ClickThresholds) == 0 {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "link.clicked needs at least one click threshold")
+	}
+	if !clicked && len(subscription.ClickThresholds) > 0 {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Click thresholds need the link.clicked event")
+	}
+
+	existing, err := m.repository.ListSubscriptions(req.UserID)
+
+	if err != nil {
+		log.Printf("Error listing webhooks: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating webhook")
+	}
+
+	if len(existing) >= maxSubscriptions {
+		return nil, dcubeerrs.New(
+			http.StatusConflict,
+			fmt.Sprintf("A user can have at most %d webhooks", maxSubscriptions),
+		)
+	}
+
+	raw := make([]byte, secretBytes)
+
+	if _, err := rand.Read(raw); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating webhook")
+	}
+
+	subscription.Secret = SecretPrefix + hex.EncodeToString(raw)
+
+	if err := m.repository.CreateSubscription(&subscription); err != nil {
+		log.Printf("Error creating webhook: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating webhook")
+	}
+
+	m.forgetSubscribers(req.UserID)
+
+	return &CreateResponse{Subscription: subscription, Secret: subscription.Secret}, nil
+}
+
+// normalizeEvents drops duplicates while keeping the order given.
+func normalizeEvents(events []string) Events {
+	normalized := Events{}
+
+	for _, event := range events {
+		if !normalized.Contains(event) {
+			normalized = append(normalized, event)
+		}
+	}
+
+	return normalized
+}
+
+// normalizeThresholds sorts the thresholds and drops duplicates.
+func normalizeThresholds(thresholds []uint) Thresholds {
+	normalized := Thresholds{}
+
+	for _, threshold := range thresholds {
+		if !normalized.Contains(threshold) {
+			normalized = append(normalized, threshold)
+		}
+	}
+
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i] < normalized[j] })
+
+	return normalized
+}
+
+func (m *WebhookManagerImpl) GetSubscriptions(req ListRequest) (*ListResponse, dcubeerrs.Error) {
+	subscriptions, err := m.repository.ListSubscriptions(req.UserID)
+
+	if err != nil {
+		log.Printf("Error listing webhooks: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching webhooks")
+	}
+
+	if subscriptions == nil {
+		subscriptions = []Subscription{}
+	}
+
+	return &ListResponse{Subscriptions: subscriptions}, nil
+}
+
+func (m *WebhookManagerImpl) DeleteSubscription(req DeleteRequest) (*DeleteResponse, dcubeerrs.Error) {
+	subscription, derr := m.findSubscription(req.UserID, req.ID)
+
+	if derr != nil {
+		return nil, derr
+	}
+
+	if err := m.repository.DeleteSubscription(subscription.ID); err != nil {
+		log.Printf("Error deleting webhook: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting webhook")
+	}
+
+	m.forgetSubscribers(req.UserID)
+
+	return &DeleteResponse{Subscription: *subscription}, nil
+}
+
+func (m *WebhookManagerImpl) DeleteAllSubscriptions(req DeleteAllRequest) dcubeerrs.Error {
+	if err := m.repository.DeleteSubscriptions(req.UserID); err != nil {
+		log.Printf("Error deleting webhooks: %s", err.Error())
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting webhooks")
+	}
+
+	m.forgetSubscribers(req.UserID)
+
+	return nil
+}
+
+// findSubscription treats other users' subscriptions as missing.
+func (m *WebhookManagerImpl) findSubscription(userID uint, id uint) (*Subscription, dcubeerrs.Error) {
+	subscription, err := m.repository.FindSubscription(id)
+
+	if errors.Is(err, ErrNotFound) || (err == nil && subscription.UserID != userID) {
+		return nil, dcubeerrs.New(http.StatusNotFound, "Webhook does not exist")
+	}
+	if err != nil {
+		log.Printf("Error finding webhook: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching webhook")
+	}
+
+	return subscription, nil
+}
+
+func (m *WebhookManagerImpl) GetDeliveries(req DeliveriesRequest) (*DeliveriesResponse, dcubeerrs.Error) {
+	if req.SubscriptionID != 0 {
+		if _, err := m.findSubscription(req.UserID, req.SubscriptionID); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	} else if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	deliveries, err := m.repository.ListDeliveries(DeliveryFilter{
+		UserID:         req.UserID,
+		SubscriptionID: req.SubscriptionID,
+		Status:         req.Status,
+		BeforeID:       req.BeforeID,
+		Limit:          limit + 1,
+	})
+
+	if err != nil {
+		log.Printf("Error listing webhook deliveries: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching deliveries")
+	}
+
+	res := &DeliveriesResponse{Deliveries: deliveries}
+	if len(deliveries) > limit {
+		res.Deliveries = deliveries[:limit]
+		res.NextBefore = res.Deliveries[limit-1].ID
+	}
+	if res.Deliveries == nil {
+		res.Deliveries = []Delivery{}
+	}
+
+	return res, nil
+}
+
+func (m *WebhookManagerImpl) Redeliver(req RedeliverRequest) (*RedeliverResponse, dcubeerrs.Error) {
+	delivery, err := m.repository.FindDelivery(req.ID)
+
+	if errors.Is(err, ErrNotFound) || (err == nil && delivery.UserID != req.UserID) {
+		return nil, dcubeerrs.New(http.StatusNotFound, "Delivery does not exist")
+	}
+	if err != nil {
+		log.Printf("Error finding webhook delivery: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while redelivering")
+	}
+
+	if delivery.Status == StatusPending {
+		return nil, dcubeerrs.New(http.StatusConflict, "Delivery is already queued")
+	}
+
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = m.now()
+
+	if err := m.repository.UpdateDelivery(delivery); err != nil {
+		log.Printf("Error queueing webhook delivery: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while redelivering")
+	}
+
+	m.signalQueued()
+
+	return &RedeliverResponse{Delivery: *delivery}, nil
+}
+
+// subscriber is the part of a subscription Publish needs, as cached.
+type subscriber struct {
+	ID              uint       `json:"id"`
+	Events          Events     `json:"events"`
+	ClickThresholds Thresholds `json:"click_thresholds"`
+}
+
+func subscribersKey(userID uint) string {
+	return fmt.Sprintf("webhooks:%d", userID)
+}
+
+func (m *WebhookManagerImpl) forgetSubscribers(userID uint) {
+	if err := m.subscribers.Delete(subscribersKey(userID)); err != nil {
+		log.Printf("Error invalidating webhook cache: %s", err.Error())
+	}
+}
+
+func (m *WebhookManagerImpl) findSubscribers(userID uint) ([]subscriber, error) {
+	key := subscribersKey(userID)
+
+	if cached, ok, err := m.subscribers.Get(key); err == nil && ok {
+		var subscribers []subscriber
+		if err := json.Unmarshal(cached, &subscribers); err == nil {
+			return subscribers, nil
+		}
+	}
+
+	subscriptions, err := m.repository.ListSubscriptions(userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	subscribers := make([]subscriber, len(subscriptions))
+	for i, subscription := range subscriptions {
+		subscribers[i] = subscriber{
+			ID:              subscription.ID,
+			Events:          subscription.Events,
+			ClickThresholds: subscription.ClickThresholds,
+		}
+	}
+
+	if encoded, err := json.Marshal(subscribers); err == nil {
+		if err := m.subscribers.Set(key, encoded, m.cacheTTL); err != nil {
+			log.Printf("Error caching webhooks: %s", err.Error())
+		}
+	}
+
+	return subscribers, nil
+}
+
+func (m *WebhookManagerImpl) Publish(req PublishRequest) dcubeerrs.Error {
+	subscribers, err := m.findSubscribers(req.UserID)
+
+	if err != nil {
+		log.Printf("Error listing webhooks: %s", err.Error())
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while publishing webhook event")
+	}
+
+	var deliveries []Delivery
+	now := m.now()
+
+	for _, subscriber := range subscribers {
+		if !subscriber.Events.Contains(req.Event) ||
+			(req.Event == EventLinkClicked && !subscriber.ClickThresholds.Contains(req.Clicks)) {
+			continue
+		}
+
+		deliveries = append(deliveries, Delivery{
+			SubscriptionID: subscriber.ID,
+			UserID:         req.UserID,
+			Event:          req.Event,
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(req.Data)
+
+	if err != nil {
+		log.Printf("Error encoding webhook event: %s", err.Error())
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while publishing webhook event")
+	}
+
+	for i := range deliveries {
+		deliveries[i].Payload = Payload(payload)
+	}
+
+	if err := m.repository.CreateDeliveries(deliveries); err != nil {
+		log.Printf("Error queueing webhook deliveries: %s", err.Error())
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while publishing webhook event")
+	}
+
+	m.signalQueued()
+
+	return nil
+}
+
+func (m *WebhookManagerImpl) Queued() <-chan struct{} {
+	return m.queued
+}
+
+func (m *WebhookManagerImpl) signalQueued() {
+	select {
+	case m.queued <- struct{}{}:
+	default:
+	}
+}
+
+func (m *WebhookManagerImpl) Dispatch() (*DispatchResponse, dcubeerrs.Error) {
+	now := m.now()
+	due, err := m.repository.DueDeliveries(now, dispatchBatchSize)
+
+	if err != nil {
+		log.Printf("Error listing due webhook deliveries: %s", err.Error())
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while dispatching webhooks")
+	}
+
+	res := &DispatchResponse{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, dispatchWorkers)
+
+	for i := range due {
+		// Earlier deliveries may have taken a while to hand to a worker, so the
+		// lease is measured from when this one is claimed.
+		claimedAt := m.now()
+		claimed, err := m.repository.ClaimDelivery(due[i].ID, claimedAt, claimedAt.Add(m.retry.ClaimTimeout))
+
+		if err != nil {
+			log.Printf("Error claiming webhook delivery %d: %s", due[i].ID, err.Error())
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		workers <- struct{}{}
+		wg.Add(1)
+
+		go func(delivery Delivery) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			status := m.attempt(&delivery)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch status {
+			case StatusDelivered:
+				res.Delivered++
+			case StatusDead:
+				res.Dead++
+			default:
+				res.Retried++
+			}
+		}(due[i])
+	}
+
+	wg.Wait()
+
+	return res, nil
+}
+
+// attempt sends a claimed delivery once, records the outcome and returns the
+// delivery's new status.
+func (m *WebhookManagerImpl) attempt(delivery *Delivery) string {
+	subscription, err := m.repository.FindSubscription(delivery.SubscriptionID)
+
+	if err != nil {
+		// The subscription was deleted together with its deliveries, or the
+		// lookup failed and the claim runs out before the next try.
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Error finding webhook: %s", err.Error())
+		}
+		return StatusPending
+	}
+
+	now := m.now()
+	body, err := json.Marshal(Envelope{
+		ID:        delivery.ID,
+		Event:     delivery.Event,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+
+	if err == nil {
+		delivery.ResponseStatus, err = m.sender.Send(subscription, delivery, body, now)
+	}
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.Error = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = StatusDelivered
+	case delivery.Attempts >= m.retry.MaxAttempts:
+		delivery.Status = StatusDead
+	default:
+		delivery.NextAttemptAt = now.Add(m.retry.delay(delivery.Attempts))
+	}
+
+	if err != nil {
+		delivery.Error = err.Error()
+		if len(delivery.Error) > maxErrorLength {
+			delivery.Error = delivery.Error[:maxErrorLength]
+		}
+	}
+
+	if err := m.repository.UpdateDelivery(delivery); err != nil {
+		log.Printf("Error updating webhook delivery %d: %s", delivery.ID, err.Error())
+	}
+
+	return delivery.Status
+}
@@ -0,0 +1,282 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Imranr2/DCUBE_API/internal/cache"
+	"github.com/Imranr2/DCUBE_API/internal/urlshortener"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver records the deliveries posted to it and answers with status.
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newTestManager(t *testing.T) (*WebhookManagerImpl, *receiver, string, *time.Time) {
+	rcv := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(rcv)
+	t.Cleanup(server.Close)
+
+	manager := NewWebhookManager(
+		NewMemoryRepository(),
+		NewSender(time.Second, true),
+		RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, ClaimTimeout: time.Minute},
+		cache.NewLRU(10, time.Minute),
+		time.Minute,
+	).(*WebhookManagerImpl)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	return manager, rcv, server.URL, &now
+}
+
+func TestCreateSubscription(t *testing.T) {
+	manager, _, url, _ := newTestManager(t)
+
+	_, err := manager.CreateSubscription(CreateRequest{
+		UserID: 1,
+		URL:    "ftp://example.com",
+		Events: []string{EventLinkCreated},
+	})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	_, err = manager.CreateSubscription(CreateRequest{UserID: 1, URL: url, Events: []string{EventLinkClicked}})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	_, err = manager.CreateSubscription(CreateRequest{
+		UserID:          1,
+		URL:             url,
+		Events:          []string{EventLinkCreated},
+		ClickThresholds: []uint{10},
+	})
+	assert.Equal(t, http.StatusBadRequest, err.StatusCode())
+
+	res, err := manager.CreateSubscription(CreateRequest{
+		UserID:          1,
+		URL:             url,
+		Events:          []string{EventLinkClicked, EventLinkCreated, EventLinkClicked},
+		ClickThresholds: []uint{100, 10, 100},
+	})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(res.Secret, SecretPrefix))
+	assert.Equal(t, Events{EventLinkClicked, EventLinkCreated}, res.Subscription.Events)
+	assert.Equal(t, Thresholds{10, 100}, res.Subscription.ClickThresholds)
+
+	encoded, _ := json.Marshal(res.Subscription)
+	assert.NotContains(t, string(encoded), res.Secret)
+
+	list, _ := manager.GetSubscriptions(ListRequest{UserID: 2})
+	assert.Empty(t, list.Subscriptions)
+
+	_, err = manager.DeleteSubscription(DeleteRequest{UserID: 2, ID: res.Subscription.ID})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+}
+
+func TestPublishAndDispatch(t *testing.T) {
+	manager, rcv, url, now := newTestManager(t)
+	created, _ := manager.CreateSubscription(CreateRequest{
+		UserID:          1,
+		URL:             url,
+		Events:          []string{EventLinkCreated, EventLinkClicked},
+		ClickThresholds: []uint{2},
+	})
+	events := NewLinkEvents(manager)
+	link := urlshortener.ShortenedURL{ID: 7, UserID: 1, Original: "https://example.com", Shortened: "abc"}
+
+	events.LinkCreated(link)
+	events.LinkDeleted(link)
+	events.LinkClicked(link, 1)
+	events.LinkClicked(link, 2)
+	events.LinkCreated(urlshortener.ShortenedURL{ID: 8, UserID: 2})
+
+	select {
+	case <-manager.Queued():
+	default:
+		t.Fatal("publishing did not signal the dispatcher")
+	}
+
+	res, err := manager.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, &DispatchResponse{Delivered: 2}, res)
+	assert.Equal(t, 2, rcv.count())
+
+	received := map[string]Envelope{}
+	for i, req := range rcv.requests {
+		var envelope Envelope
+		assert.Nil(t, json.Unmarshal(rcv.bodies[i], &envelope))
+		received[req.Header.Get(HeaderEvent)] = envelope
+
+		assert.Equal(t, strconv.FormatUint(uint64(envelope.ID), 10), req.Header.Get(HeaderDelivery))
+		signature := fmt.Sprintf("t=%d,v1=%s", now.Unix(), Sign(created.Secret, now.Unix(), rcv.bodies[i]))
+		assert.Equal(t, signature, req.Header.Get(HeaderSignature))
+	}
+
+	var data LinkData
+	assert.Nil(t, json.Unmarshal([]byte(received[EventLinkClicked].Data), &data))
+	assert.Equal(t, uint(2), data.Clicks)
+	assert.Equal(t, "abc", data.ShortenedURL.Shortened)
+	assert.Contains(t, received, EventLinkCreated)
+
+	res, _ = manager.Dispatch()
+	assert.Equal(t, &DispatchResponse{}, res)
+}
+
+func TestDispatchRetriesAndDeadLetters(t *testing.T) {
+	manager, rcv, url, now := newTestManager(t)
+	created, _ := manager.CreateSubscription(CreateRequest{UserID: 1, URL: url, Events: []string{EventLinkDeleted}})
+	assert.Nil(t, manager.Publish(PublishRequest{UserID: 1, Event: EventLinkDeleted, Data: map[string]int{"id": 1}}))
+
+	rcv.setStatus(http.StatusInternalServerError)
+
+	res, _ := manager.Dispatch()
+	assert.Equal(t, &DispatchResponse{Retried: 1}, res)
+
+	log, _ := manager.GetDeliveries(DeliveriesRequest{UserID: 1, SubscriptionID: created.Subscription.ID})
+	delivery := log.Deliveries[0]
+	assert.Equal(t, StatusPending, delivery.Status)
+	assert.Equal(t, http.StatusInternalServerError, delivery.ResponseStatus)
+	assert.Equal(t, now.Add(time.Minute), delivery.NextAttemptAt)
+
+	// Not due yet.
+	res, _ = manager.Dispatch()
+	assert.Equal(t, &DispatchResponse{}, res)
+
+	*now = now.Add(time.Minute)
+	res, _ = manager.Dispatch()
+	assert.Equal(t, &DispatchResponse{Retried: 1}, res)
+
+	log, _ = manager.GetDeliveries(DeliveriesRequest{UserID: 1})
+	assert.Equal(t, now.Add(2*time.Minute), log.Deliveries[0].NextAttemptAt)
+
+	*now = now.Add(2 * time.Minute)
+	res, _ = manager.Dispatch()
+	assert.Equal(t, &DispatchResponse{Dead: 1}, res)
+	assert.Equal(t, 3, rcv.count())
+
+	dead, _ := manager.GetDeliveries(DeliveriesRequest{UserID: 1, Status: StatusDead})
+	assert.Len(t, dead.Deliveries, 1)
+	assert.Equal(t, 3, dead.Deliveries[0].Attempts)
+	assert.Contains(t, dead.Deliveries[0].Error, "500")
+
+	_, err := manager.Redeliver(RedeliverRequest{UserID: 2, ID: delivery.ID})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+
+	rcv.setStatus(http.StatusNoContent)
+	redelivered, err := manager.Redeliver(RedeliverRequest{UserID: 1, ID: delivery.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPending, redelivered.Delivery.Status)
+
+	_, err = manager.Redeliver(RedeliverRequest{UserID: 1, ID: delivery.ID})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	res, _ = manager.Dispatch()
+	assert.Equal(t, &DispatchResponse{Delivered: 1}, res)
+
+	dead, _ = manager.GetDeliveries(DeliveriesRequest{UserID: 1, Status: StatusDead})
+	assert.Empty(t, dead.Deliveries)
+}
+
+func TestSubscriptionCacheInvalidation(t *testing.T) {
+	manager, rcv, url, _ := newTestManager(t)
+
+	// Caches that user 1 has no webhooks.
+	assert.Nil(t, manager.Publish(PublishRequest{UserID: 1, Event: EventLinkCreated}))
+
+	created, _ := manager.CreateSubscription(CreateRequest{UserID: 1, URL: url, Events: []string{EventLinkCreated}})
+	assert.Nil(t, manager.Publish(PublishRequest{UserID: 1, Event: EventLinkCreated}))
+
+	_, err := manager.DeleteSubscription(DeleteRequest{UserID: 1, ID: created.Subscription.ID})
+	assert.Nil(t, err)
+	assert.Nil(t, manager.Publish(PublishRequest{UserID: 1, Event: EventLinkCreated}))
+
+	res, _ := manager.Dispatch()
+	assert.Equal(t, &DispatchResponse{}, res)
+	assert.Equal(t, 0, rcv.count())
+
+	log, _ := manager.GetDeliveries(DeliveriesRequest{UserID: 1})
+	assert.Empty(t, log.Deliveries)
+}
+
+func TestSenderRefusesPrivateAddresses(t *testing.T) {
+	rcv := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	status, err := NewSender(time.Second, false).Send(
+		&Subscription{URL: server.URL, Secret: "secret"},
+		&Delivery{ID: 1, Event: EventLinkCreated},
+		[]byte("{}"),
+		time.Now(),
+	)
+	assert.Equal(t, 0, status)
+	assert.ErrorIs(t, err, errPrivateAddress)
+	assert.Equal(t, 0, rcv.count())
+}
+
+func TestIsPublic(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":      true,
+		"2606:2800:220:1::":  true,
+		"127.0.0.1":          false,
+		"10.0.0.1":           false,
+		"169.254.169.254":    false,
+		"100.64.0.1":         false,
+		"100.127.255.254":    false,
+		"64:ff9b::a00:1":     false,
+		"::1":                false,
+		"fd00::1":            false,
+		"::ffff:192.168.0.1": false,
+		"100.128.0.1":        true,
+		"64:ff9b:1::a00:1":   true,
+	} {
+		assert.Equal(t, public, isPublic(net.ParseIP(address)), address)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	assert.Equal(t, time.Minute, policy.delay(1))
+	assert.Equal(t, 2*time.Minute, policy.delay(2))
+	assert.Equal(t, 8*time.Minute, policy.delay(4))
+	assert.Equal(t, 10*time.Minute, policy.delay(5))
+	assert.Equal(t, 10*time.Minute, policy.delay(40))
+}
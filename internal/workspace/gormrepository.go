@@ -0,0 +1,98 @@
+package workspace
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type GormRepository struct {
+	database *gorm.DB
+}
+
+func NewGormRepository(database *gorm.DB) Repository {
+	return &GormRepository{
+		database: database,
+	}
+}
+
+func (r *GormRepository) CreateWorkspace(workspace *Workspace, owner *Membership) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(workspace).Error; err != nil {
+			return err
+		}
+
+		owner.WorkspaceID = workspace.ID
+		return tx.Create(owner).Error
+	})
+}
+
+func (r *GormRepository) FindWorkspace(id uint) (*Workspace, error) {
+	var workspace Workspace
+	err := r.database.First(&workspace, id).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+func (r *GormRepository) FindMembership(workspaceID uint, userID uint) (*Membership, error) {
+	var membership Membership
+	err := r.database.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&membership).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMembershipNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func (r *GormRepository) ListMembers(workspaceID uint) ([]Membership, error) {
+	var memberships []Membership
+	err := r.database.Where("workspace_id = ?", workspaceID).Order("id").Find(&memberships).Error
+
+	return memberships, err
+}
+
+func (r *GormRepository) ListMemberships(userID uint) ([]Membership, error) {
+	var memberships []Membership
+	err := r.database.Where("user_id = ?", userID).Order("id").Find(&memberships).Error
+
+	return memberships, err
+}
+
+func (r *GormRepository) CreateMembership(membership *Membership) error {
+	err := r.database.Create(membership).Error
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+func (r *GormRepository) UpdateMembership(membership *Membership) error {
+	return r.database.Save(membership).Error
+}
+
+func (r *GormRepository) DeleteMembership(workspaceID uint, userID uint) error {
+	return r.database.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Delete(&Membership{}).Error
+}
+
+func (r *GormRepository) DeleteWorkspace(id uint) error {
+	return r.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", id).Delete(&Membership{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&Workspace{}, id).Error
+	})
+}
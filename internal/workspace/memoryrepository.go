@@ -0,0 +1,162 @@
+package workspace
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps workspaces in process memory. It is meant for tests
+// and local development, not for production use.
+type MemoryRepository struct {
+	mu          sync.RWMutex
+	workspaces  []Workspace
+	memberships []Membership
+	lastID      uint
+}
+
+func NewMemoryRepository() Repository {
+	return &MemoryRepository{}
+}
+
+func (r *MemoryRepository) CreateWorkspace(workspace *Workspace, owner *Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	workspace.ID = uint(len(r.workspaces) + 1)
+	workspace.CreatedAt = time.Now()
+	r.workspaces = append(r.workspaces, *workspace)
+
+	owner.WorkspaceID = workspace.ID
+	r.addMembership(owner)
+
+	return nil
+}
+
+func (r *MemoryRepository) FindWorkspace(id uint) (*Workspace, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Deleted workspaces are left as zero values so that IDs stay indexes.
+	if id == 0 || int(id) > len(r.workspaces) || r.workspaces[id-1].ID == 0 {
+		return nil, ErrNotFound
+	}
+
+	workspace := r.workspaces[id-1]
+
+	return &workspace, nil
+}
+
+func (r *MemoryRepository) FindMembership(workspaceID uint, userID uint) (*Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, membership := range r.memberships {
+		if membership.WorkspaceID == workspaceID && membership.UserID == userID {
+			return &membership, nil
+		}
+	}
+
+	return nil, ErrMembershipNotFound
+}
+
+func (r *MemoryRepository) ListMembers(workspaceID uint) ([]Membership, error) {
+	return r.filter(func(membership Membership) bool {
+		return membership.WorkspaceID == workspaceID
+	}), nil
+}
+
+func (r *MemoryRepository) ListMemberships(userID uint) ([]Membership, error) {
+	return r.filter(func(membership Membership) bool {
+		return membership.UserID == userID
+	}), nil
+}
+
+func (r *MemoryRepository) filter(keep func(Membership) bool) []Membership {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	memberships := []Membership{}
+
+	for _, membership := range r.memberships {
+		if keep(membership) {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	return memberships
+}
+
+func (r *MemoryRepository) CreateMembership(membership *Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.memberships {
+		if existing.WorkspaceID == membership.WorkspaceID && existing.UserID == membership.UserID {
+			return ErrDuplicate
+		}
+	}
+
+	r.addMembership(membership)
+
+	return nil
+}
+
+func (r *MemoryRepository) addMembership(membership *Membership) {
+	r.lastID++
+	membership.ID = r.lastID
+	membership.CreatedAt = time.Now()
+	r.memberships = append(r.memberships, *membership)
+}
+
+func (r *MemoryRepository) UpdateMembership(membership *Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.memberships {
+		if existing.ID == membership.ID {
+			r.memberships[i] = *membership
+			return nil
+		}
+	}
+
+	return ErrMembershipNotFound
+}
+
+func (r *MemoryRepository) DeleteMembership(workspaceID uint, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	memberships := []Membership{}
+
+	for _, membership := range r.memberships {
+		if membership.WorkspaceID != workspaceID || membership.UserID != userID {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	r.memberships = memberships
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteWorkspace(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id == 0 || int(id) > len(r.workspaces) {
+		return nil
+	}
+
+	r.workspaces[id-1] = Workspace{}
+	memberships := []Membership{}
+
+	for _, membership := range r.memberships {
+		if membership.WorkspaceID != id {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	r.memberships = memberships
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package workspace
+
+import "errors"
+
+var ErrNotFound = errors.New("workspace not found")
+var ErrMembershipNotFound = errors.New("membership not found")
+var ErrDuplicate = errors.New("membership already exists")
+
+// Repository abstracts workspace storage so that WorkspaceManagerImpl does not
+// depend on a particular database.
+type Repository interface {
+	// CreateWorkspace stores workspace together with its first membership.
+	CreateWorkspace(workspace *Workspace, owner *Membership) error
+	FindWorkspace(id uint) (*Workspace, error)
+	FindMembership(workspaceID uint, userID uint) (*Membership, error)
+	// ListMembers returns the memberships of a workspace, oldest first.
+	ListMembers(workspaceID uint) ([]Membership, error)
+	// ListMemberships returns the memberships of a user, oldest first.
+	ListMemberships(userID uint) ([]Membership, error)
+	// CreateMembership returns ErrDuplicate if the user is already a member.
+	CreateMembership(membership *Membership) error
+	UpdateMembership(membership *Membership) error
+	DeleteMembership(workspaceID uint, userID uint) error
+	// DeleteWorkspace deletes the workspace together with its memberships.
+	DeleteWorkspace(id uint) error
+}
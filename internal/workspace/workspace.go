@@ -0,0 +1,113 @@
+package workspace
+
+import "time"
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// roleRank orders roles so that each one includes the permissions of those
+// ranked below it.
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Workspace groups links that are managed by a team rather than by the user
+// who created them.
+type Workspace struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+}
+
+type Membership struct {
+	ID          uint      `json:"-" gorm:"primaryKey"`
+	WorkspaceID uint      `json:"-" gorm:"uniqueIndex:idx_membership;not null"`
+	UserID      uint      `json:"-" gorm:"uniqueIndex:idx_membership;index;not null"`
+	Role        string    `json:"role" gorm:"not null"`
+	CreatedAt   time.Time `json:"createdAt" gorm:"type:timestamp;default:current_timestamp"`
+}
+
+type CreateRequest struct {
+	UserID uint   `json:"-"`
+	Name   string `json:"name" validate:"required,max=64"`
+}
+
+type ListRequest struct {
+	UserID uint
+}
+
+type MembersRequest struct {
+	UserID      uint
+	WorkspaceID uint
+}
+
+type AddMemberRequest struct {
+	UserID      uint   `json:"-"`
+	WorkspaceID uint   `json:"-"`
+	Username    string `json:"username" validate:"required,max=32"`
+	Role        string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type UpdateMemberRequest struct {
+	UserID      uint   `json:"-"`
+	WorkspaceID uint   `json:"-"`
+	Username    string `json:"-"`
+	Role        string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+// RemoveMemberRequest removes Username from the workspace. Members may always
+// remove themselves; removing others requires the owner role.
+type RemoveMemberRequest struct {
+	UserID      uint
+	WorkspaceID uint
+	Username    string
+}
+
+type LeaveAllRequest struct {
+	UserID uint
+}
+
+type WorkspaceResponse struct {
+	Workspace Workspace `json:"workspace"`
+	Role      string    `json:"role"`
+}
+
+type ListResponse struct {
+	Workspaces []WorkspaceResponse `json:"workspaces"`
+}
+
+type Member struct {
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+type MembersResponse struct {
+	Members []Member `json:"members"`
+}
+
+type MemberResponse struct {
+	Member Member `json:"member"`
+}
+
+// RemoveMemberResponse names the owner who takes over the links the removed
+// member created in the workspace. The caller hands them over in the same
+// transaction as the removal.
+type RemoveMemberResponse struct {
+	RemovedUserID uint
+	Successor     uint
+}
+
+// LeaveAllResponse maps each workspace the user left to the owner who takes
+// over the links they created there. Deleted lists the workspaces that were
+// deleted because the user was their only member. The caller hands over or
+// deletes the links in the same transaction as the removal.
+type LeaveAllResponse struct {
+	Successors map[uint]uint
+	Deleted    []uint
+}
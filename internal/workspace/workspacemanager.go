@@ -0,0 +1,354 @@
+package workspace
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	dcubeerrs "github.com/Imranr2/DCUBE_API/internal/errors"
+	"github.com/Imranr2/DCUBE_API/internal/user"
+)
+
+type WorkspaceManager interface {
+	CreateWorkspace(CreateRequest) (*WorkspaceResponse, dcubeerrs.Error)
+	ListWorkspaces(ListRequest) (*ListResponse, dcubeerrs.Error)
+	GetMembers(MembersRequest) (*MembersResponse, dcubeerrs.Error)
+	AddMember(AddMemberRequest) (*MemberResponse, dcubeerrs.Error)
+	UpdateMember(UpdateMemberRequest) (*MemberResponse, dcubeerrs.Error)
+	RemoveMember(RemoveMemberRequest) (*RemoveMemberResponse, dcubeerrs.Error)
+	LeaveAll(LeaveAllRequest) (*LeaveAllResponse, dcubeerrs.Error)
+	CanView(userID uint, workspaceID uint) (bool, error)
+	CanEdit(userID uint, workspaceID uint) (bool, error)
+}
+
+// Directory looks up the accounts that can be added to a workspace.
+// user.Repository satisfies it.
+type Directory interface {
+	FindByID(id uint) (*user.User, error)
+	FindByUsername(username string) (*user.User, error)
+}
+
+type WorkspaceManagerImpl struct {
+	repository Repository
+	users      Directory
+}
+
+func NewWorkspaceManager(repository Repository, users Directory) WorkspaceManager {
+	return &WorkspaceManagerImpl{
+		repository: repository,
+		users:      users,
+	}
+}
+
+func (m *WorkspaceManagerImpl) CreateWorkspace(req CreateRequest) (*WorkspaceResponse, dcubeerrs.Error) {
+	workspace := Workspace{Name: strings.TrimSpace(req.Name)}
+	owner := Membership{UserID: req.UserID, Role: RoleOwner}
+
+	if workspace.Name == "" {
+		return nil, dcubeerrs.New(http.StatusBadRequest, "Workspace name must not be blank")
+	}
+
+	if err := m.repository.CreateWorkspace(&workspace, &owner); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while creating workspace")
+	}
+
+	return &WorkspaceResponse{Workspace: workspace, Role: owner.Role}, nil
+}
+
+func (m *WorkspaceManagerImpl) ListWorkspaces(req ListRequest) (*ListResponse, dcubeerrs.Error) {
+	memberships, err := m.repository.ListMemberships(req.UserID)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching workspaces")
+	}
+
+	resp := &ListResponse{Workspaces: make([]WorkspaceResponse, 0, len(memberships))}
+
+	for _, membership := range memberships {
+		workspace, err := m.repository.FindWorkspace(membership.WorkspaceID)
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching workspaces")
+		}
+
+		resp.Workspaces = append(resp.Workspaces, WorkspaceResponse{Workspace: *workspace, Role: membership.Role})
+	}
+
+	return resp, nil
+}
+
+func (m *WorkspaceManagerImpl) GetMembers(req MembersRequest) (*MembersResponse, dcubeerrs.Error) {
+	if e := m.requireRole(req.UserID, req.WorkspaceID, RoleViewer); e != nil {
+		return nil, e
+	}
+
+	memberships, err := m.repository.ListMembers(req.WorkspaceID)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching members")
+	}
+
+	resp := &MembersResponse{Members: make([]Member, 0, len(memberships))}
+
+	for _, membership := range memberships {
+		account, err := m.users.FindByID(membership.UserID)
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching members")
+		}
+
+		resp.Members = append(resp.Members, toMember(membership, account))
+	}
+
+	return resp, nil
+}
+
+func (m *WorkspaceManagerImpl) AddMember(req AddMemberRequest) (*MemberResponse, dcubeerrs.Error) {
+	if e := m.requireRole(req.UserID, req.WorkspaceID, RoleOwner); e != nil {
+		return nil, e
+	}
+
+	account, e := m.findUser(req.Username)
+
+	if e != nil {
+		return nil, e
+	}
+
+	membership := Membership{WorkspaceID: req.WorkspaceID, UserID: account.ID, Role: req.Role}
+	err := m.repository.CreateMembership(&membership)
+
+	if err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			return nil, dcubeerrs.New(http.StatusConflict, "User is already a member of this workspace")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while adding member")
+	}
+
+	return &MemberResponse{Member: toMember(membership, account)}, nil
+}
+
+func (m *WorkspaceManagerImpl) UpdateMember(req UpdateMemberRequest) (*MemberResponse, dcubeerrs.Error) {
+	if e := m.requireRole(req.UserID, req.WorkspaceID, RoleOwner); e != nil {
+		return nil, e
+	}
+
+	account, membership, e := m.findMember(req.WorkspaceID, req.Username)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if membership.Role == RoleOwner && req.Role != RoleOwner {
+		if e := m.requireAnotherOwner(req.WorkspaceID); e != nil {
+			return nil, e
+		}
+	}
+
+	membership.Role = req.Role
+
+	if err := m.repository.UpdateMembership(membership); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while updating member")
+	}
+
+	return &MemberResponse{Member: toMember(*membership, account)}, nil
+}
+
+// RemoveMember removes a member from the workspace. The response names the
+// owner who takes over the links the member created there: the owner removing
+// them, or another owner when members remove themselves.
+func (m *WorkspaceManagerImpl) RemoveMember(req RemoveMemberRequest) (*RemoveMemberResponse, dcubeerrs.Error) {
+	if e := m.requireRole(req.UserID, req.WorkspaceID, RoleViewer); e != nil {
+		return nil, e
+	}
+
+	account, membership, e := m.findMember(req.WorkspaceID, req.Username)
+
+	if e != nil {
+		return nil, e
+	}
+
+	successor := req.UserID
+
+	if account.ID == req.UserID {
+		successor, e = m.findSuccessor(req.WorkspaceID, req.UserID)
+	} else if e = m.requireRole(req.UserID, req.WorkspaceID, RoleOwner); e == nil && membership.Role == RoleOwner {
+		e = m.requireAnotherOwner(req.WorkspaceID)
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	if err := m.repository.DeleteMembership(req.WorkspaceID, account.ID); err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while removing member")
+	}
+
+	return &RemoveMemberResponse{RemovedUserID: account.ID, Successor: successor}, nil
+}
+
+// LeaveAll removes the user from every workspace, for account deletion.
+// Workspaces where the user is the only member are deleted. Otherwise it
+// refuses if the user is the last owner, since the other members would be
+// left without anyone to manage the workspace. The response names an owner in
+// each remaining workspace to hand the user's links over to.
+func (m *WorkspaceManagerImpl) LeaveAll(req LeaveAllRequest) (*LeaveAllResponse, dcubeerrs.Error) {
+	memberships, err := m.repository.ListMemberships(req.UserID)
+
+	if err != nil {
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while leaving workspaces")
+	}
+
+	resp := &LeaveAllResponse{Successors: make(map[uint]uint, len(memberships))}
+
+	for _, membership := range memberships {
+		members, err := m.repository.ListMembers(membership.WorkspaceID)
+
+		if err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching members")
+		}
+
+		if len(members) == 1 {
+			resp.Deleted = append(resp.Deleted, membership.WorkspaceID)
+			continue
+		}
+
+		successor, e := m.findSuccessor(membership.WorkspaceID, req.UserID)
+
+		if e != nil {
+			return nil, e
+		}
+
+		resp.Successors[membership.WorkspaceID] = successor
+	}
+
+	for workspaceID := range resp.Successors {
+		if err := m.repository.DeleteMembership(workspaceID, req.UserID); err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while leaving workspaces")
+		}
+	}
+
+	for _, workspaceID := range resp.Deleted {
+		if err := m.repository.DeleteWorkspace(workspaceID); err != nil {
+			return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while deleting workspaces")
+		}
+	}
+
+	return resp, nil
+}
+
+func (m *WorkspaceManagerImpl) CanView(userID uint, workspaceID uint) (bool, error) {
+	return m.hasRole(userID, workspaceID, RoleViewer)
+}
+
+func (m *WorkspaceManagerImpl) CanEdit(userID uint, workspaceID uint) (bool, error) {
+	return m.hasRole(userID, workspaceID, RoleEditor)
+}
+
+func (m *WorkspaceManagerImpl) hasRole(userID uint, workspaceID uint, role string) (bool, error) {
+	membership, err := m.repository.FindMembership(workspaceID, userID)
+
+	if errors.Is(err, ErrMembershipNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return roleRank[membership.Role] >= roleRank[role], nil
+}
+
+// requireRole checks that userID holds at least role in the workspace. Users
+// outside the workspace are told it does not exist.
+func (m *WorkspaceManagerImpl) requireRole(userID uint, workspaceID uint, role string) dcubeerrs.Error {
+	membership, err := m.repository.FindMembership(workspaceID, userID)
+
+	if err != nil {
+		if errors.Is(err, ErrMembershipNotFound) {
+			return dcubeerrs.New(http.StatusNotFound, "Workspace does not exist")
+		}
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching workspace")
+	}
+
+	if roleRank[membership.Role] < roleRank[role] {
+		return dcubeerrs.New(http.StatusForbidden, "This action requires the "+role+" role in the workspace")
+	}
+
+	return nil
+}
+
+func (m *WorkspaceManagerImpl) requireAnotherOwner(workspaceID uint) dcubeerrs.Error {
+	memberships, err := m.repository.ListMembers(workspaceID)
+
+	if err != nil {
+		return dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching members")
+	}
+
+	owners := 0
+	for _, membership := range memberships {
+		if membership.Role == RoleOwner {
+			owners++
+		}
+	}
+
+	if owners < 2 {
+		return dcubeerrs.New(http.StatusConflict, "A workspace must keep at least one owner")
+	}
+
+	return nil
+}
+
+// findSuccessor returns an owner of the workspace other than userID.
+func (m *WorkspaceManagerImpl) findSuccessor(workspaceID uint, userID uint) (uint, dcubeerrs.Error) {
+	memberships, err := m.repository.ListMembers(workspaceID)
+
+	if err != nil {
+		return 0, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching members")
+	}
+
+	for _, membership := range memberships {
+		if membership.Role == RoleOwner && membership.UserID != userID {
+			return membership.UserID, nil
+		}
+	}
+
+	return 0, dcubeerrs.New(http.StatusConflict, "A workspace must keep at least one owner")
+}
+
+func (m *WorkspaceManagerImpl) findUser(username string) (*user.User, dcubeerrs.Error) {
+	account, err := m.users.FindByUsername(username)
+
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			return nil, dcubeerrs.New(http.StatusNotFound, "User does not exist")
+		}
+		return nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching user")
+	}
+
+	return account, nil
+}
+
+func (m *WorkspaceManagerImpl) findMember(
+	workspaceID uint,
+	username string,
+) (*user.User, *Membership, dcubeerrs.Error) {
+	account, e := m.findUser(username)
+
+	if e != nil {
+		return nil, nil, e
+	}
+
+	membership, err := m.repository.FindMembership(workspaceID, account.ID)
+
+	if err != nil {
+		if errors.Is(err, ErrMembershipNotFound) {
+			return nil, nil, dcubeerrs.New(http.StatusNotFound, "User is not a member of this workspace")
+		}
+		return nil, nil, dcubeerrs.New(http.StatusInternalServerError, "An error occurred while fetching member")
+	}
+
+	return account, membership, nil
+}
+
+func toMember(membership Membership, account *user.User) Member {
+	return Member{Username: account.Username, Role: membership.Role, JoinedAt: membership.CreatedAt}
+}
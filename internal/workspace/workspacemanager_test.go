@@ -0,0 +1,102 @@
+package workspace
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Imranr2/DCUBE_API/internal/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestManager(usernames ...string) WorkspaceManager {
+	users := user.NewMemoryRepository()
+
+	for _, username := range usernames {
+		users.Create(&user.User{Username: username})
+	}
+
+	return NewWorkspaceManager(NewMemoryRepository(), users)
+}
+
+func TestWorkspaceRoles(t *testing.T) {
+	manager := newTestManager("alice", "bob", "carol", "dave")
+
+	created, err := manager.CreateWorkspace(CreateRequest{UserID: 1, Name: " Marketing "})
+	assert.Nil(t, err)
+	assert.Equal(t, "Marketing", created.Workspace.Name)
+	assert.Equal(t, RoleOwner, created.Role)
+	id := created.Workspace.ID
+
+	_, err = manager.AddMember(AddMemberRequest{UserID: 1, WorkspaceID: id, Username: "bob", Role: RoleEditor})
+	assert.Nil(t, err)
+	_, err = manager.AddMember(AddMemberRequest{UserID: 1, WorkspaceID: id, Username: "carol", Role: RoleViewer})
+	assert.Nil(t, err)
+
+	_, err = manager.AddMember(AddMemberRequest{UserID: 1, WorkspaceID: id, Username: "bob", Role: RoleViewer})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+	_, err = manager.AddMember(AddMemberRequest{UserID: 2, WorkspaceID: id, Username: "dave", Role: RoleViewer})
+	assert.Equal(t, http.StatusForbidden, err.StatusCode())
+	_, err = manager.GetMembers(MembersRequest{UserID: 4, WorkspaceID: id})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+
+	members, err := manager.GetMembers(MembersRequest{UserID: 3, WorkspaceID: id})
+	assert.Nil(t, err)
+	assert.Len(t, members.Members, 3)
+
+	for userID, expected := range map[uint][2]bool{1: {true, true}, 2: {true, true}, 3: {true, false}, 4: {false, false}} {
+		canView, _ := manager.CanView(userID, id)
+		canEdit, _ := manager.CanEdit(userID, id)
+		assert.Equal(t, expected, [2]bool{canView, canEdit}, "user %d", userID)
+	}
+
+	listed, err := manager.ListWorkspaces(ListRequest{UserID: 2})
+	assert.Nil(t, err)
+	assert.Len(t, listed.Workspaces, 1)
+	assert.Equal(t, RoleEditor, listed.Workspaces[0].Role)
+}
+
+func TestWorkspaceKeepsAnOwner(t *testing.T) {
+	manager := newTestManager("alice", "bob", "carol")
+	created, _ := manager.CreateWorkspace(CreateRequest{UserID: 1, Name: "Sales"})
+	id := created.Workspace.ID
+	manager.AddMember(AddMemberRequest{UserID: 1, WorkspaceID: id, Username: "bob", Role: RoleViewer})
+
+	_, err := manager.UpdateMember(UpdateMemberRequest{UserID: 1, WorkspaceID: id, Username: "alice", Role: RoleEditor})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+	_, err = manager.RemoveMember(RemoveMemberRequest{UserID: 1, WorkspaceID: id, Username: "alice"})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+	_, err = manager.LeaveAll(LeaveAllRequest{UserID: 1})
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+
+	// Members may leave on their own; the owner takes over their links.
+	removed, err := manager.RemoveMember(RemoveMemberRequest{UserID: 2, WorkspaceID: id, Username: "bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, RemoveMemberResponse{RemovedUserID: 2, Successor: 1}, *removed)
+
+	manager.AddMember(AddMemberRequest{UserID: 1, WorkspaceID: id, Username: "carol", Role: RoleOwner})
+
+	left, err := manager.LeaveAll(LeaveAllRequest{UserID: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint]uint{id: 3}, left.Successors)
+
+	canView, _ := manager.CanView(1, id)
+	assert.False(t, canView)
+}
+
+func TestLeaveAllDeletesSoleMemberWorkspaces(t *testing.T) {
+	manager := newTestManager("alice", "bob")
+	solo, _ := manager.CreateWorkspace(CreateRequest{UserID: 1, Name: "Solo"})
+	shared, _ := manager.CreateWorkspace(CreateRequest{UserID: 1, Name: "Shared"})
+	manager.AddMember(AddMemberRequest{UserID: 1, WorkspaceID: shared.Workspace.ID, Username: "bob", Role: RoleOwner})
+
+	left, err := manager.LeaveAll(LeaveAllRequest{UserID: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{solo.Workspace.ID}, left.Deleted)
+	assert.Equal(t, map[uint]uint{shared.Workspace.ID: 2}, left.Successors)
+
+	listed, _ := manager.ListWorkspaces(ListRequest{UserID: 2})
+	assert.Len(t, listed.Workspaces, 1)
+
+	_, err = manager.GetMembers(MembersRequest{UserID: 1, WorkspaceID: solo.Workspace.ID})
+	assert.Equal(t, http.StatusNotFound, err.StatusCode())
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 
@@ -10,6 +11,9 @@ import (
 )
 
 func main() {
+	bootstrapAdmin := flag.String("bootstrap-admin", "", "make an existing account the first administrator and exit")
+	flag.Parse()
+
 	if os.Getenv("ENV") != "PROD" {
 		err := godotenv.Load()
 
@@ -21,5 +25,14 @@ func main() {
 	db := database.InitDB()
 	app := application.Application{}
 	app.InitApp(db)
+
+	if *bootstrapAdmin != "" {
+		if err := app.BootstrapAdmin(*bootstrapAdmin); err != nil {
+			log.Fatalf("Error bootstrapping administrator: %s", err)
+		}
+		log.Printf("%s is now an administrator", *bootstrapAdmin)
+		return
+	}
+
 	app.Run()
 }